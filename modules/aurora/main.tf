@@ -10,6 +10,9 @@ resource "aws_rds_cluster" "aurora_cluster" {
   master_username = var.username
   database_name   = var.default_database_name
 
+  # the major upgrades must be explicitly allowed, the instances are upgraded with the cluster
+  allow_major_version_upgrade = var.allow_major_version_upgrade
+
   iam_database_authentication_enabled = var.iam_auth_enabled
 
   # don't assign twice the roles, otherwise you may encounter conflicts
@@ -46,7 +49,7 @@ resource "aws_rds_cluster_instance" "aurora_instance" {
 
   ca_cert_identifier         = var.ca_cert_identifier
   engine                     = var.engine
-  engine_version             = var.engine_version
+  engine_version             = aws_rds_cluster.aurora_cluster.engine_version # the cluster alone drives the upgrades
   auto_minor_version_upgrade = var.auto_minor_version_upgrade
   instance_class             = var.instance_class
 
@@ -1,4 +1,4 @@
-# ! Developer: if you are adding a variable without a default value, please ensure to reference it in the cleanup script (.github/actions/eks-cleanup-resources/scripts/destroy.sh)
+# ! Developer: if you are adding a variable without a default value, please ensure to reference it in the cleanup tooling (DestroyVars in test/src/utils/reaper.go), this is checked by `just module-contract`
 variable "cluster_name" {
   description = "Name of the cluster, also used to prefix dependent resources. Format: /[[:lower:][:digit:]-]/"
 }
@@ -15,6 +15,11 @@ variable "engine_version" {
   description = "The DB engine version for Postgres to use."
 }
 
+variable "allow_major_version_upgrade" {
+  default     = false
+  description = "If true, the engine_version can be changed to a new major version, the cluster is upgraded immediately"
+}
+
 variable "auto_minor_version_upgrade" {
   default     = true
   description = "If true, minor engine upgrades will be applied automatically to the DB instance during the maintenance window"
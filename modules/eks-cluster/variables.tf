@@ -1,4 +1,4 @@
-# ! Developer: if you are adding a variable without a default value, please ensure to reference it in the cleanup script (.github/actions/eks-cleanup-resources/scripts/destroy.sh)
+# ! Developer: if you are adding a variable without a default value, please ensure to reference it in the cleanup tooling (DestroyVars in test/src/utils/reaper.go), this is checked by `just module-contract`
 
 variable "region" {
   type        = string
@@ -0,0 +1,96 @@
+// Command eks-cleanup destroys the resources of the terraform states left by the tests in the state bucket.
+// It replaces the former destroy.sh script of the eks-cleanup-resources action.
+//
+// Usage:
+//
+//	go run ./cmd/eks-cleanup -bucket <BUCKET> [-min-age-hours 20] [-target all] [-module all] [-dry-run] [-report -]
+//
+// The logs are written on stderr and the JSON report on stdout (or in the -report file).
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/camunda/camunda-tf-eks-module/utils"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	opts := utils.ReaperOptions{}
+	var minAgeHours int
+	var reportPath string
+
+	flag.StringVar(&opts.Bucket, "bucket", "", "Bucket containing the terraform states of the tests (required)")
+	flag.StringVar(&opts.Region, "region", os.Getenv("AWS_REGION"), "Region of the resources to destroy")
+	flag.StringVar(&opts.BucketRegion, "bucket-region", "", "Region of the state bucket, defaults to -region")
+	flag.StringVar(&opts.ModulesDir, "modules-dir", "../../modules/", "Directory containing the terraform modules")
+	flag.StringVar(&opts.TempDir, "temp-dir", "./tmp/eks-cleanup/", "Directory where the modules are copied before being destroyed")
+	flag.IntVar(&minAgeHours, "min-age-hours", 20, "Minimum age in hours of the states to destroy")
+	flag.StringVar(&opts.Target, "target", "all", "ID contained in the keys of the states to destroy, or \"all\"")
+	flag.StringVar(&opts.Module, "module", "all", "Name of the module to destroy (eks-cluster, aurora, opensearch), or \"all\"")
+	flag.StringVar(&opts.TerraformBinary, "tf-binary", utils.GetEnv("TESTS_TF_BINARY_NAME", "terraform"), "Terraform binary")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "Only report the states that would be destroyed")
+	flag.StringVar(&reportPath, "report", "-", "Path of the JSON report, - for stdout")
+	flag.Parse()
+
+	if opts.Bucket == "" || opts.Region == "" {
+		fmt.Fprintln(os.Stderr, "Error: -bucket and -region (or AWS_REGION) are required")
+		flag.Usage()
+		return 2
+	}
+	if opts.BucketRegion == "" {
+		opts.BucketRegion = opts.Region
+	}
+	opts.MinAge = time.Duration(minAgeHours) * time.Hour
+
+	// the helpers log on stdout, it is reserved to the report
+	reportOutput := os.Stdout
+	os.Stdout = os.Stderr
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	sess, err := utils.GetAwsClientF(utils.GetAwsProfile(), opts.BucketRegion)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to get AWS client: %v\n", err)
+		return 1
+	}
+
+	report, errReaper := utils.RunReaper(ctx, sess, opts)
+
+	if reportPath != "-" {
+		reportOutput, err = os.Create(reportPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to create the report: %v\n", err)
+			return 1
+		}
+		defer reportOutput.Close()
+	}
+	encoder := json.NewEncoder(reportOutput)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write the report: %v\n", err)
+		return 1
+	}
+
+	if errReaper != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errReaper)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "destroyed=%d planned=%d skipped=%d failed=%d\n",
+		report.Count(utils.ReaperDestroyed), report.Count(utils.ReaperPlanned), report.Count(utils.ReaperSkipped), report.Count(utils.ReaperFailed))
+	if report.Count(utils.ReaperFailed) > 0 {
+		fmt.Fprintln(os.Stderr, "One or more operations failed.")
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+// Command eks-inventory lists the resources left by the tests: VPCs, EKS clusters and node groups, Aurora clusters,
+// OpenSearch domains, IAM roles, KMS keys and terraform states whose name contains one of the prefixes.
+//
+// Usage:
+//
+//	go run ./cmd/eks-inventory [-prefix cluster-test,cluster-rds,cl-os,cluster-upgrade] [-bucket <BUCKET>] [-output -] [-fail-on-resources]
+//
+// The JSON inventory is sorted and has no timestamp, two inventories can be diffed.
+// The command exits with 1 if a source cannot be listed, or if resources are found with -fail-on-resources.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/camunda/camunda-tf-eks-module/utils"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// defaultPrefixes are the cluster prefixes of the test suites
+const defaultPrefixes = "cluster-test,cluster-rds,cl-os,cluster-upgrade"
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	opts := utils.InventoryOptions{}
+	var prefixes, region, outputPath string
+	var failOnResources bool
+
+	flag.StringVar(&prefixes, "prefix", defaultPrefixes, "Comma separated prefixes (or names) of the clusters of the tests")
+	flag.StringVar(&region, "region", os.Getenv("AWS_REGION"), "Region of the resources")
+	flag.StringVar(&opts.Bucket, "bucket", "", "Bucket containing the terraform states of the tests, the states are not listed if empty")
+	flag.StringVar(&opts.BucketRegion, "bucket-region", "", "Region of the state bucket, defaults to -region")
+	flag.StringVar(&outputPath, "output", "-", "Path of the JSON inventory, - for stdout")
+	flag.BoolVar(&failOnResources, "fail-on-resources", false, "Exit with 1 if any resource is found")
+	flag.Parse()
+
+	if region == "" {
+		fmt.Fprintln(os.Stderr, "Error: -region (or AWS_REGION) is required")
+		flag.Usage()
+		return 2
+	}
+	if opts.BucketRegion == "" {
+		opts.BucketRegion = region
+	}
+	for _, prefix := range strings.Split(prefixes, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			opts.Prefixes = append(opts.Prefixes, prefix)
+		}
+	}
+	if len(opts.Prefixes) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: -prefix can't be empty, it would match every resource")
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	sess, err := utils.GetAwsClientF(utils.GetAwsProfile(), region)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to get AWS client: %v\n", err)
+		return 1
+	}
+
+	inventory, errInventory := utils.ListInventory(ctx, sess, opts)
+
+	output := os.Stdout
+	if outputPath != "-" {
+		output, err = os.Create(outputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to create the inventory: %v\n", err)
+			return 1
+		}
+		defer output.Close()
+	}
+	if _, err := fmt.Fprintln(output, inventory.JSON()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write the inventory: %v\n", err)
+		return 1
+	}
+
+	if errInventory != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errInventory)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "resources=%d\n", inventory.Count(""))
+	if failOnResources && inventory.Count("") > 0 {
+		fmt.Fprintln(os.Stderr, "Resources of the tests are left.")
+		return 1
+	}
+	return 0
+}
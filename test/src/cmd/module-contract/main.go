@@ -0,0 +1,42 @@
+// Command module-contract checks the contract of the terraform modules without terraform nor AWS account:
+// the variables without default are set by the cleanup tooling (DestroyVars), the fixtures only set declared variables,
+// the outputs have a description and the variables are referenced.
+//
+// Usage:
+//
+//	go run ./cmd/module-contract [-modules-dir ../../modules/]
+//
+// Each issue is printed as <file>:<line>: <module>: <message>, the command exits with 1 if any is found.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/camunda/camunda-tf-eks-module/utils"
+	"os"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	modulesDir := flag.String("modules-dir", "../../modules/", "Directory containing the terraform modules")
+	flag.Parse()
+
+	issues, err := utils.CheckModulesContract(*modulesDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues) > 0 {
+		fmt.Fprintf(os.Stderr, "%d contract issue(s) found in %s\n", len(issues), *modulesDir)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "The modules of %s respect their contract\n", *modulesDir)
+	return 0
+}
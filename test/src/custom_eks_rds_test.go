@@ -5,155 +5,76 @@ import (
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/camunda/camunda-tf-eks-module/utils"
-	"github.com/gruntwork-io/terratest/modules/k8s"
-	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/camunda/camunda-tf-eks-module/utils/iampolicy"
 	"github.com/gruntwork-io/terratest/modules/terraform"
-	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 	"github.com/sethvargo/go-password/password"
 	"github.com/stretchr/testify/suite"
-	"go.uber.org/zap"
-	"go.uber.org/zap/zaptest"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"os"
-	"path/filepath"
-	"strings"
 	"testing"
 	"time"
 )
 
 type CustomEKSRDSTestSuite struct {
-	suite.Suite
-	logger          *zap.Logger
-	sugaredLogger   *zap.SugaredLogger
-	clusterName     string
-	expectedNodes   int
-	kubeConfigPath  string
-	region          string
-	bucketRegion    string
-	tfDataDir       string
-	tfBinaryName    string
-	varTf           map[string]interface{}
-	tfStateS3Bucket string
-}
-
-func (suite *CustomEKSRDSTestSuite) SetupTest() {
-	suite.logger = zaptest.NewLogger(suite.T())
-	suite.sugaredLogger = suite.logger.Sugar()
-
-	clusterSuffix := utils.GetEnv("TESTS_CLUSTER_ID", strings.ToLower(random.UniqueId()))
-	suite.clusterName = fmt.Sprintf("cluster-rds-%s", clusterSuffix)
-	suite.region = utils.GetEnv("TESTS_CLUSTER_REGION", "eu-central-1")
-	suite.bucketRegion = utils.GetEnv("TF_STATE_BUCKET_REGION", suite.region)
-	suite.tfBinaryName = utils.GetEnv("TESTS_TF_BINARY_NAME", "terraform")
-	suite.sugaredLogger.Infow("Terraform binary for the suite", "binary", suite.tfBinaryName)
-
-	suite.expectedNodes = 1
-	var errAbsPath error
-	suite.tfStateS3Bucket = utils.GetEnv("TF_STATE_BUCKET", fmt.Sprintf("tests-eks-tf-state-%s", suite.bucketRegion))
-	suite.tfDataDir, errAbsPath = filepath.Abs(fmt.Sprintf("../../test/states/tf-data-%s", suite.clusterName))
-	suite.Require().NoError(errAbsPath)
-	suite.kubeConfigPath = fmt.Sprintf("%s/kubeconfig-rds-eks", suite.tfDataDir)
-}
-
-func (suite *CustomEKSRDSTestSuite) TearUpTest() {
-	// create tf state
-	absPath, err := filepath.Abs(suite.tfDataDir)
-	suite.Require().NoError(err)
-	err = os.MkdirAll(absPath, os.ModePerm)
-	suite.Require().NoError(err)
-}
-
-func (suite *CustomEKSRDSTestSuite) TearDownTest() {
-	suite.T().Log("Cleaning up resources...")
-
-	err := os.Remove(suite.kubeConfigPath)
-	if err != nil && !os.IsNotExist(err) {
-		suite.T().Errorf("Failed to remove kubeConfigPath: %v", err)
-	}
+	utils.BaseSuite
+	expectedNodes int
+	varTf         map[string]interface{}
 }
 
 // TestCustomEKSAndRDS spawns a custom EKS cluster with custom parameters, and spawns a
 // pg client pod that will test connection to AuroraDB
 func (suite *CustomEKSRDSTestSuite) TestCustomEKSAndRDS() {
+	ctx, cancel := utils.NewTestContext(suite.T())
+	defer cancel()
+
 	suite.varTf = map[string]interface{}{
-		"name":                  suite.clusterName,
-		"region":                suite.region,
+		"name":                  suite.ClusterName,
+		"region":                suite.Region,
 		"np_desired_node_count": suite.expectedNodes,
 		// we test the definition of specific AZs, also RDS requires exactly 3AZs
-		"availability_zones": []string{fmt.Sprintf("%sa", suite.region), fmt.Sprintf("%sb", suite.region), fmt.Sprintf("%sc", suite.region)},
+		"availability_zones": []string{fmt.Sprintf("%sa", suite.Region), fmt.Sprintf("%sb", suite.Region), fmt.Sprintf("%sc", suite.Region)},
 	}
 
-	suite.sugaredLogger.Infow("Creating EKS cluster...", "extraVars", suite.varTf)
-
-	tfModuleEKS := "eks-cluster/"
-	fullDirEKS := fmt.Sprintf("%s%s", suite.tfDataDir, tfModuleEKS)
-	errTfDirEKS := os.MkdirAll(fullDirEKS, os.ModePerm)
-	suite.Require().NoError(errTfDirEKS)
-	tfDir := test_structure.CopyTerraformFolderToDest(suite.T(), "../../modules/", tfModuleEKS, fullDirEKS)
-
-	errLinkBackend := os.Link("../../modules/fixtures/backend.tf", filepath.Join(tfDir, "backend.tf"))
-	suite.Require().NoError(errLinkBackend)
-
-	terraformOptions := &terraform.Options{
-		TerraformBinary: suite.tfBinaryName,
-		TerraformDir:    tfDir,
-		Upgrade:         false,
-		VarFiles:        []string{"../fixtures/fixtures.default.eks.tfvars"},
-		Vars:            suite.varTf,
-		BackendConfig: map[string]interface{}{
-			"bucket": suite.tfStateS3Bucket,
-			"key":    fmt.Sprintf("terraform/%s/TestCustomEKSRDSTestSuite/%sterraform.tfstate", suite.clusterName, tfModuleEKS),
-			"region": suite.bucketRegion,
-		},
-	}
+	suite.SugaredLogger.Infow("Creating EKS cluster...", "extraVars", suite.varTf)
 
-	// configure bucket backend
-	sessBackend, err := utils.GetAwsClientF(utils.GetAwsProfile(), suite.bucketRegion)
-	suite.Require().NoErrorf(err, "Failed to get aws client")
-	err = utils.CreateS3BucketIfNotExists(sessBackend, suite.tfStateS3Bucket, utils.TF_BUCKET_DESCRIPTION, suite.bucketRegion)
-	suite.Require().NoErrorf(err, "Failed to create s3 state bucket")
+	tfDir := suite.CopyModule("eks-cluster")
+	terraformOptions := suite.TerraformOptions(tfDir, "eks-cluster", "eks", suite.varTf)
 
-	cleanClusterAtTheEnd := utils.GetEnv("CLEAN_CLUSTER_AT_THE_END", "true")
-	if cleanClusterAtTheEnd == "true" {
-		defer utils.DeferCleanup(suite.T(), suite.bucketRegion, terraformOptions)
-	}
+	suite.EnsureStateBucket()
+	defer suite.DeferCleanup(terraformOptions)
 
 	// due to output of the creation changing tags from null to {}, we can't pass the
 	// idempotency test
 	terraform.InitAndApply(suite.T(), terraformOptions)
 
 	// basic tests after terraform apply
-	expectedVpcAZs := fmt.Sprintf("[%sa %sb %sc]", suite.varTf["region"], suite.varTf["region"], suite.varTf["region"])
-	suite.Assert().Equal(expectedVpcAZs, terraform.Output(suite.T(), terraformOptions, "vpc_azs"))
+	outputs := utils.LoadOutputs[utils.EKSClusterOutputs](suite.T(), terraformOptions)
+	suite.Assert().Equal(suite.varTf["availability_zones"], outputs.VpcAZs)
 
-	sess, err := utils.GetAwsClient()
+	sess, err := suite.AwsClient()
 	suite.Require().NoErrorf(err, "Failed to get aws client")
 
 	// list your services here
 	eksSvc := eks.NewFromConfig(sess)
+	iamSvc := iam.NewFromConfig(sess)
 	rdsSvc := rds.NewFromConfig(sess)
 	stsSvc := sts.NewFromConfig(sess)
 
 	inputEKS := &eks.DescribeClusterInput{
-		Name: aws.String(suite.clusterName),
+		Name: aws.String(suite.ClusterName),
 	}
 
 	result, err := eksSvc.DescribeCluster(context.Background(), inputEKS)
 	suite.Assert().NoError(err)
 
-	suite.sugaredLogger.Infow("Waiting for worker nodes to join the EKS cluster")
-	errClusterReady := utils.WaitUntilKubeClusterIsReady(result.Cluster, 5*time.Minute, uint64(suite.expectedNodes))
+	suite.SugaredLogger.Infow("Waiting for worker nodes to join the EKS cluster")
+	errClusterReady := utils.WaitUntilKubeClusterIsReady(ctx, result.Cluster, suite.Config.AwsProfile, 5*time.Minute, uint64(suite.expectedNodes))
 	suite.Require().NoError(errClusterReady)
 
-	// Spawn RDS within the EKS VPC/subnet
-	publicBlocks := strings.Fields(strings.Trim(terraform.Output(suite.T(), terraformOptions, "public_vpc_cidr_blocks"), "[]"))
-	privateBlocks := strings.Fields(strings.Trim(terraform.Output(suite.T(), terraformOptions, "private_vpc_cidr_blocks"), "[]"))
-
 	// Extract OIDC issuer and create the IRSA role with RDS Aurora access
 	oidcProviderID, errorOIDC := utils.ExtractOIDCProviderID(result)
 	suite.Require().NoError(errorOIDC)
@@ -162,7 +83,7 @@ func (suite *CustomEKSRDSTestSuite) TestCustomEKSAndRDS() {
 	suite.Require().NoError(err, "Failed to get AWS account ID")
 
 	accountId := *stsIdentity.Account
-	auroraClusterName := fmt.Sprintf("postgres-%s", suite.clusterName)
+	auroraClusterName := fmt.Sprintf("postgres-%s", suite.ClusterName)
 	auroraUsername := "adminuser"
 	auroraPassword, errPassword := password.Generate(18, 4, 0, false, false)
 	suite.Require().NoError(errPassword)
@@ -170,60 +91,35 @@ func (suite *CustomEKSRDSTestSuite) TestCustomEKSAndRDS() {
 
 	// Define the ARN for RDS IAM DB Auth
 	auroraIRSAUsername := "myirsauser"
-	suite.sugaredLogger.Infow("Aurora RDS IAM infos", "accountId", accountId)
+	suite.SugaredLogger.Infow("Aurora RDS IAM infos", "accountId", accountId)
 
-	utils.GenerateKubeConfigFromAWS(suite.T(), suite.region, suite.clusterName, utils.GetAwsProfile(), suite.kubeConfigPath)
+	utils.GenerateKubeConfigFromAWS(suite.T(), suite.Region, suite.ClusterName, suite.Config.AwsProfile, suite.KubeConfigPath)
 
 	// Create namespace and associated service account in EKS
 	auroraNamespace := "aurora"
 	auroraServiceAccount := "aurora-access-sa"
-	auroraRole := fmt.Sprintf("AuroraRole-%s", suite.clusterName)
-	auroraKubectlOptions := k8s.NewKubectlOptions("", suite.kubeConfigPath, auroraNamespace)
-	utils.CreateIfNotExistsNamespace(suite.T(), auroraKubectlOptions, auroraNamespace)
-	utils.CreateIfNotExistsServiceAccount(suite.T(), auroraKubectlOptions, auroraServiceAccount, map[string]string{
-		"eks.amazonaws.com/role-arn": fmt.Sprintf("arn:aws:iam::%s:role/%s", accountId, auroraRole),
-	})
-
-	// Define the Aurora access policy for IAM DB Auth
-	auroraAccessPolicy := fmt.Sprintf(`{
-  "Version": "2012-10-17",
-  "Statement": [
-    {
-      "Effect": "Allow",
-      "Action": [
-        "rds-db:connect"
-      ],
-      "Resource": "arn:aws:rds-db:%s:%s:dbuser:*/%s"
-    }
-  ]
-}`, suite.region, accountId, auroraIRSAUsername)
-
-	// Define the trust policy for Aurora IAM role
-	iamRoleTrustPolicy := fmt.Sprintf(`{
-  "Version": "2012-10-17",
-  "Statement": [
-    {
-      "Effect": "Allow",
-      "Principal": {
-        "Federated": "arn:aws:iam::%s:oidc-provider/%s"
-      },
-      "Action": "sts:AssumeRoleWithWebIdentity",
-      "Condition": {
-        "StringEquals": {
-          "%s:sub": "system:serviceaccount:%s:%s"
-        }
-      }
-    }
-  ]
-}`, accountId, oidcProviderID, oidcProviderID, auroraNamespace, auroraServiceAccount)
+	auroraRole := fmt.Sprintf("AuroraRole-%s", suite.ClusterName)
+	kubeClient, err := utils.NewKubeClientSet(result.Cluster, suite.Config.AwsProfile)
+	suite.Require().NoError(err)
+	namespaceResult, err := utils.EnsureNamespace(ctx, kubeClient, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: auroraNamespace}})
+	suite.Require().NoError(err)
+	// the role of a previous run with the same cluster name is replaced
+	serviceAccountResult, err := utils.EnsureServiceAccount(ctx, kubeClient, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:      auroraServiceAccount,
+		Namespace: auroraNamespace,
+		Annotations: map[string]string{
+			"eks.amazonaws.com/role-arn": fmt.Sprintf("arn:aws:iam::%s:role/%s", accountId, auroraRole),
+		},
+	}})
+	suite.Require().NoError(err)
+	suite.SugaredLogger.Infow("Kubernetes resources", "namespace", namespaceResult.String(), "serviceAccount", serviceAccountResult.String())
 
+	// the role can be assumed by the service account and allows to connect to Aurora as the IRSA user (IAM DB Auth)
 	iamRolesWithPolicies := []interface{}{
-		map[string]interface{}{
-			"role_name": auroraRole,
-			// escape and put everything on a single line
-			"trust_policy":  strings.ReplaceAll(strings.ReplaceAll(iamRoleTrustPolicy, "\n", " "), `"`, `\"`),
-			"access_policy": strings.ReplaceAll(strings.ReplaceAll(auroraAccessPolicy, "\n", " "), `"`, `\"`),
-		},
+		iampolicy.RoleWithPolicies(auroraRole,
+			iampolicy.IRSATrustPolicy(accountId, oidcProviderID, auroraNamespace, auroraServiceAccount),
+			iampolicy.RDSConnectPolicy(suite.Region, accountId, auroraIRSAUsername),
+		),
 	}
 
 	varsConfigAurora := map[string]interface{}{
@@ -234,45 +130,36 @@ func (suite *CustomEKSRDSTestSuite) TestCustomEKSAndRDS() {
 		"subnet_ids":              result.Cluster.ResourcesVpcConfig.SubnetIds,
 		"vpc_id":                  *result.Cluster.ResourcesVpcConfig.VpcId,
 		"availability_zones":      suite.varTf["availability_zones"], // we must match the zones of the EKS cluster
-		"cidr_blocks":             append(publicBlocks, privateBlocks...),
+		"cidr_blocks":             outputs.VpcCidrBlocks(),           // spawn RDS within the EKS VPC/subnet
 		"iam_auth_enabled":        true,
 		"iam_roles_with_policies": iamRolesWithPolicies,
 	}
 
-	tfModuleAurora := "aurora/"
-	fullDirAurora := fmt.Sprintf("%s/%s", suite.tfDataDir, tfModuleAurora)
-	errTfDirAurora := os.MkdirAll(fullDirAurora, os.ModePerm)
-	suite.Require().NoError(errTfDirAurora)
-
-	tfDirAurora := test_structure.CopyTerraformFolderToDest(suite.T(), "../../modules/", tfModuleAurora, fullDirAurora)
-
-	errLinkBackend = os.Link("../../modules/fixtures/backend.tf", filepath.Join(tfDirAurora, "backend.tf"))
-	suite.Require().NoError(errLinkBackend)
-
-	terraformOptionsRDS := &terraform.Options{
-		TerraformBinary: suite.tfBinaryName,
-		TerraformDir:    tfDirAurora,
-		Upgrade:         false,
-		VarFiles:        []string{"../fixtures/fixtures.default.aurora.tfvars"},
-		Vars:            varsConfigAurora,
-		BackendConfig: map[string]interface{}{
-			"bucket": suite.tfStateS3Bucket,
-			"key":    fmt.Sprintf("terraform/%s/TestCustomEKSRDSTestSuite/%sterraform.tfstate", suite.clusterName, tfModuleAurora),
-			"region": suite.bucketRegion,
-		},
-	}
-
-	if cleanClusterAtTheEnd == "true" {
-		defer utils.DeferCleanup(suite.T(), suite.bucketRegion, terraformOptionsRDS)
-	}
+	tfDirAurora := suite.CopyModule("aurora")
+	terraformOptionsRDS := suite.TerraformOptions(tfDirAurora, "aurora", "aurora", varsConfigAurora)
+	defer suite.DeferCleanup(terraformOptionsRDS)
 
 	terraform.InitAndApplyAndIdempotent(suite.T(), terraformOptionsRDS)
-	auroraEndpoint := terraform.Output(suite.T(), terraformOptionsRDS, "aurora_endpoint")
+	auroraOutputs := utils.LoadOutputs[utils.AuroraOutputs](suite.T(), terraformOptionsRDS)
+	auroraEndpoint := auroraOutputs.Endpoint
 	suite.Assert().NotEmpty(auroraEndpoint)
 
-	// Test of the RDS connection is performed by launching a pod on the cluster and test the pg connection
-	pgKubeCtlOptions := k8s.NewKubectlOptions("", suite.kubeConfigPath, auroraNamespace)
+	// only the service account of the namespace can assume the role
+	auroraRoleOutput, err := iamSvc.GetRole(context.Background(), &iam.GetRoleInput{RoleName: aws.String(auroraRole)})
+	suite.Require().NoError(err)
+	trustPolicy, err := iampolicy.ParseEncoded(*auroraRoleOutput.Role.AssumeRolePolicyDocument)
+	suite.Require().NoError(err)
+	suite.Assert().True(trustPolicy.Allows(iampolicy.AssumeRoleWithWebIdentityRequest(accountId, oidcProviderID, auroraNamespace, auroraServiceAccount)))
+	suite.Assert().False(trustPolicy.Allows(iampolicy.AssumeRoleWithWebIdentityRequest(accountId, oidcProviderID, auroraNamespace, "default")))
+
+	// the role only allows to connect to Aurora as the IRSA user, neither as the admin user nor as any other user
+	accessPolicy, err := utils.RoleAccessPolicy(context.Background(), iamSvc, auroraRole)
+	suite.Require().NoError(err)
+	suite.Assert().True(accessPolicy.Allows(iampolicy.Request{Action: "rds-db:connect", Resource: iampolicy.RDSDBUserARN(suite.Region, accountId, auroraIRSAUsername)}))
+	suite.Assert().False(accessPolicy.Allows(iampolicy.Request{Action: "rds-db:connect", Resource: iampolicy.RDSDBUserARN(suite.Region, accountId, auroraUsername)}))
+	suite.Assert().False(accessPolicy.Allows(iampolicy.Request{Action: "rds-db:connect", Resource: iampolicy.RDSDBUserARN(suite.Region, accountId, "otheruser")}))
 
+	// Test of the RDS connection is performed by launching a pod on the cluster and test the pg connection
 	// deploy the postgres-client ConfigMap
 	configMapPostgres := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
@@ -285,22 +172,11 @@ func (suite *CustomEKSRDSTestSuite) TestCustomEKSAndRDS() {
 			"aurora_password":      auroraPassword,
 			"aurora_username_irsa": auroraIRSAUsername,
 			"aurora_port":          "5432",
-			"aws_region":           suite.region,
+			"aws_region":           suite.Region,
 			"aurora_db_name":       auroraDatabase,
 		},
 	}
 
-	// create a kubeclient
-	kubeClient, err := utils.NewKubeClientSet(result.Cluster)
-	suite.Require().NoError(err)
-
-	err = kubeClient.CoreV1().ConfigMaps(auroraNamespace).Delete(context.Background(), configMapPostgres.Name, metav1.DeleteOptions{})
-	if err != nil && !errors.IsNotFound(err) {
-		suite.Require().NoError(err)
-	}
-	_, err = kubeClient.CoreV1().ConfigMaps(auroraNamespace).Create(context.Background(), configMapPostgres, metav1.CreateOptions{})
-	k8s.WaitUntilConfigMapAvailable(suite.T(), pgKubeCtlOptions, configMapPostgres.Name, 6, 10*time.Second)
-
 	// create the secret for aurora pg password
 	secretPostgres := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -311,26 +187,18 @@ func (suite *CustomEKSRDSTestSuite) TestCustomEKSAndRDS() {
 			"aurora_password": auroraPassword,
 		},
 	}
-	err = kubeClient.CoreV1().Secrets(auroraNamespace).Delete(context.Background(), secretPostgres.Name, metav1.DeleteOptions{})
-	if err != nil && !errors.IsNotFound(err) {
-		suite.Require().NoError(err)
-	}
-	_, err = kubeClient.CoreV1().Secrets(auroraNamespace).Create(context.Background(), secretPostgres, metav1.CreateOptions{})
-	k8s.WaitUntilSecretAvailable(suite.T(), pgKubeCtlOptions, secretPostgres.Name, 6, 10*time.Second)
-
-	// cleanup existing jobs
-	jobListOptions := metav1.ListOptions{LabelSelector: "app=postgres-client"}
-	existingJobs := k8s.ListJobs(suite.T(), pgKubeCtlOptions, jobListOptions)
-	backgroundDeletion := metav1.DeletePropagationBackground
-	for _, job := range existingJobs {
-		err := kubeClient.BatchV1().Jobs(auroraNamespace).Delete(context.Background(), job.Name, metav1.DeleteOptions{PropagationPolicy: &backgroundDeletion})
-		suite.Assert().NoError(err)
-	}
 
-	// deploy the postgres-client Job to test the connection
-	k8s.KubectlApply(suite.T(), pgKubeCtlOptions, "../../modules/fixtures/postgres-client.yml")
-	errJob := utils.WaitForJobCompletion(kubeClient, auroraNamespace, "postgres-client", 5*time.Minute, jobListOptions)
-	suite.Require().NoError(errJob)
+	// deploy the postgres-client Job to test the connection, the logs and exit codes of its pods are reported on failure
+	jobPostgres, err := utils.LoadJobManifest("../../modules/fixtures/postgres-client.yml")
+	suite.Require().NoError(err)
+	jobResult, errJob := utils.RunJob(ctx, kubeClient, utils.JobRun{
+		Namespace:  auroraNamespace,
+		Job:        jobPostgres,
+		ConfigMaps: []*corev1.ConfigMap{configMapPostgres},
+		Secrets:    []*corev1.Secret{secretPostgres},
+		Timeout:    5 * time.Minute,
+	})
+	suite.Require().NoError(errJob, jobResult.Summary())
 
 	// Retrieve RDS information
 	describeDBClusterInput := &rds.DescribeDBClustersInput{
@@ -339,7 +207,7 @@ func (suite *CustomEKSRDSTestSuite) TestCustomEKSAndRDS() {
 	describeDBClusterOutput, err := rdsSvc.DescribeDBClusters(context.Background(), describeDBClusterInput)
 	suite.Require().NoError(err)
 
-	expectedRDSAZ := []string{fmt.Sprintf("%sa", suite.region), fmt.Sprintf("%sb", suite.region), fmt.Sprintf("%sc", suite.region)}
+	expectedRDSAZ := []string{fmt.Sprintf("%sa", suite.Region), fmt.Sprintf("%sb", suite.Region), fmt.Sprintf("%sc", suite.Region)}
 	suite.Assert().Equal(true, *describeDBClusterOutput.DBClusters[0].IAMDatabaseAuthenticationEnabled)
 	suite.Assert().Equal(varsConfigAurora["username"].(string), *describeDBClusterOutput.DBClusters[0].MasterUsername)
 	suite.Assert().Equal(auroraDatabase, *describeDBClusterOutput.DBClusters[0].DatabaseName)
@@ -359,7 +227,7 @@ func (suite *CustomEKSRDSTestSuite) TestCustomEKSAndRDS() {
 	suite.Assert().Equal("aurora-postgresql", *describeDBInstanceOutput.DBInstances[0].Engine)
 	suite.Assert().Equal("rds-ca-rsa2048-g1", *describeDBInstanceOutput.DBInstances[0].CertificateDetails.CAIdentifier)
 	suite.Assert().Equal(varsConfigAurora["vpc_id"].(string), *describeDBInstanceOutput.DBInstances[0].DBSubnetGroup.VpcId)
-	suite.Assert().Contains(*describeDBInstanceOutput.DBInstances[0].AvailabilityZone, suite.region)
+	suite.Assert().Contains(*describeDBInstanceOutput.DBInstances[0].AvailabilityZone, suite.Region)
 
 	// construct the subnet ids
 	actualSubnetIds := make([]string, len(describeDBInstanceOutput.DBInstances[0].DBSubnetGroup.Subnets))
@@ -382,7 +250,7 @@ func (suite *CustomEKSRDSTestSuite) TestCustomEKSAndRDS() {
 		instanceType, _ := node.Labels["node.kubernetes.io/instance-type"]
 		for _, addr := range node.Status.Addresses {
 			if addr.Type == "InternalIP" {
-				suite.Assert().Equal(suite.region, regionNode)
+				suite.Assert().Equal(suite.Region, regionNode)
 				suite.Assert().Equal(expectedInstanceType, instanceType)
 			}
 		}
@@ -391,5 +259,5 @@ func (suite *CustomEKSRDSTestSuite) TestCustomEKSAndRDS() {
 
 func TestCustomEKSRDSTestSuite(t *testing.T) {
 	t.Parallel()
-	suite.Run(t, new(CustomEKSRDSTestSuite))
+	suite.Run(t, &CustomEKSRDSTestSuite{BaseSuite: utils.NewBaseSuite("cluster-rds"), expectedNodes: 1})
 }
@@ -0,0 +1,175 @@
+// Package plan holds the plan-only tests of the modules: each module is planned against the fake of utils/awsfake
+// with the fixtures and the assertions are made on the planned resources, no AWS account is required.
+package plan
+
+import (
+	"fmt"
+	"github.com/camunda/camunda-tf-eks-module/utils"
+	"github.com/camunda/camunda-tf-eks-module/utils/awsfake"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os/exec"
+	"testing"
+)
+
+// modulesDir is the path of the terraform modules relative to the plan tests
+const modulesDir = "../../../modules"
+
+const clusterName = "cluster-plan"
+
+type subnet struct {
+	CidrBlock string `json:"cidr_block"`
+}
+
+type nodeGroup struct {
+	NodeGroupName string `json:"node_group_name"`
+	CapacityType  string `json:"capacity_type"`
+	ScalingConfig []struct {
+		DesiredSize int `json:"desired_size"`
+		MinSize     int `json:"min_size"`
+		MaxSize     int `json:"max_size"`
+	} `json:"scaling_config"`
+}
+
+type kmsKey struct {
+	Description string `json:"description"`
+}
+
+type iamRole struct {
+	Name string `json:"name"`
+}
+
+type rdsClusterInstance struct {
+	CACertIdentifier string `json:"ca_cert_identifier"`
+	InstanceClass    string `json:"instance_class"`
+	EngineVersion    string `json:"engine_version"`
+}
+
+// planModule copies the module in a temporary directory, points its AWS provider to a fake and plans it
+// with the fixture fixtures.default.<fixture>.tfvars, the test is skipped if the terraform binary is not installed
+func planModule(t *testing.T, module, fixture string, vars map[string]interface{}) *utils.Plan {
+	config, err := utils.LoadTestConfig()
+	require.NoError(t, err, "Invalid tests configuration")
+	require.NoError(t, utils.ValidateModuleVars(modulesDir, module, fixture, vars), "Invalid variables for the module %s", module)
+
+	if _, err := exec.LookPath(config.TFBinaryName); err != nil {
+		t.Skipf("%s is not installed, skipping the plan of %s", config.TFBinaryName, module)
+	}
+
+	server := awsfake.NewServer()
+	t.Cleanup(server.Close)
+
+	tfDir := test_structure.CopyTerraformFolderToDest(t, modulesDir, module, t.TempDir())
+	require.NoError(t, utils.WriteMockAwsProvider(tfDir, config.ClusterRegion, server.URL))
+
+	plan, err := utils.PlanE(t, &terraform.Options{
+		TerraformBinary: config.TFBinaryName,
+		TerraformDir:    tfDir,
+		VarFiles:        []string{fmt.Sprintf("../fixtures/fixtures.default.%s.tfvars", fixture)},
+		Vars:            vars,
+		NoColor:         true,
+	})
+	require.NoError(t, err)
+	return plan
+}
+
+func plannedValues[T any](t *testing.T, plan *utils.Plan, resourceType string) []T {
+	values, err := utils.PlannedValues[T](plan, resourceType)
+	require.NoError(t, err)
+	require.NotEmptyf(t, values, "no %s in the plan", resourceType)
+	return values
+}
+
+func TestPlanEKSCluster(t *testing.T) {
+	t.Parallel()
+
+	plan := planModule(t, "eks-cluster", "eks", map[string]interface{}{
+		"name":                  clusterName,
+		"region":                "eu-central-1",
+		"np_desired_node_count": 3,
+	})
+
+	// the /16 of the nodes is split in 3 private then 3 public subnets
+	var cidrBlocks []string
+	for _, subnet := range plannedValues[subnet](t, plan, "aws_subnet") {
+		cidrBlocks = append(cidrBlocks, subnet.CidrBlock)
+	}
+	assert.ElementsMatch(t, []string{
+		"10.192.0.0/19", "10.192.32.0/19", "10.192.64.0/19",
+		"10.192.96.0/19", "10.192.128.0/19", "10.192.160.0/19",
+	}, cidrBlocks)
+
+	nodeGroups := plannedValues[nodeGroup](t, plan, "aws_eks_node_group")
+	require.Len(t, nodeGroups, 1)
+	assert.Equal(t, "SPOT", nodeGroups[0].CapacityType)
+	require.Len(t, nodeGroups[0].ScalingConfig, 1)
+	assert.Equal(t, 3, nodeGroups[0].ScalingConfig[0].DesiredSize)
+	assert.Equal(t, 1, nodeGroups[0].ScalingConfig[0].MinSize)
+	assert.Equal(t, 10, nodeGroups[0].ScalingConfig[0].MaxSize)
+
+	var kmsDescriptions []string
+	for _, key := range plannedValues[kmsKey](t, plan, "aws_kms_key") {
+		kmsDescriptions = append(kmsDescriptions, key.Description)
+	}
+	assert.Contains(t, kmsDescriptions, fmt.Sprintf("%s -  EKS Secret Encryption Key", clusterName))
+
+	var roleNames []string
+	for _, role := range plannedValues[iamRole](t, plan, "aws_iam_role") {
+		roleNames = append(roleNames, role.Name)
+	}
+	for _, role := range []string{"ebs-cs-role", "cert-manager-role", "external-dns-role"} {
+		assert.Contains(t, roleNames, fmt.Sprintf("%s-%s", clusterName, role))
+	}
+}
+
+func TestPlanAurora(t *testing.T) {
+	t.Parallel()
+
+	auroraClusterName := fmt.Sprintf("postgres-%s", clusterName)
+	plan := planModule(t, "aurora", "aurora", map[string]interface{}{
+		"cluster_name": auroraClusterName,
+		"username":     "adminuser",
+		"password":     "P4ssw0rd-plan",
+		"vpc_id":       "vpc-00000000000000000",
+		"subnet_ids":   []string{"subnet-00000000000000001", "subnet-00000000000000002", "subnet-00000000000000003"},
+		"cidr_blocks":  []string{"10.192.0.0/19", "10.192.32.0/19", "10.192.64.0/19"},
+	})
+
+	instances := plannedValues[rdsClusterInstance](t, plan, "aws_rds_cluster_instance")
+	for _, instance := range instances {
+		assert.Equal(t, "rds-ca-rsa2048-g1", instance.CACertIdentifier)
+		assert.Equal(t, "db.t3.medium", instance.InstanceClass)
+		// the instances run the version of the cluster
+		assert.Equal(t, "15.4", instance.EngineVersion)
+	}
+
+	keys := plannedValues[kmsKey](t, plan, "aws_kms_key")
+	require.Len(t, keys, 1)
+	assert.Equal(t, fmt.Sprintf("%s-key", auroraClusterName), keys[0].Description)
+}
+
+func TestPlanOpenSearch(t *testing.T) {
+	t.Parallel()
+
+	domainName := fmt.Sprintf("os-%s", clusterName)
+	plan := planModule(t, "opensearch", "opensearch", map[string]interface{}{
+		"domain_name": domainName,
+		"vpc_id":      "vpc-00000000000000000",
+		"subnet_ids":  []string{"subnet-00000000000000001", "subnet-00000000000000002", "subnet-00000000000000003"},
+		"cidr_blocks": []string{"10.192.0.0/19", "10.192.32.0/19", "10.192.64.0/19"},
+	})
+
+	keys := plannedValues[kmsKey](t, plan, "aws_kms_key")
+	require.Len(t, keys, 1)
+	assert.Equal(t, fmt.Sprintf("%s-key", domainName), keys[0].Description)
+
+	domains := plannedValues[struct {
+		DomainName    string `json:"domain_name"`
+		EngineVersion string `json:"engine_version"`
+	}](t, plan, "aws_opensearch_domain")
+	require.Len(t, domains, 1)
+	assert.Equal(t, domainName, domains[0].DomainName)
+	assert.Equal(t, "OpenSearch_2.15", domains[0].EngineVersion)
+}
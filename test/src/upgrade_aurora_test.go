@@ -0,0 +1,265 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/camunda/camunda-tf-eks-module/utils"
+	"github.com/camunda/camunda-tf-eks-module/utils/iampolicy"
+	"github.com/camunda/camunda-tf-eks-module/utils/version"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/sethvargo/go-password/password"
+	"github.com/stretchr/testify/suite"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"testing"
+	"time"
+)
+
+type UpgradeAuroraTestSuite struct {
+	utils.BaseSuite
+	expectedNodes int
+	// engineVersion is the version of Aurora PostgreSQL the cluster is created with, it is upgraded to its next minor
+	// and major versions
+	engineVersion string
+	varTf         map[string]interface{}
+}
+
+// TestUpgradeAurora creates an Aurora cluster at an older engine version with a marker row, upgrades its engine
+// as our users do (engine_version of the module, automatic minor version upgrade, major version upgrade) and checks
+// after each upgrade that the marker row, the IRSA login and the CA of the instances survived
+func (suite *UpgradeAuroraTestSuite) TestUpgradeAurora() {
+	ctx, cancel := utils.NewTestContext(suite.T())
+	defer cancel()
+
+	suite.varTf = map[string]interface{}{
+		"name":                  suite.ClusterName,
+		"region":                suite.Region,
+		"np_desired_node_count": suite.expectedNodes,
+		// RDS requires exactly 3AZs
+		"availability_zones": []string{fmt.Sprintf("%sa", suite.Region), fmt.Sprintf("%sb", suite.Region), fmt.Sprintf("%sc", suite.Region)},
+	}
+
+	suite.SugaredLogger.Infow("Creating EKS cluster...", "extraVars", suite.varTf)
+
+	tfDir := suite.CopyModule("eks-cluster")
+	terraformOptions := suite.TerraformOptions(tfDir, "eks-cluster", "eks", suite.varTf)
+
+	suite.EnsureStateBucket()
+	defer suite.DeferCleanup(terraformOptions)
+
+	// due to output of the creation changing tags from null to {}, we can't pass the
+	// idempotency test
+	terraform.InitAndApply(suite.T(), terraformOptions)
+	outputs := utils.LoadOutputs[utils.EKSClusterOutputs](suite.T(), terraformOptions)
+
+	sess, err := suite.AwsClient()
+	suite.Require().NoErrorf(err, "Failed to get aws client")
+
+	// list your services here
+	eksSvc := eks.NewFromConfig(sess)
+	rdsSvc := rds.NewFromConfig(sess)
+	stsSvc := sts.NewFromConfig(sess)
+
+	result, err := eksSvc.DescribeCluster(context.Background(), &eks.DescribeClusterInput{Name: aws.String(suite.ClusterName)})
+	suite.Require().NoError(err)
+
+	suite.SugaredLogger.Infow("Waiting for worker nodes to join the EKS cluster")
+	errClusterReady := utils.WaitUntilKubeClusterIsReady(ctx, result.Cluster, suite.Config.AwsProfile, 5*time.Minute, uint64(suite.expectedNodes))
+	suite.Require().NoError(errClusterReady)
+
+	// plan the versions of the upgrades from the versions available in the region
+	sourceVersion, err := version.Parse(version.AuroraPostgreSQL, suite.engineVersion)
+	suite.Require().NoError(err)
+	supportedVersions, err := version.SupportedAuroraPostgreSQL(ctx, rdsSvc)
+	suite.Require().NoError(err)
+	suite.Require().NoError(supportedVersions.Validate(sourceVersion))
+	minorVersion := suite.nextAuroraVersion(ctx, rdsSvc, sourceVersion, false)
+
+	oidcProviderID, errorOIDC := utils.ExtractOIDCProviderID(result)
+	suite.Require().NoError(errorOIDC)
+
+	stsIdentity, err := stsSvc.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	suite.Require().NoError(err, "Failed to get AWS account ID")
+
+	accountId := *stsIdentity.Account
+	auroraClusterName := fmt.Sprintf("postgres-%s", suite.ClusterName)
+	auroraUsername := "adminuser"
+	auroraPassword, errPassword := password.Generate(18, 4, 0, false, false)
+	suite.Require().NoError(errPassword)
+	auroraDatabase := "camunda"
+	auroraIRSAUsername := "myirsauser"
+
+	utils.GenerateKubeConfigFromAWS(suite.T(), suite.Region, suite.ClusterName, suite.Config.AwsProfile, suite.KubeConfigPath)
+
+	// Create namespace and associated service account in EKS
+	auroraNamespace := "aurora"
+	auroraServiceAccount := "aurora-access-sa"
+	auroraRole := fmt.Sprintf("AuroraRole-%s", suite.ClusterName)
+	kubeClient, err := utils.NewKubeClientSet(result.Cluster, suite.Config.AwsProfile)
+	suite.Require().NoError(err)
+	_, err = utils.EnsureNamespace(ctx, kubeClient, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: auroraNamespace}})
+	suite.Require().NoError(err)
+	_, err = utils.EnsureServiceAccount(ctx, kubeClient, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:      auroraServiceAccount,
+		Namespace: auroraNamespace,
+		Annotations: map[string]string{
+			"eks.amazonaws.com/role-arn": fmt.Sprintf("arn:aws:iam::%s:role/%s", accountId, auroraRole),
+		},
+	}})
+	suite.Require().NoError(err)
+
+	varsConfigAurora := map[string]interface{}{
+		"username":              auroraUsername,
+		"password":              auroraPassword,
+		"default_database_name": auroraDatabase,
+		"cluster_name":          auroraClusterName,
+		"subnet_ids":            result.Cluster.ResourcesVpcConfig.SubnetIds,
+		"vpc_id":                *result.Cluster.ResourcesVpcConfig.VpcId,
+		"availability_zones":    suite.varTf["availability_zones"], // we must match the zones of the EKS cluster
+		"cidr_blocks":           outputs.VpcCidrBlocks(),           // spawn RDS within the EKS VPC/subnet
+		"iam_auth_enabled":      true,
+		"iam_roles_with_policies": []interface{}{
+			iampolicy.RoleWithPolicies(auroraRole,
+				iampolicy.IRSATrustPolicy(accountId, oidcProviderID, auroraNamespace, auroraServiceAccount),
+				iampolicy.RDSConnectPolicy(suite.Region, accountId, auroraIRSAUsername),
+			),
+		},
+		"engine_version":             sourceVersion.String(),
+		"auto_minor_version_upgrade": true,
+	}
+
+	suite.SugaredLogger.Infow("Creating Aurora cluster...", "engineVersion", sourceVersion.String())
+	tfDirAurora := suite.CopyModule("aurora")
+	terraformOptionsRDS := suite.TerraformOptions(tfDirAurora, "aurora", "aurora", varsConfigAurora)
+	defer suite.DeferCleanup(terraformOptionsRDS)
+
+	terraform.InitAndApplyAndIdempotent(suite.T(), terraformOptionsRDS)
+	auroraOutputs := utils.LoadOutputs[utils.AuroraOutputs](suite.T(), terraformOptionsRDS)
+	suite.Require().NotEmpty(auroraOutputs.Endpoint)
+
+	// the marker row is written once, then read with the IRSA user after each upgrade
+	configMapPostgres := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "aurora-config",
+			Namespace: auroraNamespace,
+		},
+		Data: map[string]string{
+			"aurora_endpoint":      auroraOutputs.Endpoint,
+			"aurora_username":      auroraUsername,
+			"aurora_username_irsa": auroraIRSAUsername,
+			"aurora_port":          "5432",
+			"aws_region":           suite.Region,
+			"aurora_db_name":       auroraDatabase,
+			"marker_action":        "write",
+			"marker_value":         fmt.Sprintf("%s-%d", suite.ClusterName, time.Now().Unix()),
+		},
+	}
+	secretPostgres := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "aurora-secret",
+			Namespace: auroraNamespace,
+		},
+		StringData: map[string]string{
+			"aurora_password": auroraPassword,
+		},
+	}
+	suite.assertAuroraCluster(ctx, rdsSvc, auroraClusterName, sourceVersion)
+	suite.runPostgresUpgradeClient(ctx, kubeClient, configMapPostgres, secretPostgres)
+	configMapPostgres.Data["marker_action"] = "read"
+
+	// our users upgrade the minor version with the engine_version of the module
+	suite.SugaredLogger.Infow("Upgrading the minor version of the Aurora cluster with terraform", "from", sourceVersion.String(), "to", minorVersion.String())
+	varsConfigAurora["engine_version"] = minorVersion.String()
+	terraformOptionsRDS = suite.TerraformOptions(tfDirAurora, "aurora", "aurora", varsConfigAurora)
+	terraform.InitAndApply(suite.T(), terraformOptionsRDS)
+	suite.assertAuroraCluster(ctx, rdsSvc, auroraClusterName, minorVersion)
+	suite.runPostgresUpgradeClient(ctx, kubeClient, configMapPostgres, secretPostgres)
+	currentVersion := minorVersion
+
+	// with auto_minor_version_upgrade, RDS upgrades the minor version during the maintenance window, the upgrade is applied
+	// immediately the same way, then our users report the new version in engine_version and terraform has nothing to change
+	autoTargets, err := version.AuroraPostgreSQLUpgradeTargets(ctx, rdsSvc, currentVersion)
+	suite.Require().NoError(err)
+	if autoVersion, ok := autoTargets.NextMinor(currentVersion); ok {
+		suite.SugaredLogger.Infow("Upgrading the minor version of the Aurora cluster as the maintenance window does", "from", currentVersion.String(), "to", autoVersion.String())
+		_, errUpgrade := utils.UpgradeAuroraCluster(ctx, rdsSvc, utils.AuroraUpgrade{
+			ClusterIdentifier: auroraClusterName,
+			EngineVersion:     autoVersion.String(),
+			Timeout:           60 * time.Minute,
+		})
+		suite.Require().NoError(errUpgrade)
+		suite.assertAuroraCluster(ctx, rdsSvc, auroraClusterName, autoVersion)
+		suite.runPostgresUpgradeClient(ctx, kubeClient, configMapPostgres, secretPostgres)
+
+		varsConfigAurora["engine_version"] = autoVersion.String()
+		terraformOptionsRDS = suite.TerraformOptions(tfDirAurora, "aurora", "aurora", varsConfigAurora)
+		suite.Assert().Equal(0, terraform.InitAndPlanWithExitCode(suite.T(), terraformOptionsRDS), "terraform should not change the cluster upgraded by RDS")
+		currentVersion = autoVersion
+	} else {
+		suite.SugaredLogger.Infow("No newer minor version to upgrade to automatically", "version", currentVersion.String(), "upgradeTargets", autoTargets.String())
+	}
+
+	// the major version upgrade must be allowed explicitly
+	majorVersion := suite.nextAuroraVersion(ctx, rdsSvc, currentVersion, true)
+	suite.SugaredLogger.Infow("Upgrading the major version of the Aurora cluster with terraform", "from", currentVersion.String(), "to", majorVersion.String())
+	varsConfigAurora["engine_version"] = majorVersion.String()
+	varsConfigAurora["allow_major_version_upgrade"] = true
+	terraformOptionsRDS = suite.TerraformOptions(tfDirAurora, "aurora", "aurora", varsConfigAurora)
+	terraform.InitAndApply(suite.T(), terraformOptionsRDS)
+	suite.assertAuroraCluster(ctx, rdsSvc, auroraClusterName, majorVersion)
+	suite.runPostgresUpgradeClient(ctx, kubeClient, configMapPostgres, secretPostgres)
+}
+
+// nextAuroraVersion returns the oldest minor or major upgrade target of the version
+func (suite *UpgradeAuroraTestSuite) nextAuroraVersion(ctx context.Context, rdsSvc *rds.Client, current version.Version, major bool) version.Version {
+	targets, err := version.AuroraPostgreSQLUpgradeTargets(ctx, rdsSvc, current)
+	suite.Require().NoError(err)
+
+	next, ok := targets.NextMinor(current)
+	if major {
+		next, ok = targets.NextMajor(current)
+	}
+	suite.Require().Truef(ok, "no upgrade target of Aurora PostgreSQL %s (major: %t), upgrade targets: %s", current, major, targets)
+	return next
+}
+
+// assertAuroraCluster waits until the cluster and its instances run the version and checks the IAM authentication
+// and the CA of the instances
+func (suite *UpgradeAuroraTestSuite) assertAuroraCluster(ctx context.Context, rdsSvc *rds.Client, clusterIdentifier string, engineVersion version.Version) {
+	cluster, err := utils.WaitForAuroraCluster(ctx, rdsSvc, clusterIdentifier, engineVersion.String(), 60*time.Minute)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(true, *cluster.IAMDatabaseAuthenticationEnabled)
+
+	instances, err := utils.DescribeAuroraInstances(ctx, rdsSvc, cluster)
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(instances)
+	for _, instance := range instances {
+		suite.Assert().Equal(engineVersion.String(), *instance.EngineVersion, *instance.DBInstanceIdentifier)
+		suite.Assert().Equal("rds-ca-rsa2048-g1", *instance.CertificateDetails.CAIdentifier, *instance.DBInstanceIdentifier)
+	}
+}
+
+// runPostgresUpgradeClient runs the postgres-upgrade-client Job: it writes the marker row (marker_action=write),
+// reads it with the IRSA user and verifies the certificate of the cluster against the RDS CAs of the region
+func (suite *UpgradeAuroraTestSuite) runPostgresUpgradeClient(ctx context.Context, kubeClient kubernetes.Interface, configMap *corev1.ConfigMap, secret *corev1.Secret) {
+	job, err := utils.LoadJobManifest("../../modules/fixtures/postgres-upgrade-client.yml")
+	suite.Require().NoError(err)
+	jobResult, errJob := utils.RunJob(ctx, kubeClient, utils.JobRun{
+		Namespace:  configMap.Namespace,
+		Job:        job,
+		ConfigMaps: []*corev1.ConfigMap{configMap},
+		Secrets:    []*corev1.Secret{secret},
+		Timeout:    5 * time.Minute,
+	})
+	suite.Require().NoError(errJob, jobResult.Summary())
+}
+
+func TestUpgradeAuroraTestSuite(t *testing.T) {
+	t.Parallel()
+	suite.Run(t, &UpgradeAuroraTestSuite{BaseSuite: utils.NewBaseSuite("cluster-rds-upgrade"), expectedNodes: 1, engineVersion: "15.4"})
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"slices"
+	"strings"
+	"time"
+)
+
+// auroraTerminalStatuses are the statuses of an RDS cluster or instance that will not become available without an intervention
+var auroraTerminalStatuses = []string{"failed", "inaccessible-encryption-credentials", "incompatible-network", "incompatible-parameters", "incompatible-restore", "storage-full"}
+
+// AuroraUpgrade describes the upgrade of the engine of an Aurora cluster
+type AuroraUpgrade struct {
+	ClusterIdentifier string
+	// EngineVersion is the target version, e.g. 15.5
+	EngineVersion string
+	// AllowMajorVersionUpgrade must be set to upgrade to a new major version
+	AllowMajorVersionUpgrade bool
+	Timeout                  time.Duration
+}
+
+// UpgradeAuroraCluster upgrades the engine of the cluster with ModifyDBCluster applied immediately, as the maintenance window
+// does for the automatic minor version upgrades, and waits until the cluster and its instances run the new version
+func UpgradeAuroraCluster(ctx context.Context, client *rds.Client, upgrade AuroraUpgrade) (*rdstypes.DBCluster, error) {
+	_, err := client.ModifyDBCluster(ctx, &rds.ModifyDBClusterInput{
+		DBClusterIdentifier:      aws.String(upgrade.ClusterIdentifier),
+		EngineVersion:            aws.String(upgrade.EngineVersion),
+		AllowMajorVersionUpgrade: aws.Bool(upgrade.AllowMajorVersionUpgrade),
+		ApplyImmediately:         aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade the Aurora cluster %s to %s: %w", upgrade.ClusterIdentifier, upgrade.EngineVersion, err)
+	}
+	fmt.Printf("Upgrade of the Aurora cluster %s to %s initiated\n", upgrade.ClusterIdentifier, upgrade.EngineVersion)
+
+	return WaitForAuroraCluster(ctx, client, upgrade.ClusterIdentifier, upgrade.EngineVersion, upgrade.Timeout)
+}
+
+// WaitForAuroraCluster waits until the cluster and its instances are available without pending change of the engine version,
+// and run engineVersion when it is set, e.g. once terraform has applied a new engine_version
+func WaitForAuroraCluster(ctx context.Context, client *rds.Client, clusterIdentifier, engineVersion string, timeout time.Duration) (*rdstypes.DBCluster, error) {
+	description := fmt.Sprintf("Aurora cluster %s", clusterIdentifier)
+	if engineVersion != "" {
+		description = fmt.Sprintf("upgrade of the Aurora cluster %s to %s", clusterIdentifier, engineVersion)
+	}
+
+	var cluster *rdstypes.DBCluster
+	err := WaitFor(ctx, DefaultWaitOptions(description, timeout), func(ctx context.Context) (bool, error) {
+		output, err := client.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{DBClusterIdentifier: aws.String(clusterIdentifier)})
+		if err != nil {
+			return false, err
+		}
+		if len(output.DBClusters) == 0 {
+			return false, fmt.Errorf("the %s does not exist", description)
+		}
+		cluster = &output.DBClusters[0]
+
+		status := aws.ToString(cluster.Status)
+		currentVersion := aws.ToString(cluster.EngineVersion)
+		WaitState(ctx, fmt.Sprintf("%s (%s)", status, currentVersion))
+		if slices.Contains(auroraTerminalStatuses, status) {
+			return false, &TerminalStateError{Description: description, State: status}
+		}
+		if status != "available" || (engineVersion != "" && currentVersion != engineVersion) ||
+			(cluster.PendingModifiedValues != nil && cluster.PendingModifiedValues.EngineVersion != nil) {
+			return false, nil
+		}
+
+		// the instances are upgraded with the cluster, they may still be rebooting
+		instances, err := DescribeAuroraInstances(ctx, client, cluster)
+		if err != nil {
+			return false, err
+		}
+		var pending []string
+		for _, instance := range instances {
+			instanceStatus := aws.ToString(instance.DBInstanceStatus)
+			if slices.Contains(auroraTerminalStatuses, instanceStatus) {
+				return false, &TerminalStateError{Description: description, State: instanceStatus, Reason: fmt.Sprintf("instance %s", aws.ToString(instance.DBInstanceIdentifier))}
+			}
+			if instanceStatus != "available" {
+				pending = append(pending, fmt.Sprintf("%s (%s)", aws.ToString(instance.DBInstanceIdentifier), instanceStatus))
+			}
+		}
+		if len(pending) > 0 {
+			WaitState(ctx, fmt.Sprintf("instances %s", strings.Join(pending, ", ")))
+			return false, nil
+		}
+		return true, nil
+	})
+	return cluster, err
+}
+
+// DescribeAuroraInstances returns the instances of the members of the cluster
+func DescribeAuroraInstances(ctx context.Context, client *rds.Client, cluster *rdstypes.DBCluster) ([]rdstypes.DBInstance, error) {
+	instances := make([]rdstypes.DBInstance, 0, len(cluster.DBClusterMembers))
+	for _, member := range cluster.DBClusterMembers {
+		output, err := client.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{DBInstanceIdentifier: member.DBInstanceIdentifier})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe the instance %s of the Aurora cluster %s: %w", aws.ToString(member.DBInstanceIdentifier), aws.ToString(cluster.DBClusterIdentifier), err)
+		}
+		instances = append(instances, output.DBInstances...)
+	}
+	return instances, nil
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/camunda/camunda-tf-eks-module/utils/awsfake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// newUpgradableAuroraCluster registers an Aurora cluster at 15.4 that can be upgraded to 15.5 and 16.1
+func newUpgradableAuroraCluster(server *awsfake.Server) {
+	server.AddDBCluster(awsfake.DBCluster{Identifier: "postgres-upgrade", Engine: "aurora-postgresql", EngineVersion: "15.4", Instances: []string{"postgres-upgrade-0", "postgres-upgrade-1"}})
+	server.AddEngineVersion(awsfake.EngineVersion{Engine: "aurora-postgresql", Version: "15.4", UpgradeTargets: []string{"15.5", "16.1"}})
+}
+
+func TestUpgradeAuroraCluster(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	newUpgradableAuroraCluster(server)
+	client := rds.NewFromConfig(sess)
+
+	cluster, err := UpgradeAuroraCluster(context.Background(), client, AuroraUpgrade{ClusterIdentifier: "postgres-upgrade", EngineVersion: "15.5", Timeout: time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, "15.5", aws.ToString(cluster.EngineVersion))
+	assert.Equal(t, "available", aws.ToString(cluster.Status))
+	// the cluster went through the upgrading status
+	assert.GreaterOrEqual(t, server.Calls("DescribeDBClusters"), 2)
+
+	instances, err := DescribeAuroraInstances(context.Background(), client, cluster)
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+	for _, instance := range instances {
+		assert.Equal(t, "15.5", aws.ToString(instance.EngineVersion))
+		assert.Equal(t, "rds-ca-rsa2048-g1", aws.ToString(instance.CertificateDetails.CAIdentifier))
+	}
+}
+
+func TestUpgradeAuroraClusterMajorVersion(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	newUpgradableAuroraCluster(server)
+	client := rds.NewFromConfig(sess)
+
+	_, err := UpgradeAuroraCluster(context.Background(), client, AuroraUpgrade{ClusterIdentifier: "postgres-upgrade", EngineVersion: "16.1", Timeout: time.Minute})
+	assert.ErrorContains(t, err, "The AllowMajorVersionUpgrade flag must be present when upgrading to a new major version")
+
+	_, err = UpgradeAuroraCluster(context.Background(), client, AuroraUpgrade{ClusterIdentifier: "postgres-upgrade", EngineVersion: "15.3", Timeout: time.Minute})
+	assert.ErrorContains(t, err, "Cannot find upgrade target from 15.4 with requested version 15.3")
+
+	_, err = UpgradeAuroraCluster(context.Background(), client, AuroraUpgrade{ClusterIdentifier: "postgres-upgrade", EngineVersion: "16.1", AllowMajorVersionUpgrade: true, Timeout: time.Minute})
+	require.NoError(t, err)
+	cluster, _ := server.DBCluster("postgres-upgrade")
+	assert.Equal(t, "16.1", cluster.EngineVersion)
+}
+
+func TestWaitForAuroraClusterFailedUpgrade(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	newUpgradableAuroraCluster(server)
+	server.ModifyScript = []string{"upgrading", "incompatible-parameters"}
+
+	_, err := UpgradeAuroraCluster(context.Background(), rds.NewFromConfig(sess), AuroraUpgrade{ClusterIdentifier: "postgres-upgrade", EngineVersion: "15.5", Timeout: time.Minute})
+
+	var terminalErr *TerminalStateError
+	require.ErrorAs(t, err, &terminalErr)
+	assert.Equal(t, "incompatible-parameters", terminalErr.State)
+	assert.ErrorContains(t, err, "upgrade of the Aurora cluster postgres-upgrade to 15.5")
+}
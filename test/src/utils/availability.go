@@ -0,0 +1,591 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/testing"
+	"io"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProbeInterval is the rate of the availability probes
+	DefaultProbeInterval = time.Second
+	// minProbeTimeout bounds the probes faster than the interval, it leaves the time to open a tunnel
+	minProbeTimeout = 5 * time.Second
+	// probeJobContainer is the name of the container of the in-cluster probe job
+	probeJobContainer = "probe"
+	// probeJobImage provides curl to the in-cluster probe job
+	probeJobImage = "curlimages/curl:8.11.1"
+	// probeJobReplicas is the number of pods of the in-cluster probe job
+	probeJobReplicas = 2
+)
+
+// ProbeFunc probes a service once, it returns an error when the service is not available
+type ProbeFunc func(ctx context.Context) error
+
+// HTTPProbe returns a probe that gets url, it fails on a transport error or a status code other than 2xx
+func HTTPProbe(client *http.Client, url string) ProbeFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		_, _ = io.Copy(io.Discard, response.Body)
+
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			return fmt.Errorf("GET %s returned %s", url, response.Status)
+		}
+		return nil
+	}
+}
+
+// ProbeResult is the result of one probe
+type ProbeResult struct {
+	Time    time.Time
+	Latency time.Duration
+	Err     error
+}
+
+// Outage is a window of consecutive failed or missing probes, it ends with the next successful probe or with the report
+type Outage struct {
+	Start     time.Time
+	End       time.Time
+	Failures  int
+	LastError error
+}
+
+// Duration returns the duration of the outage
+func (o Outage) Duration() time.Duration {
+	return o.End.Sub(o.Start)
+}
+
+// AvailabilitySLO is the availability expected from a service during an operation, the zero values are not checked
+type AvailabilitySLO struct {
+	// MaxDowntime is the longest outage allowed
+	MaxDowntime time.Duration
+	// MinSuccessRatio is the minimum ratio of successful probes, e.g. 0.99
+	MinSuccessRatio float64
+}
+
+// AvailabilityReport gathers the probes of a service during an operation
+type AvailabilityReport struct {
+	Target   string
+	Interval time.Duration
+	Start    time.Time
+	End      time.Time
+	Results  []ProbeResult
+}
+
+// Failures returns the number of failed probes
+func (r AvailabilityReport) Failures() int {
+	failures := 0
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failures++
+		}
+	}
+	return failures
+}
+
+// SuccessRatio returns the ratio of successful probes, 0 without probes
+func (r AvailabilityReport) SuccessRatio() float64 {
+	if len(r.Results) == 0 {
+		return 0
+	}
+	return float64(len(r.Results)-r.Failures()) / float64(len(r.Results))
+}
+
+// Outages returns the windows of consecutive failed probes in chronological order. The service is also considered
+// unavailable when no probe was recorded for more than twice the interval, e.g. while a probe pod is rescheduled:
+// the availability cannot be proven during such a gap, it is not silently ignored.
+func (r AvailabilityReport) Outages() []Outage {
+	var outages []Outage
+	var current *Outage
+	for i, result := range r.Results {
+		if i > 0 {
+			previous := r.Results[i-1]
+			if gap := r.missingProbes(previous.Time.Add(previous.Latency), result.Time); gap != nil && current == nil {
+				current = &Outage{Start: previous.Time, LastError: gap}
+			}
+		}
+
+		switch {
+		case result.Err != nil && current == nil:
+			current = &Outage{Start: result.Time, Failures: 1, LastError: result.Err}
+		case result.Err != nil:
+			current.Failures++
+			current.LastError = result.Err
+		case current != nil:
+			current.End = result.Time
+			outages = append(outages, *current)
+			current = nil
+		}
+	}
+	if last := len(r.Results) - 1; last >= 0 && current == nil {
+		if gap := r.missingProbes(r.Results[last].Time.Add(r.Results[last].Latency), r.End); gap != nil {
+			current = &Outage{Start: r.Results[last].Time, LastError: gap}
+		}
+	}
+	if current != nil {
+		current.End = r.End
+		outages = append(outages, *current)
+	}
+	return outages
+}
+
+// missingProbes returns an error if no probe was recorded between from and to for more than twice the interval
+func (r AvailabilityReport) missingProbes(from, to time.Time) error {
+	if r.Interval <= 0 || to.Sub(from) <= 2*r.Interval {
+		return nil
+	}
+	return fmt.Errorf("no probe recorded for %s", to.Sub(from).Round(time.Second))
+}
+
+// LongestOutage returns the longest outage, the zero Outage when the service was always available
+func (r AvailabilityReport) LongestOutage() Outage {
+	var longest Outage
+	for _, outage := range r.Outages() {
+		if outage.Duration() > longest.Duration() {
+			longest = outage
+		}
+	}
+	return longest
+}
+
+// Downtime returns the total duration of the outages
+func (r AvailabilityReport) Downtime() time.Duration {
+	var downtime time.Duration
+	for _, outage := range r.Outages() {
+		downtime += outage.Duration()
+	}
+	return downtime
+}
+
+// LatencyPercentile returns the latency of the successful probes at the percentile p (0 < p <= 100)
+func (r AvailabilityReport) LatencyPercentile(p float64) time.Duration {
+	var latencies []time.Duration
+	for _, result := range r.Results {
+		if result.Err == nil {
+			latencies = append(latencies, result.Latency)
+		}
+	}
+	if len(latencies) == 0 {
+		return 0
+	}
+	slices.Sort(latencies)
+	rank := int(math.Ceil(p/100*float64(len(latencies)))) - 1
+	return latencies[min(max(rank, 0), len(latencies)-1)]
+}
+
+// CheckSLO returns an error describing the objectives of slo that were not met
+func (r AvailabilityReport) CheckSLO(slo AvailabilitySLO) error {
+	var errs []error
+	if len(r.Results) == 0 {
+		errs = append(errs, fmt.Errorf("no probe of %s was recorded", r.Target))
+	}
+	if longest := r.LongestOutage(); slo.MaxDowntime > 0 && longest.Duration() > slo.MaxDowntime {
+		errs = append(errs, fmt.Errorf("%s was unavailable for %s from %s (%d failed probes, last error: %v), more than the %s allowed",
+			r.Target, longest.Duration().Round(time.Millisecond), longest.Start.Format(time.RFC3339), longest.Failures, longest.LastError, slo.MaxDowntime))
+	}
+	if ratio := r.SuccessRatio(); slo.MinSuccessRatio > 0 && ratio < slo.MinSuccessRatio {
+		errs = append(errs, fmt.Errorf("%.2f%% of the probes of %s succeeded, less than the %.2f%% expected", ratio*100, r.Target, slo.MinSuccessRatio*100))
+	}
+	return errors.Join(errs...)
+}
+
+// Summary returns a human-readable report of the availability, one line per outage
+func (r AvailabilityReport) Summary() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "availability of %s from %s to %s: %d probes, %.2f%% succeeded, latency p50 %s p99 %s, downtime %s\n",
+		r.Target, r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339), len(r.Results), r.SuccessRatio()*100,
+		r.LatencyPercentile(50).Round(time.Millisecond), r.LatencyPercentile(99).Round(time.Millisecond), r.Downtime().Round(time.Millisecond))
+	for _, outage := range r.Outages() {
+		fmt.Fprintf(&builder, "  outage from %s for %s: %d failed probes, last error: %v\n",
+			outage.Start.Format(time.RFC3339), outage.Duration().Round(time.Millisecond), outage.Failures, outage.LastError)
+	}
+	return builder.String()
+}
+
+// AvailabilityProber probes a service at a fixed rate in the background until it is stopped
+type AvailabilityProber struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	report AvailabilityReport
+}
+
+// StartAvailabilityProber probes target with probe every interval until Stop is called or ctx is done.
+// Each probe is bounded by the interval (at least 5 seconds), a probe slower than the interval delays the next one.
+func StartAvailabilityProber(ctx context.Context, target string, interval time.Duration, probe ProbeFunc) *AvailabilityProber {
+	ctx, cancel := context.WithCancel(ctx)
+	prober := &AvailabilityProber{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		report: AvailabilityReport{Target: target, Interval: interval, Start: time.Now()},
+	}
+	fmt.Printf("Probing the availability of %s every %s\n", target, interval)
+
+	go func() {
+		defer close(prober.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			prober.probe(ctx, max(interval, minProbeTimeout), probe)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return prober
+}
+
+func (p *AvailabilityProber) probe(ctx context.Context, timeout time.Duration, probe ProbeFunc) {
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := probe(probeCtx)
+	// a probe interrupted by Stop is not a failure of the service
+	if ctx.Err() != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil && (len(p.report.Results) == 0 || p.report.Results[len(p.report.Results)-1].Err == nil) {
+		fmt.Printf("%s is unavailable: %v\n", p.report.Target, err)
+	}
+	if err == nil && len(p.report.Results) > 0 && p.report.Results[len(p.report.Results)-1].Err != nil {
+		fmt.Printf("%s is available again\n", p.report.Target)
+	}
+	p.report.Results = append(p.report.Results, ProbeResult{Time: start, Latency: time.Since(start), Err: err})
+}
+
+// Report returns the probes recorded so far
+func (p *AvailabilityProber) Report() AvailabilityReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := p.report
+	report.Results = slices.Clone(p.report.Results)
+	if report.End.IsZero() {
+		report.End = time.Now()
+	}
+	return report
+}
+
+// Stop stops the probes and returns the report, it can be called several times
+func (p *AvailabilityProber) Stop() AvailabilityReport {
+	p.cancel()
+	<-p.done
+
+	p.mu.Lock()
+	if p.report.End.IsZero() {
+		p.report.End = time.Now()
+	}
+	p.mu.Unlock()
+	return p.Report()
+}
+
+// TunnelProbe probes an HTTP path of a kubernetes resource through a port-forward.
+// A port-forward is bound to a single pod: when a probe fails, the tunnel is opened again to another pod
+// of the resource and the probe is retried once, so that only an outage of the whole resource is reported.
+type TunnelProbe struct {
+	t            testing.TestingT
+	options      *k8s.KubectlOptions
+	resourceType k8s.KubeResourceType
+	name         string
+	port         int
+	path         string
+	client       *http.Client
+
+	mu     sync.Mutex
+	tunnel *k8s.Tunnel
+}
+
+// NewTunnelProbe returns a probe of path on the port of the resource, e.g. the port 80 of the service whoami-service
+func NewTunnelProbe(t testing.TestingT, options *k8s.KubectlOptions, resourceType k8s.KubeResourceType, name string, port int, path string) *TunnelProbe {
+	return &TunnelProbe{
+		t:            t,
+		options:      options,
+		resourceType: resourceType,
+		name:         name,
+		port:         port,
+		path:         path,
+		// the connections are not reused, a kept-alive connection would outlive the pod of the tunnel
+		client: &http.Client{Transport: &http.Transport{DisableKeepAlives: true}},
+	}
+}
+
+// Target returns the probed resource, e.g. service/whoami-service:80
+func (p *TunnelProbe) Target() string {
+	return fmt.Sprintf("%s/%s:%d", p.resourceType, p.name, p.port)
+}
+
+// Probe is the ProbeFunc of the tunnel
+func (p *TunnelProbe) Probe(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reused := p.tunnel != nil
+	err := p.get(ctx)
+	if err != nil && reused && ctx.Err() == nil {
+		// the pod of the tunnel may be gone while the resource is still available
+		err = p.get(ctx)
+	}
+	return err
+}
+
+func (p *TunnelProbe) get(ctx context.Context) error {
+	if p.tunnel == nil {
+		tunnel := k8s.NewTunnel(p.options, p.resourceType, p.name, 0, p.port)
+		if err := tunnel.ForwardPortE(p.t); err != nil {
+			tunnel.Close()
+			return fmt.Errorf("failed to open a tunnel to %s: %w", p.Target(), err)
+		}
+		p.tunnel = tunnel
+	}
+
+	err := HTTPProbe(p.client, fmt.Sprintf("http://%s%s", p.tunnel.Endpoint(), p.path))(ctx)
+	if err != nil {
+		p.closeTunnel()
+	}
+	return err
+}
+
+// Close closes the tunnel
+func (p *TunnelProbe) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closeTunnel()
+}
+
+func (p *TunnelProbe) closeTunnel() {
+	if p.tunnel != nil {
+		p.tunnel.Close()
+		p.tunnel = nil
+	}
+}
+
+// InClusterProbeJob returns a job that gets url with curl every interval (rounded up to the second) until it is deleted.
+// Each probe prints a line "probe <unix time> <curl exit code> <http code> <time_total in seconds>".
+// The job runs redundant pods preferably on different nodes, so that the drain of a node does not interrupt the probes;
+// the disruptions of its pods are not counted against the backoffLimit of the job.
+func InClusterProbeJob(name, url string, interval time.Duration) *batchv1.Job {
+	seconds := int(math.Ceil(interval.Seconds()))
+	script := fmt.Sprintf(`while true; do
+  result=$(curl --silent --output /dev/null --max-time %d --write-out '%%{http_code} %%{time_total}' %q)
+  status=$?
+  echo "probe $(date +%%s) $status $result"
+  sleep %d
+done`, max(seconds, 1), url, max(seconds, 1))
+
+	backoffLimit := int32(6)
+	parallelism := int32(probeJobReplicas)
+	// the shell ignores SIGTERM, the pod is killed right away
+	gracePeriod := int64(1)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"app": name}},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Parallelism:  &parallelism,
+			PodFailurePolicy: &batchv1.PodFailurePolicy{
+				Rules: []batchv1.PodFailurePolicyRule{{
+					Action:          batchv1.PodFailurePolicyActionIgnore,
+					OnPodConditions: []batchv1.PodFailurePolicyOnPodConditionsPattern{{Type: corev1.DisruptionTarget, Status: corev1.ConditionTrue}},
+				}},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+				Spec: corev1.PodSpec{
+					RestartPolicy:                 corev1.RestartPolicyNever,
+					TerminationGracePeriodSeconds: &gracePeriod,
+					Affinity: &corev1.Affinity{
+						PodAntiAffinity: &corev1.PodAntiAffinity{
+							PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+								Weight: 100,
+								PodAffinityTerm: corev1.PodAffinityTerm{
+									LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+									TopologyKey:   corev1.LabelHostname,
+								},
+							}},
+						},
+					},
+					Containers: []corev1.Container{{
+						Name:    probeJobContainer,
+						Image:   probeJobImage,
+						Command: []string{"/bin/sh", "-c", script},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// parseProbeLine parses a line printed by the job of InClusterProbeJob, ok is false for the other lines
+func parseProbeLine(line string) (result ProbeResult, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 5 || fields[0] != "probe" {
+		return ProbeResult{}, false
+	}
+	timestamp, errTime := strconv.ParseInt(fields[1], 10, 64)
+	exitCode, errExit := strconv.Atoi(fields[2])
+	latency, errLatency := strconv.ParseFloat(fields[4], 64)
+	if errTime != nil || errExit != nil || errLatency != nil {
+		return ProbeResult{}, false
+	}
+
+	result = ProbeResult{Time: time.Unix(timestamp, 0).UTC(), Latency: time.Duration(latency * float64(time.Second))}
+	switch {
+	case exitCode != 0:
+		result.Err = fmt.Errorf("curl exited with code %d", exitCode)
+	case !strings.HasPrefix(fields[3], "2"):
+		result.Err = fmt.Errorf("HTTP status %s", fields[3])
+	}
+	return result, true
+}
+
+// parseProbeLogs returns the probes of the logs of the pods of the job of InClusterProbeJob in chronological order
+func parseProbeLogs(logs ...string) []ProbeResult {
+	var results []ProbeResult
+	for _, podLogs := range logs {
+		for _, line := range strings.Split(podLogs, "\n") {
+			if result, ok := parseProbeLine(line); ok {
+				results = append(results, result)
+			}
+		}
+	}
+	slices.SortStableFunc(results, func(a, b ProbeResult) int {
+		return a.Time.Compare(b.Time)
+	})
+	return results
+}
+
+// AvailabilityJob probes a service from the cluster with the job of InClusterProbeJob
+type AvailabilityJob struct {
+	clientSet kubernetes.Interface
+	job       *batchv1.Job
+	target    string
+	interval  time.Duration
+	start     time.Time
+	streamer  *jobLogStreamer
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	mu   sync.Mutex
+	pods []string
+}
+
+// StartAvailabilityJob creates the probe job in the namespace and follows the logs of its pods until Stop is called.
+// Unlike a tunnel, the job probes the service as the other workloads of the cluster do. The probes are merged,
+// a time without probe from any pod counts as an outage of the report (see AvailabilityReport.Outages).
+func StartAvailabilityJob(ctx context.Context, clientSet kubernetes.Interface, namespace, url string, interval time.Duration) (*AvailabilityJob, error) {
+	job := InClusterProbeJob("availability-probe", url, interval)
+	job.Namespace = namespace
+	description := fmt.Sprintf("job %s/%s", namespace, job.Name)
+
+	if err := deletePreviousJobs(ctx, clientSet, job); err != nil {
+		return nil, err
+	}
+	created, err := clientSet.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the %s: %w", description, err)
+	}
+	fmt.Printf("Probing the availability of %s every %s from the %s\n", url, interval, description)
+
+	// the streams outlive the lookup of the pods, they reach the end of the logs once the job is deleted
+	streamer := newJobLogStreamer(ctx, clientSet, namespace, os.Stdout)
+	ctx, cancel := context.WithCancel(ctx)
+	availabilityJob := &AvailabilityJob{
+		clientSet: clientSet,
+		job:       created,
+		target:    url,
+		// the job probes every second at most
+		interval: max(interval.Round(time.Second), time.Second),
+		start:    time.Now(),
+		streamer: streamer,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go availabilityJob.followPods(ctx)
+	return availabilityJob, nil
+}
+
+// followPods follows the logs of the pods of the job, including the ones replacing the disrupted pods
+func (j *AvailabilityJob) followPods(ctx context.Context) {
+	defer close(j.done)
+
+	selector := jobPodSelector(j.job)
+	for {
+		pods, err := j.clientSet.CoreV1().Pods(j.job.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err == nil {
+			for i := range pods.Items {
+				pod := &pods.Items[i]
+				j.streamer.follow(pod)
+				j.mu.Lock()
+				if !slices.Contains(j.pods, pod.Name) {
+					j.pods = append(j.pods, pod.Name)
+				}
+				j.mu.Unlock()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Stop deletes the job and returns the report of the probes printed by its pods
+func (j *AvailabilityJob) Stop(ctx context.Context) (AvailabilityReport, error) {
+	report := AvailabilityReport{Target: j.target, Interval: j.interval, Start: j.start, End: time.Now()}
+
+	// the streams end with the pods
+	var errDelete error
+	background := metav1.DeletePropagationBackground
+	if err := j.clientSet.BatchV1().Jobs(j.job.Namespace).Delete(ctx, j.job.Name, metav1.DeleteOptions{PropagationPolicy: &background}); err != nil && !IsNotFound(err) {
+		errDelete = fmt.Errorf("failed to delete the job %s/%s: %w", j.job.Namespace, j.job.Name, err)
+	}
+	j.cancel()
+	<-j.done
+	j.streamer.stop(jobLogsGracePeriod)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var logs []string
+	for _, pod := range j.pods {
+		podLogs, _ := j.streamer.logs(pod, probeJobContainer)
+		logs = append(logs, podLogs)
+	}
+	report.Results = parseProbeLogs(logs...)
+	return report, errDelete
+}
@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAvailabilityReport(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+	unavailable := errors.New("connection refused")
+	report := AvailabilityReport{
+		Target:   "service/whoami-service:80",
+		Interval: time.Second,
+		Start:    start,
+		End:      at(10),
+		Results: []ProbeResult{
+			{Time: at(0), Latency: 10 * time.Millisecond},
+			{Time: at(1), Latency: 30 * time.Millisecond, Err: unavailable},
+			{Time: at(2), Latency: 20 * time.Millisecond, Err: unavailable},
+			{Time: at(4), Latency: 20 * time.Millisecond},
+			{Time: at(5), Latency: 40 * time.Millisecond},
+			{Time: at(7), Err: errors.New("GET returned 503 Service Unavailable")},
+		},
+	}
+
+	assert.Equal(t, 3, report.Failures())
+	assert.Equal(t, 0.5, report.SuccessRatio())
+	assert.Equal(t, []Outage{
+		{Start: at(1), End: at(4), Failures: 2, LastError: unavailable},
+		// the last outage ends with the report
+		{Start: at(7), End: at(10), Failures: 1, LastError: report.Results[5].Err},
+	}, report.Outages())
+	assert.Equal(t, 3*time.Second, report.LongestOutage().Duration())
+	assert.Equal(t, 6*time.Second, report.Downtime())
+	// only the latency of the successful probes is measured
+	assert.Equal(t, 20*time.Millisecond, report.LatencyPercentile(50))
+	assert.Equal(t, 40*time.Millisecond, report.LatencyPercentile(99))
+
+	assert.NoError(t, report.CheckSLO(AvailabilitySLO{MaxDowntime: 3 * time.Second}))
+	err := report.CheckSLO(AvailabilitySLO{MaxDowntime: 2 * time.Second, MinSuccessRatio: 0.9})
+	assert.ErrorContains(t, err, "service/whoami-service:80 was unavailable for 3s from 2025-01-01T00:00:01Z (2 failed probes, last error: connection refused), more than the 2s allowed")
+	assert.ErrorContains(t, err, "50.00% of the probes of service/whoami-service:80 succeeded, less than the 90.00% expected")
+
+	assert.Contains(t, report.Summary(), "6 probes, 50.00% succeeded, latency p50 20ms p99 40ms, downtime 6s")
+	assert.Contains(t, report.Summary(), "outage from 2025-01-01T00:00:01Z for 3s: 2 failed probes, last error: connection refused")
+
+	assert.ErrorContains(t, AvailabilityReport{Target: "whoami"}.CheckSLO(AvailabilitySLO{}), "no probe of whoami was recorded")
+}
+
+func TestAvailabilityReportOfProbeLogs(t *testing.T) {
+	start := time.Unix(1735689600, 0).UTC()
+	// both pods probe every second, the first one is evicted after 1735689605 while the second one is rescheduled
+	firstPod := `fake logs
+probe 1735689600 0 200 0.010
+probe 1735689601 0 200 0.010
+probe 1735689602 7 000 0.001
+probe 1735689603 7 000 0.001
+probe 1735689604 0 200 0.012
+probe 1735689605 0 200 0.011
+`
+	secondPod := `probe 1735689600 0 200 0.020
+probe 1735689601 0 200 0.020
+probe 1735689614 0 200 0.020
+probe 1735689615 0 503 0.020
+probe 1735689616 0 200 0.020
+probe 1735689617 0 200 0.020
+`
+	report := AvailabilityReport{Target: "whoami", Interval: time.Second, Start: start, End: start.Add(18 * time.Second), Results: parseProbeLogs(firstPod, secondPod)}
+
+	require.Len(t, report.Results, 12)
+	outages := report.Outages()
+	require.Len(t, outages, 3, report.Summary())
+	assert.Equal(t, Outage{Start: start.Add(2 * time.Second), End: start.Add(4 * time.Second), Failures: 2, LastError: outages[0].LastError}, outages[0])
+	// no pod probed the service between 1735689605 and 1735689614, the availability is unknown
+	assert.Equal(t, start.Add(5*time.Second), outages[1].Start)
+	assert.Equal(t, start.Add(14*time.Second), outages[1].End)
+	assert.Zero(t, outages[1].Failures)
+	assert.EqualError(t, outages[1].LastError, "no probe recorded for 9s")
+	assert.Equal(t, Outage{Start: start.Add(15 * time.Second), End: start.Add(16 * time.Second), Failures: 1, LastError: outages[2].LastError}, outages[2])
+	assert.Equal(t, 12*time.Second, report.Downtime())
+
+	err := report.CheckSLO(AvailabilitySLO{MaxDowntime: 5 * time.Second})
+	assert.ErrorContains(t, err, "whoami was unavailable for 9s from 2025-01-01T00:00:05Z (0 failed probes, last error: no probe recorded for 9s)")
+
+	// the probes stopping before the end of the report are an outage too
+	report.End = start.Add(30 * time.Second)
+	assert.Equal(t, 13*time.Second, report.LongestOutage().Duration())
+}
+
+func TestAvailabilityProber(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	prober := StartAvailabilityProber(context.Background(), "whoami", 10*time.Millisecond, HTTPProbe(nil, server.URL))
+	time.Sleep(100 * time.Millisecond)
+	failing.Store(true)
+	time.Sleep(200 * time.Millisecond)
+	failing.Store(false)
+	time.Sleep(100 * time.Millisecond)
+
+	report := prober.Stop()
+	require.NotEmpty(t, report.Results)
+	require.Len(t, report.Outages(), 1, report.Summary())
+
+	outage := report.LongestOutage()
+	assert.GreaterOrEqual(t, outage.Duration(), 150*time.Millisecond)
+	assert.ErrorContains(t, outage.LastError, "returned 503 Service Unavailable")
+	assert.Less(t, report.SuccessRatio(), 1.0)
+	assert.NoError(t, report.CheckSLO(AvailabilitySLO{MaxDowntime: 10 * time.Second}))
+	assert.Error(t, report.CheckSLO(AvailabilitySLO{MaxDowntime: 10 * time.Millisecond}))
+
+	// no probe is recorded once stopped
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, len(report.Results), len(prober.Stop().Results))
+}
+
+func TestParseProbeLine(t *testing.T) {
+	result, ok := parseProbeLine("probe 1735689600 0 200 0.012")
+	require.True(t, ok)
+	assert.Equal(t, ProbeResult{Time: time.Unix(1735689600, 0).UTC(), Latency: 12 * time.Millisecond}, result)
+
+	result, ok = parseProbeLine("probe 1735689601 0 503 0.002")
+	require.True(t, ok)
+	assert.EqualError(t, result.Err, "HTTP status 503")
+
+	result, ok = parseProbeLine("probe 1735689602 7 000 0.001")
+	require.True(t, ok)
+	assert.EqualError(t, result.Err, "curl exited with code 7")
+
+	for _, line := range []string{"", "fake logs", "probe 1735689602 7"} {
+		_, ok = parseProbeLine(line)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestAvailabilityJob(t *testing.T) {
+	clientSet := fake.NewClientset()
+	onJobCreation(t, clientSet, func(job *batchv1.Job) []*corev1.Pod {
+		assert.Equal(t, batchv1.PodFailurePolicyActionIgnore, job.Spec.PodFailurePolicy.Rules[0].Action)
+		// the redundant probe pods are spread across the nodes
+		assert.Equal(t, int32(2), *job.Spec.Parallelism)
+		assert.Equal(t, corev1.LabelHostname, job.Spec.Template.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].PodAffinityTerm.TopologyKey)
+		assert.Contains(t, job.Spec.Template.Spec.Containers[0].Command[2], `"http://whoami-service.example"`)
+		return []*corev1.Pod{newTestJobPod(job, "availability-probe-1", corev1.ContainerState{Running: &corev1.ContainerStateRunning{}})}
+	})
+
+	availabilityJob, err := StartAvailabilityJob(context.Background(), clientSet, "example", "http://whoami-service.example", time.Second)
+	require.NoError(t, err)
+
+	// the fake logs are not probes
+	report, err := availabilityJob.Stop(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "http://whoami-service.example", report.Target)
+	assert.Empty(t, report.Results)
+
+	_, err = clientSet.BatchV1().Jobs("example").Get(context.Background(), "availability-probe", metav1.GetOptions{})
+	assert.True(t, IsNotFound(err))
+}
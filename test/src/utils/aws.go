@@ -2,20 +2,22 @@ package utils
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
 	"github.com/aws/aws-sdk-go-v2/service/eks/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	types2 "github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"net/http"
+	"github.com/camunda/camunda-tf-eks-module/utils/iampolicy"
 	"strings"
 	"time"
 )
 
+// GetAwsProfile returns the AWS profile of the environment for the commands of cmd/,
+// the suites use the AwsProfile of their TestConfig
 func GetAwsProfile() string {
 	return GetEnv("AWS_PROFILE", GetEnv("AWS_DEFAULT_PROFILE", "infex"))
 }
@@ -29,47 +31,80 @@ func GetAwsClient() (aws.Config, error) {
 	return GetAwsClientF(GetAwsProfile(), GetAwsRegion())
 }
 
-// GetAwsClientF returns an aws.Config client
-func GetAwsClientF(profile, region string) (aws.Config, error) {
+// GetAwsClientF returns an aws.Config client, optFns are applied after the profile and the region
+func GetAwsClientF(profile, region string, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
 	return config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-		config.WithSharedConfigProfile(profile),
+		append([]func(*config.LoadOptions) error{
+			config.WithRegion(region),
+			config.WithSharedConfigProfile(profile),
+		}, optFns...)...,
 	)
 }
 
-func WaitForUpdateEKS(ctx context.Context, client *eks.Client, clusterName, updateID string) error {
+// WithAwsEndpoint is an option of GetAwsClientF that sends every request to endpoint with static credentials,
+// it is used to target a fake AWS server (see the awsfake package) without any AWS account or profile
+func WithAwsEndpoint(endpoint string) func(*config.LoadOptions) error {
+	return func(o *config.LoadOptions) error {
+		o.BaseEndpoint = endpoint
+		o.SharedConfigProfile = ""
+		o.SharedConfigFiles = []string{}
+		o.SharedCredentialsFiles = []string{}
+		o.Credentials = credentials.NewStaticCredentialsProvider("AKIDFAKE", "fake-secret", "")
+		return nil
+	}
+}
+
+// EKSUpdateTimeout is the maximum duration of an EKS update (control plane, add-on or node group)
+const EKSUpdateTimeout = 60 * time.Minute
+
+// WaitForUpdateEKS waits until the EKS update is successful, it fails with a TerminalStateError
+// if the update failed or has been cancelled and with a TimeoutError if it did not complete in time
+func WaitForUpdateEKS(ctx context.Context, client *eks.Client, clusterName, updateID string, timeout time.Duration) error {
 	describeUpdateInput := &eks.DescribeUpdateInput{
 		Name:     &clusterName,
 		UpdateId: &updateID,
 	}
 
-L:
-	for {
+	description := fmt.Sprintf("EKS update %s of cluster %s", updateID, clusterName)
+	return waitForUpdate(ctx, client, describeUpdateInput, description, timeout)
+}
+
+// waitForUpdate polls the update described by the input, the updates of the add-ons and the node groups
+// are only found when the input has their AddonName or NodegroupName
+func waitForUpdate(ctx context.Context, client *eks.Client, describeUpdateInput *eks.DescribeUpdateInput, description string, timeout time.Duration) error {
+	return WaitFor(ctx, DefaultWaitOptions(description, timeout), func(ctx context.Context) (bool, error) {
 		updateOutput, err := client.DescribeUpdate(ctx, describeUpdateInput)
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		status := updateOutput.Update.Status
 		fmt.Printf("Update status: %s\n", status)
+		WaitState(ctx, string(status))
 
 		switch status {
-		case types.UpdateStatusFailed:
-			return fmt.Errorf("update failed")
-		case types.UpdateStatusCancelled:
-			return fmt.Errorf("update cancelled")
 		case types.UpdateStatusSuccessful:
-			break L
+			return true, nil
 		case types.UpdateStatusInProgress:
-			time.Sleep(5 * time.Second)
+			return false, nil
+		case types.UpdateStatusFailed, types.UpdateStatusCancelled:
+			return false, &TerminalStateError{Description: description, State: string(status), Reason: updateErrorsReason(updateOutput.Update.Errors)}
 		default:
-			return fmt.Errorf("update status unknown: %s", status)
+			return false, fmt.Errorf("update status unknown: %s", status)
 		}
-	}
+	})
+}
 
-	return nil
+// updateErrorsReason flattens the errors reported by an EKS update
+func updateErrorsReason(updateErrors []types.ErrorDetail) string {
+	reasons := make([]string, 0, len(updateErrors))
+	for _, updateError := range updateErrors {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", updateError.ErrorCode, aws.ToString(updateError.ErrorMessage)))
+	}
+	return strings.Join(reasons, ", ")
 }
 
+// UpgradeEKS upgrades the control plane of the cluster only, see UpgradeEKSCluster for the add-ons and the node groups
 func UpgradeEKS(ctx context.Context, client *eks.Client, clusterName, version string) error {
 	input := &eks.UpdateClusterVersionInput{
 		Name:    &clusterName,
@@ -83,7 +118,7 @@ func UpgradeEKS(ctx context.Context, client *eks.Client, clusterName, version st
 
 	fmt.Printf("Update initiated, update ID: %s\n", *output.Update.Id)
 
-	err = WaitForUpdateEKS(ctx, client, clusterName, *output.Update.Id)
+	err = WaitForUpdateEKS(ctx, client, clusterName, *output.Update.Id, EKSUpdateTimeout)
 	if err != nil {
 		return err
 	}
@@ -105,8 +140,7 @@ func CreateS3BucketIfNotExists(sess aws.Config, s3Bucket string, description str
 		fmt.Printf("Bucket %s already exists\n", s3Bucket)
 		return nil
 	} else {
-		var responseError *awshttp.ResponseError
-		if errors.As(err, &responseError) && responseError.ResponseError.HTTPStatusCode() == http.StatusNotFound {
+		if IsNotFound(err) {
 			fmt.Printf("Bucket %s does not exist\n", s3Bucket)
 		} else {
 			return fmt.Errorf("failed to check if bucket exists: %v", err)
@@ -169,3 +203,37 @@ func ExtractOIDCProviderID(clusterResult *eks.DescribeClusterOutput) (string, er
 
 	return strings.ReplaceAll(*clusterResult.Cluster.Identity.Oidc.Issuer, "https://", ""), nil
 }
+
+// RoleAccessPolicy returns the statements of the default versions of the managed policies attached to the role
+// as a single document, e.g. the access policy of iam_roles_with_policies, to evaluate the permissions of the role
+func RoleAccessPolicy(ctx context.Context, client *iam.Client, roleName string) (iampolicy.Document, error) {
+	document := iampolicy.NewDocument()
+	paginator := iam.NewListAttachedRolePoliciesPaginator(client, &iam.ListAttachedRolePoliciesInput{RoleName: &roleName})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return iampolicy.Document{}, fmt.Errorf("failed to list the policies attached to the role %s: %w", roleName, err)
+		}
+
+		for _, attachedPolicy := range page.AttachedPolicies {
+			policy, err := client.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: attachedPolicy.PolicyArn})
+			if err != nil {
+				return iampolicy.Document{}, fmt.Errorf("failed to get the policy %s: %w", aws.ToString(attachedPolicy.PolicyArn), err)
+			}
+			policyVersion, err := client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+				PolicyArn: attachedPolicy.PolicyArn,
+				VersionId: policy.Policy.DefaultVersionId,
+			})
+			if err != nil {
+				return iampolicy.Document{}, fmt.Errorf("failed to get the version %s of the policy %s: %w", aws.ToString(policy.Policy.DefaultVersionId), aws.ToString(attachedPolicy.PolicyArn), err)
+			}
+
+			policyDocument, err := iampolicy.ParseEncoded(aws.ToString(policyVersion.PolicyVersion.Document))
+			if err != nil {
+				return iampolicy.Document{}, fmt.Errorf("policy %s: %w", aws.ToString(attachedPolicy.PolicyArn), err)
+			}
+			document.Statement = append(document.Statement, policyDocument.Statement...)
+		}
+	}
+	return document, nil
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/camunda/camunda-tf-eks-module/utils/awsfake"
+	"github.com/camunda/camunda-tf-eks-module/utils/iampolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newFakeAwsConfig(t *testing.T) (*awsfake.Server, aws.Config) {
+	server := awsfake.NewServer()
+	t.Cleanup(server.Close)
+
+	sess, err := GetAwsClientF("infex", "eu-central-1", WithAwsEndpoint(server.URL))
+	require.NoError(t, err)
+	return server, sess
+}
+
+func TestUpgradeEKS(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	server.AddCluster(awsfake.Cluster{Name: "cluster-test", Version: "1.29"})
+	server.UpdateScript = []string{awsfake.UpdateInProgress, awsfake.UpdateInProgress, awsfake.UpdateSuccessful}
+
+	err := UpgradeEKS(context.Background(), eks.NewFromConfig(sess), "cluster-test", "1.30")
+	require.NoError(t, err)
+
+	cluster, _ := server.Cluster("cluster-test")
+	assert.Equal(t, "1.30", cluster.Version)
+	// the update is created InProgress, each DescribeUpdate moves it to the next status
+	assert.Equal(t, 2, server.Calls("DescribeUpdate"))
+}
+
+func TestUpgradeEKSFailedUpdate(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	server.AddCluster(awsfake.Cluster{Name: "cluster-test", Version: "1.29"})
+	server.UpdateScript = []string{awsfake.UpdateInProgress, awsfake.UpdateFailed}
+
+	err := UpgradeEKS(context.Background(), eks.NewFromConfig(sess), "cluster-test", "1.30")
+
+	var terminalErr *TerminalStateError
+	require.ErrorAs(t, err, &terminalErr)
+	assert.Equal(t, "Failed", terminalErr.State)
+	assert.Contains(t, terminalErr.Reason, "scripted failure")
+
+	cluster, _ := server.Cluster("cluster-test")
+	assert.Equal(t, "1.29", cluster.Version)
+}
+
+func TestUpgradeEKSRetriesThrottling(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	server.AddCluster(awsfake.Cluster{Name: "cluster-test", Version: "1.29"})
+	server.InjectFault("DescribeUpdate", awsfake.Throttling(1))
+
+	err := UpgradeEKS(context.Background(), eks.NewFromConfig(sess), "cluster-test", "1.30")
+	require.NoError(t, err)
+	// the throttled request is retried by the SDK
+	assert.Equal(t, 2, server.Calls("DescribeUpdate"))
+}
+
+func TestUpgradeEKSUnknownCluster(t *testing.T) {
+	_, sess := newFakeAwsConfig(t)
+
+	err := UpgradeEKS(context.Background(), eks.NewFromConfig(sess), "cluster-missing", "1.30")
+	assert.ErrorContains(t, err, "ResourceNotFoundException")
+}
+
+func TestCreateS3BucketIfNotExistsCreatesBucket(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+
+	err := CreateS3BucketIfNotExists(sess, "tests-eks-tf-state", TF_BUCKET_DESCRIPTION, "eu-central-1")
+	require.NoError(t, err)
+
+	bucket, found := server.Bucket("tests-eks-tf-state")
+	require.True(t, found)
+	assert.Equal(t, "eu-central-1", bucket.Region)
+	assert.Equal(t, TF_BUCKET_DESCRIPTION, bucket.Tags["Description"])
+}
+
+func TestCreateS3BucketIfNotExistsKeepsExistingBucket(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddBucket(awsfake.Bucket{Name: "tests-eks-tf-state", Region: "eu-west-1"})
+
+	err := CreateS3BucketIfNotExists(sess, "tests-eks-tf-state", TF_BUCKET_DESCRIPTION, "eu-central-1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, server.Calls("CreateBucket"))
+}
+
+func TestCreateS3BucketIfNotExistsAccessDenied(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.InjectFault("HeadBucket", awsfake.AccessDenied())
+
+	err := CreateS3BucketIfNotExists(sess, "tests-eks-tf-state", TF_BUCKET_DESCRIPTION, "eu-central-1")
+	assert.ErrorContains(t, err, "failed to check if bucket exists")
+	assert.Equal(t, 0, server.Calls("CreateBucket"))
+}
+
+func TestDeleteObjectFromS3Bucket(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddBucket(awsfake.Bucket{Name: "tests-eks-tf-state", Objects: map[string][]byte{
+		"terraform/cluster-test/TestDefaultEKSTestSuite/eks-cluster/terraform.tfstate": []byte("{}"),
+	}})
+
+	err := DeleteObjectFromS3Bucket(sess, "tests-eks-tf-state", "terraform/cluster-test/TestDefaultEKSTestSuite/eks-cluster/terraform.tfstate")
+	require.NoError(t, err)
+
+	bucket, _ := server.Bucket("tests-eks-tf-state")
+	assert.Empty(t, bucket.Objects)
+}
+
+func TestDeleteObjectFromS3BucketMissingBucket(t *testing.T) {
+	_, sess := newFakeAwsConfig(t)
+
+	err := DeleteObjectFromS3Bucket(sess, "missing-bucket", "terraform.tfstate")
+	assert.ErrorContains(t, err, "NoSuchBucket")
+}
+
+func TestRoleAccessPolicy(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddRole(awsfake.Role{Name: "AuroraRole-cluster-test", AttachedPolicies: map[string]string{
+		"AuroraRole-cluster-test-access-policy": iampolicy.RDSConnectPolicy("eu-central-1", server.AccountID, "myirsauser").String(),
+		"OpenSearchRole-access-policy":          iampolicy.OpenSearchHTTPPolicy("eu-central-1", server.AccountID, "os-test").String(),
+	}})
+
+	policy, err := RoleAccessPolicy(context.Background(), iam.NewFromConfig(sess), "AuroraRole-cluster-test")
+	require.NoError(t, err)
+	require.Len(t, policy.Statement, 2)
+	assert.True(t, policy.Allows(iampolicy.Request{Action: "rds-db:connect", Resource: iampolicy.RDSDBUserARN("eu-central-1", server.AccountID, "myirsauser")}))
+	assert.False(t, policy.Allows(iampolicy.Request{Action: "rds-db:connect", Resource: iampolicy.RDSDBUserARN("eu-central-1", server.AccountID, "admin")}))
+	assert.True(t, policy.Allows(iampolicy.Request{Action: "es:ESHttpGet", Resource: fmt.Sprintf("arn:aws:es:eu-central-1:%s:domain/os-test/_cluster/health", server.AccountID)}))
+	assert.Equal(t, 2, server.Calls("GetPolicyVersion"))
+
+	_, err = RoleAccessPolicy(context.Background(), iam.NewFromConfig(sess), "missing-role")
+	assert.ErrorContains(t, err, "failed to list the policies attached to the role missing-role")
+}
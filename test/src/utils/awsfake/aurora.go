@@ -0,0 +1,141 @@
+package awsfake
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// auroraCAIdentifier is the CA of the instances of the fake RDS clusters
+const auroraCAIdentifier = "rds-ca-rsa2048-g1"
+
+// advance moves the cluster to the next status of its modification, the pending engine version is applied once available
+func (c *DBCluster) advance() {
+	if len(c.modifyScript) == 0 {
+		return
+	}
+	c.Status, c.modifyScript = c.modifyScript[0], c.modifyScript[1:]
+	if c.Status == "available" {
+		c.EngineVersion, c.pendingEngineVersion, c.modifyScript = c.pendingEngineVersion, "", nil
+	}
+}
+
+// describeDBInstances returns the instance of the DBInstanceIdentifier filter, its status follows the one of its cluster
+func (s *Server) describeDBInstances(w http.ResponseWriter, r *http.Request, body []byte) {
+	form, _ := url.ParseQuery(string(body))
+	identifier := form.Get("DBInstanceIdentifier")
+
+	type dbInstance struct {
+		Identifier              string `xml:"DBInstanceIdentifier"`
+		ClusterIdentifier       string `xml:"DBClusterIdentifier"`
+		Engine                  string `xml:"Engine"`
+		EngineVersion           string `xml:"EngineVersion"`
+		Status                  string `xml:"DBInstanceStatus"`
+		CACertificateIdentifier string `xml:"CACertificateIdentifier"`
+		CAIdentifier            string `xml:"CertificateDetails>CAIdentifier"`
+	}
+	var instances []dbInstance
+	for _, cluster := range s.dbClusters {
+		if !slices.Contains(cluster.Instances, identifier) {
+			continue
+		}
+		instances = append(instances, dbInstance{
+			Identifier:              identifier,
+			ClusterIdentifier:       cluster.Identifier,
+			Engine:                  cluster.Engine,
+			EngineVersion:           cluster.EngineVersion,
+			Status:                  cluster.Status,
+			CACertificateIdentifier: auroraCAIdentifier,
+			CAIdentifier:            auroraCAIdentifier,
+		})
+	}
+	if len(instances) == 0 {
+		writeFault(w, r, awsQuery, NotFound("DBInstanceNotFound"))
+		return
+	}
+
+	writeXML(w, struct {
+		XMLName   xml.Name     `xml:"http://rds.amazonaws.com/doc/2014-10-31/ DescribeDBInstancesResponse"`
+		Instances []dbInstance `xml:"DescribeDBInstancesResult>DBInstances>DBInstance"`
+		RequestID string       `xml:"ResponseMetadata>RequestId"`
+	}{Instances: instances, RequestID: "awsfake"})
+}
+
+// modifyDBCluster starts the upgrade of the engine of an available cluster (see ModifyScript), the other modifications
+// are ignored. As with RDS, the version must be an upgrade target of the current one and a new major version
+// requires AllowMajorVersionUpgrade.
+func (s *Server) modifyDBCluster(w http.ResponseWriter, r *http.Request, body []byte) {
+	form, _ := url.ParseQuery(string(body))
+	cluster, ok := s.dbClusters[form.Get("DBClusterIdentifier")]
+	if !ok {
+		writeFault(w, r, awsQuery, NotFound("DBClusterNotFoundFault"))
+		return
+	}
+	if cluster.Status != "available" {
+		writeFault(w, r, awsQuery, Fault{StatusCode: http.StatusBadRequest, Code: "InvalidDBClusterStateFault", Message: fmt.Sprintf("DB cluster %s is not in available state (%s)", cluster.Identifier, cluster.Status)})
+		return
+	}
+
+	target := form.Get("EngineVersion")
+	if target != "" && target != cluster.EngineVersion {
+		if !s.isUpgradeTarget(cluster.Engine, cluster.EngineVersion, target) {
+			writeFault(w, r, awsQuery, Fault{StatusCode: http.StatusBadRequest, Code: "InvalidParameterCombination", Message: fmt.Sprintf("Cannot find upgrade target from %s with requested version %s.", cluster.EngineVersion, target)})
+			return
+		}
+		if majorVersion(target) != majorVersion(cluster.EngineVersion) && form.Get("AllowMajorVersionUpgrade") != "true" {
+			writeFault(w, r, awsQuery, Fault{StatusCode: http.StatusBadRequest, Code: "InvalidParameterCombination", Message: "The AllowMajorVersionUpgrade flag must be present when upgrading to a new major version."})
+			return
+		}
+		cluster.Status = "modifying"
+		cluster.pendingEngineVersion = target
+		cluster.modifyScript = slices.Clone(s.ModifyScript)
+	}
+
+	type dbCluster struct {
+		Identifier           string `xml:"DBClusterIdentifier"`
+		EngineVersion        string `xml:"EngineVersion"`
+		Status               string `xml:"Status"`
+		PendingEngineVersion string `xml:"PendingModifiedValues>EngineVersion,omitempty"`
+	}
+	writeXML(w, struct {
+		XMLName   xml.Name  `xml:"http://rds.amazonaws.com/doc/2014-10-31/ ModifyDBClusterResponse"`
+		Cluster   dbCluster `xml:"ModifyDBClusterResult>DBCluster"`
+		RequestID string    `xml:"ResponseMetadata>RequestId"`
+	}{Cluster: dbCluster{Identifier: cluster.Identifier, EngineVersion: cluster.EngineVersion, Status: cluster.Status, PendingEngineVersion: cluster.pendingEngineVersion}, RequestID: "awsfake"})
+}
+
+// isUpgradeTarget returns true if target is newer than version and, when they are registered (see AddEngineVersion),
+// target is an upgrade target of version
+func (s *Server) isUpgradeTarget(engine, version, target string) bool {
+	if compareEngineVersions(target, version) <= 0 {
+		return false
+	}
+	for _, engineVersion := range s.engineVersions {
+		if engineVersion.Engine == engine && engineVersion.Version == version && len(engineVersion.UpgradeTargets) > 0 {
+			return slices.Contains(engineVersion.UpgradeTargets, target)
+		}
+	}
+	return true
+}
+
+// compareEngineVersions compares the numeric parts of two versions such as 15.4 and 16.1
+func compareEngineVersions(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < min(len(partsA), len(partsB)); i++ {
+		numberA, _ := strconv.Atoi(partsA[i])
+		numberB, _ := strconv.Atoi(partsB[i])
+		if numberA != numberB {
+			return numberA - numberB
+		}
+	}
+	return len(partsA) - len(partsB)
+}
+
+func majorVersion(version string) string {
+	major, _, _ := strings.Cut(version, ".")
+	return major
+}
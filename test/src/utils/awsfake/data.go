@@ -0,0 +1,256 @@
+package awsfake
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ec2Operations are the EC2 operations of the fake, the other query operations are STS ones
+var ec2Operations = map[string]struct{}{
+	"DescribeVpcs":             {},
+	"DescribeAddresses":        {},
+	"DescribeSubnets":          {},
+	"DescribeRouteTables":      {},
+	"DescribeInternetGateways": {},
+	"DescribeNatGateways":      {},
+}
+
+// Vpc is the state of a fake EC2 VPC
+type Vpc struct {
+	ID        string
+	CidrBlock string
+	Tags      map[string]string
+	// Subnets are the identifiers of the subnets of the VPC
+	Subnets []string
+}
+
+// AddonVersion is a version of an EKS add-on returned by DescribeAddonVersions
+type AddonVersion struct {
+	Addon           string
+	Version         string
+	ClusterVersions []string
+	Default         bool
+}
+
+// AddVpc registers a VPC
+func (s *Server) AddVpc(vpc Vpc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if vpc.Tags == nil {
+		vpc.Tags = make(map[string]string)
+	}
+	vpc.Subnets = slices.Clone(vpc.Subnets)
+	s.vpcs[vpc.ID] = &vpc
+}
+
+// AddAddonVersion registers a version of an add-on, when an add-on has no registered version
+// DescribeAddonVersions returns v0.0.1-eksbuild.1 compatible with the requested kubernetes version
+func (s *Server) AddAddonVersion(version AddonVersion) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addonVersions[version.Addon] = append(s.addonVersions[version.Addon], version)
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) getCallerIdentity(w http.ResponseWriter) {
+	type result struct {
+		Arn     string `xml:"Arn"`
+		UserID  string `xml:"UserId"`
+		Account string `xml:"Account"`
+	}
+	writeXML(w, struct {
+		XMLName   xml.Name `xml:"https://sts.amazonaws.com/doc/2011-06-15/ GetCallerIdentityResponse"`
+		Result    result   `xml:"GetCallerIdentityResult"`
+		RequestID string   `xml:"ResponseMetadata>RequestId"`
+	}{
+		Result: result{
+			Arn:     fmt.Sprintf("arn:aws:iam::%s:user/awsfake", s.AccountID),
+			UserID:  "AIDAAWSFAKE",
+			Account: s.AccountID,
+		},
+		RequestID: "awsfake",
+	})
+}
+
+// ec2Filters returns the values of the filters of an EC2 query request (Filter.N.Name, Filter.N.Value.M)
+func ec2Filters(form url.Values) map[string][]string {
+	filters := make(map[string][]string)
+	for i := 1; form.Has(fmt.Sprintf("Filter.%d.Name", i)); i++ {
+		name := form.Get(fmt.Sprintf("Filter.%d.Name", i))
+		for j := 1; form.Has(fmt.Sprintf("Filter.%d.Value.%d", i, j)); j++ {
+			filters[name] = append(filters[name], form.Get(fmt.Sprintf("Filter.%d.Value.%d", i, j)))
+		}
+	}
+	return filters
+}
+
+// describeVpcs lists the VPCs, only the tag:<key> filters are supported
+func (s *Server) describeVpcs(w http.ResponseWriter, body []byte) {
+	form, _ := url.ParseQuery(string(body))
+	filters := ec2Filters(form)
+
+	type tag struct {
+		Key   string `xml:"key"`
+		Value string `xml:"value"`
+	}
+	type vpcItem struct {
+		VpcID     string `xml:"vpcId"`
+		CidrBlock string `xml:"cidrBlock"`
+		State     string `xml:"state"`
+		Tags      []tag  `xml:"tagSet>item"`
+	}
+
+	var items []vpcItem
+	for _, vpc := range s.vpcs {
+		matches := true
+		for name, values := range filters {
+			if key, ok := strings.CutPrefix(name, "tag:"); ok {
+				value, exists := vpc.Tags[key]
+				matches = matches && exists && slices.Contains(values, value)
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		item := vpcItem{VpcID: vpc.ID, CidrBlock: vpc.CidrBlock, State: "available"}
+		for key, value := range vpc.Tags {
+			item.Tags = append(item.Tags, tag{Key: key, Value: value})
+		}
+		items = append(items, item)
+	}
+	slices.SortFunc(items, func(a, b vpcItem) int { return strings.Compare(a.VpcID, b.VpcID) })
+
+	writeXML(w, struct {
+		XMLName   xml.Name  `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeVpcsResponse"`
+		RequestID string    `xml:"requestId"`
+		Vpcs      []vpcItem `xml:"vpcSet>item"`
+	}{RequestID: "awsfake", Vpcs: items})
+}
+
+// describeSubnets lists the subnets of the VPCs, only the vpc-id filter is supported
+func (s *Server) describeSubnets(w http.ResponseWriter, body []byte) {
+	form, _ := url.ParseQuery(string(body))
+	filters := ec2Filters(form)
+
+	type subnetItem struct {
+		SubnetID string `xml:"subnetId"`
+		VpcID    string `xml:"vpcId"`
+		State    string `xml:"state"`
+	}
+
+	var items []subnetItem
+	for _, vpc := range s.vpcs {
+		if vpcIDs, ok := filters["vpc-id"]; ok && !slices.Contains(vpcIDs, vpc.ID) {
+			continue
+		}
+		for _, subnet := range vpc.Subnets {
+			items = append(items, subnetItem{SubnetID: subnet, VpcID: vpc.ID, State: "available"})
+		}
+	}
+	slices.SortFunc(items, func(a, b subnetItem) int { return strings.Compare(a.SubnetID, b.SubnetID) })
+
+	writeXML(w, struct {
+		XMLName   xml.Name     `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeSubnetsResponse"`
+		RequestID string       `xml:"requestId"`
+		Subnets   []subnetItem `xml:"subnetSet>item"`
+	}{RequestID: "awsfake", Subnets: items})
+}
+
+// describeEmptySet returns no resource for the EC2 describe operation whose results are in the set element,
+// e.g. DescribeRouteTables and routeTableSet
+func describeEmptySet(w http.ResponseWriter, operation, set string) {
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = w.Write([]byte(xml.Header))
+	fmt.Fprintf(w, `<%sResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>awsfake</requestId><%s/></%sResponse>`, operation, set, operation)
+}
+
+// describeAddresses returns no elastic IP
+func (s *Server) describeAddresses(w http.ResponseWriter) {
+	writeXML(w, struct {
+		XMLName   xml.Name `xml:"http://ec2.amazonaws.com/doc/2016-11-15/ DescribeAddressesResponse"`
+		RequestID string   `xml:"requestId"`
+		Addresses string   `xml:"addressesSet"`
+	}{RequestID: "awsfake"})
+}
+
+// getServiceQuota returns ElasticIPQuota for every quota
+func (s *Server) getServiceQuota(w http.ResponseWriter, r *http.Request, body []byte) {
+	var input struct {
+		ServiceCode string `json:"ServiceCode"`
+		QuotaCode   string `json:"QuotaCode"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		writeFault(w, r, awsJSON, Fault{StatusCode: http.StatusBadRequest, Code: "IllegalArgumentException", Message: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"Quota": map[string]interface{}{
+			"ServiceCode": input.ServiceCode,
+			"QuotaCode":   input.QuotaCode,
+			"QuotaArn":    fmt.Sprintf("arn:aws:servicequotas:eu-central-1:%s:%s/%s", s.AccountID, input.ServiceCode, input.QuotaCode),
+			"QuotaName":   input.QuotaCode,
+			"Value":       s.ElasticIPQuota,
+			"Unit":        "None",
+			"Adjustable":  true,
+			"GlobalQuota": false,
+		},
+	})
+}
+
+// describeAddonVersions returns the versions of the add-on compatible with the requested kubernetes version
+func (s *Server) describeAddonVersions(w http.ResponseWriter, r *http.Request) {
+	addonName := r.URL.Query().Get("addonName")
+	kubernetesVersion := r.URL.Query().Get("kubernetesVersion")
+
+	versions, ok := s.addonVersions[addonName]
+	if !ok && addonName != "" {
+		versions = []AddonVersion{{Addon: addonName, Version: "v0.0.1-eksbuild.1", ClusterVersions: []string{kubernetesVersion}, Default: true}}
+	}
+
+	var addonVersions []map[string]interface{}
+	for _, version := range versions {
+		if kubernetesVersion != "" && !slices.Contains(version.ClusterVersions, kubernetesVersion) {
+			continue
+		}
+
+		var compatibilities []map[string]interface{}
+		for _, clusterVersion := range version.ClusterVersions {
+			compatibilities = append(compatibilities, map[string]interface{}{
+				"clusterVersion":   clusterVersion,
+				"defaultVersion":   version.Default,
+				"platformVersions": []string{"*"},
+			})
+		}
+		addonVersions = append(addonVersions, map[string]interface{}{
+			"addonVersion":           version.Version,
+			"architecture":           []string{"amd64", "arm64"},
+			"compatibilities":        compatibilities,
+			"requiresIamPermissions": false,
+		})
+	}
+
+	var addons []map[string]interface{}
+	if len(addonVersions) > 0 {
+		addons = append(addons, map[string]interface{}{
+			"addonName":     addonName,
+			"type":          "networking",
+			"addonVersions": addonVersions,
+		})
+	}
+	writeJSON(w, map[string]interface{}{"addons": addons})
+}
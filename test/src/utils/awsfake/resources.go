@@ -0,0 +1,390 @@
+package awsfake
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DBCluster is the state of a fake RDS cluster
+type DBCluster struct {
+	Identifier    string
+	Engine        string
+	EngineVersion string
+	Status        string
+	// Instances are the identifiers of the members of the cluster, they run the engine version of the cluster
+	// with the rds-ca-rsa2048-g1 CA
+	Instances []string
+
+	// pendingEngineVersion is the version requested by ModifyDBCluster, applied at the end of modifyScript
+	pendingEngineVersion string
+	modifyScript         []string
+}
+
+// Domain is the state of a fake OpenSearch domain
+type Domain struct {
+	Name          string
+	EngineVersion string
+}
+
+// Role is the state of a fake IAM role
+type Role struct {
+	Name string
+	Path string
+	// AttachedPolicies maps the names of the managed policies attached to the role to their JSON document,
+	// each policy has a single version v1
+	AttachedPolicies map[string]string
+}
+
+// KMSKey is the state of a fake KMS key
+type KMSKey struct {
+	ID          string
+	Description string
+	// State is the KeyState of the key, Enabled by default
+	State   string
+	Aliases []string
+	Tags    map[string]string
+}
+
+// AddDBCluster registers an RDS cluster
+func (s *Server) AddDBCluster(cluster DBCluster) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cluster.Status == "" {
+		cluster.Status = "available"
+	}
+	cluster.Instances = slices.Clone(cluster.Instances)
+	s.dbClusters[cluster.Identifier] = &cluster
+}
+
+// DBCluster returns a copy of the state of the RDS cluster
+func (s *Server) DBCluster(identifier string) (DBCluster, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cluster, ok := s.dbClusters[identifier]
+	if !ok {
+		return DBCluster{}, false
+	}
+	result := *cluster
+	result.Instances = slices.Clone(cluster.Instances)
+	result.modifyScript = slices.Clone(cluster.modifyScript)
+	return result, true
+}
+
+// AddDomain registers an OpenSearch domain
+func (s *Server) AddDomain(domain Domain) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.domains[domain.Name] = &domain
+}
+
+// AddRole registers an IAM role
+func (s *Server) AddRole(role Role) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if role.Path == "" {
+		role.Path = "/"
+	}
+	role.AttachedPolicies = maps.Clone(role.AttachedPolicies)
+	s.roles[role.Name] = &role
+}
+
+// AddKMSKey registers a KMS key
+func (s *Server) AddKMSKey(key KMSKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key.State == "" {
+		key.State = "Enabled"
+	}
+	s.kmsKeys[key.ID] = &key
+}
+
+func (s *Server) listClusters(w http.ResponseWriter) {
+	names := make([]string, 0, len(s.clusters))
+	for name := range s.clusters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	writeJSON(w, map[string]interface{}{"clusters": names})
+}
+
+func (s *Server) listNodegroups(w http.ResponseWriter, r *http.Request, name string) {
+	cluster, ok := s.clusters[name]
+	if !ok {
+		writeFault(w, r, restJSON, NotFound("ResourceNotFoundException"))
+		return
+	}
+	writeJSON(w, map[string]interface{}{"nodegroups": cluster.Nodegroups})
+}
+
+// describeDBClusters returns the clusters, or the one of the DBClusterIdentifier filter, and moves
+// the modified clusters to the next status of their script
+func (s *Server) describeDBClusters(w http.ResponseWriter, r *http.Request, body []byte) {
+	form, _ := url.ParseQuery(string(body))
+
+	type dbClusterMember struct {
+		Identifier string `xml:"DBInstanceIdentifier"`
+		Writer     bool   `xml:"IsClusterWriter"`
+	}
+	type dbCluster struct {
+		Identifier           string            `xml:"DBClusterIdentifier"`
+		Arn                  string            `xml:"DBClusterArn"`
+		Engine               string            `xml:"Engine"`
+		EngineVersion        string            `xml:"EngineVersion"`
+		Status               string            `xml:"Status"`
+		Members              []dbClusterMember `xml:"DBClusterMembers>DBClusterMember"`
+		PendingEngineVersion string            `xml:"PendingModifiedValues>EngineVersion,omitempty"`
+	}
+
+	var clusters []dbCluster
+	for _, cluster := range s.dbClusters {
+		if form.Has("DBClusterIdentifier") && form.Get("DBClusterIdentifier") != cluster.Identifier {
+			continue
+		}
+		cluster.advance()
+
+		var members []dbClusterMember
+		for i, instance := range cluster.Instances {
+			members = append(members, dbClusterMember{Identifier: instance, Writer: i == 0})
+		}
+		clusters = append(clusters, dbCluster{
+			Identifier:           cluster.Identifier,
+			Arn:                  fmt.Sprintf("arn:aws:rds:eu-central-1:%s:cluster:%s", s.AccountID, cluster.Identifier),
+			Engine:               cluster.Engine,
+			EngineVersion:        cluster.EngineVersion,
+			Status:               cluster.Status,
+			Members:              members,
+			PendingEngineVersion: cluster.pendingEngineVersion,
+		})
+	}
+	if form.Has("DBClusterIdentifier") && len(clusters) == 0 {
+		writeFault(w, r, awsQuery, NotFound("DBClusterNotFoundFault"))
+		return
+	}
+	slices.SortFunc(clusters, func(a, b dbCluster) int { return strings.Compare(a.Identifier, b.Identifier) })
+
+	writeXML(w, struct {
+		XMLName   xml.Name    `xml:"http://rds.amazonaws.com/doc/2014-10-31/ DescribeDBClustersResponse"`
+		Clusters  []dbCluster `xml:"DescribeDBClustersResult>DBClusters>DBCluster"`
+		RequestID string      `xml:"ResponseMetadata>RequestId"`
+	}{Clusters: clusters, RequestID: "awsfake"})
+}
+
+func (s *Server) listDomainNames(w http.ResponseWriter) {
+	names := make([]string, 0, len(s.domains))
+	for name := range s.domains {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	domains := make([]map[string]string, len(names))
+	for i, name := range names {
+		domains[i] = map[string]string{"DomainName": name, "EngineType": "OpenSearch"}
+	}
+	writeJSON(w, map[string]interface{}{"DomainNames": domains})
+}
+
+func (s *Server) listRoles(w http.ResponseWriter) {
+	type role struct {
+		RoleName   string `xml:"RoleName"`
+		RoleID     string `xml:"RoleId"`
+		Arn        string `xml:"Arn"`
+		Path       string `xml:"Path"`
+		CreateDate string `xml:"CreateDate"`
+	}
+
+	var roles []role
+	for _, r := range s.roles {
+		roles = append(roles, role{
+			RoleName:   r.Name,
+			RoleID:     "AROAAWSFAKE" + strings.ToUpper(r.Name),
+			Arn:        fmt.Sprintf("arn:aws:iam::%s:role%s%s", s.AccountID, r.Path, r.Name),
+			Path:       r.Path,
+			CreateDate: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		})
+	}
+	slices.SortFunc(roles, func(a, b role) int { return strings.Compare(a.RoleName, b.RoleName) })
+
+	writeXML(w, struct {
+		XMLName     xml.Name `xml:"https://iam.amazonaws.com/doc/2010-05-08/ ListRolesResponse"`
+		Roles       []role   `xml:"ListRolesResult>Roles>member"`
+		IsTruncated bool     `xml:"ListRolesResult>IsTruncated"`
+		RequestID   string   `xml:"ResponseMetadata>RequestId"`
+	}{Roles: roles, RequestID: "awsfake"})
+}
+
+func (s *Server) policyArn(name string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:policy/%s", s.AccountID, name)
+}
+
+// attachedPolicy returns the document of the managed policy of the ARN attached to a role
+func (s *Server) attachedPolicy(arn string) (string, bool) {
+	for _, role := range s.roles {
+		for name, document := range role.AttachedPolicies {
+			if s.policyArn(name) == arn {
+				return document, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (s *Server) listAttachedRolePolicies(w http.ResponseWriter, r *http.Request, body []byte) {
+	form, _ := url.ParseQuery(string(body))
+	role, ok := s.roles[form.Get("RoleName")]
+	if !ok {
+		writeFault(w, r, awsQuery, NotFound("NoSuchEntity"))
+		return
+	}
+
+	type attachedPolicy struct {
+		PolicyName string `xml:"PolicyName"`
+		PolicyArn  string `xml:"PolicyArn"`
+	}
+	var policies []attachedPolicy
+	for name := range role.AttachedPolicies {
+		policies = append(policies, attachedPolicy{PolicyName: name, PolicyArn: s.policyArn(name)})
+	}
+	slices.SortFunc(policies, func(a, b attachedPolicy) int { return strings.Compare(a.PolicyName, b.PolicyName) })
+
+	writeXML(w, struct {
+		XMLName     xml.Name         `xml:"https://iam.amazonaws.com/doc/2010-05-08/ ListAttachedRolePoliciesResponse"`
+		Policies    []attachedPolicy `xml:"ListAttachedRolePoliciesResult>AttachedPolicies>member"`
+		IsTruncated bool             `xml:"ListAttachedRolePoliciesResult>IsTruncated"`
+		RequestID   string           `xml:"ResponseMetadata>RequestId"`
+	}{Policies: policies, RequestID: "awsfake"})
+}
+
+func (s *Server) getPolicy(w http.ResponseWriter, r *http.Request, body []byte) {
+	form, _ := url.ParseQuery(string(body))
+	arn := form.Get("PolicyArn")
+	if _, ok := s.attachedPolicy(arn); !ok {
+		writeFault(w, r, awsQuery, NotFound("NoSuchEntity"))
+		return
+	}
+
+	writeXML(w, struct {
+		XMLName          xml.Name `xml:"https://iam.amazonaws.com/doc/2010-05-08/ GetPolicyResponse"`
+		Arn              string   `xml:"GetPolicyResult>Policy>Arn"`
+		DefaultVersionID string   `xml:"GetPolicyResult>Policy>DefaultVersionId"`
+		RequestID        string   `xml:"ResponseMetadata>RequestId"`
+	}{Arn: arn, DefaultVersionID: "v1", RequestID: "awsfake"})
+}
+
+func (s *Server) getPolicyVersion(w http.ResponseWriter, r *http.Request, body []byte) {
+	form, _ := url.ParseQuery(string(body))
+	document, ok := s.attachedPolicy(form.Get("PolicyArn"))
+	if !ok || form.Get("VersionId") != "v1" {
+		writeFault(w, r, awsQuery, NotFound("NoSuchEntity"))
+		return
+	}
+
+	// IAM returns the documents URL encoded
+	writeXML(w, struct {
+		XMLName          xml.Name `xml:"https://iam.amazonaws.com/doc/2010-05-08/ GetPolicyVersionResponse"`
+		Document         string   `xml:"GetPolicyVersionResult>PolicyVersion>Document"`
+		VersionID        string   `xml:"GetPolicyVersionResult>PolicyVersion>VersionId"`
+		IsDefaultVersion bool     `xml:"GetPolicyVersionResult>PolicyVersion>IsDefaultVersion"`
+		RequestID        string   `xml:"ResponseMetadata>RequestId"`
+	}{Document: url.PathEscape(document), VersionID: "v1", IsDefaultVersion: true, RequestID: "awsfake"})
+}
+
+func (s *Server) kmsKeyArn(id string) string {
+	return fmt.Sprintf("arn:aws:kms:eu-central-1:%s:key/%s", s.AccountID, id)
+}
+
+// kmsKey decodes the KeyId of a KMS request and returns the key, the error is written if it does not exist
+func (s *Server) kmsKey(w http.ResponseWriter, r *http.Request, body []byte) (*KMSKey, bool) {
+	var input struct {
+		KeyID string `json:"KeyId"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		writeFault(w, r, awsJSON, Fault{StatusCode: http.StatusBadRequest, Code: "ValidationException", Message: err.Error()})
+		return nil, false
+	}
+
+	key, ok := s.kmsKeys[input.KeyID]
+	if !ok {
+		writeFault(w, r, awsJSON, Fault{StatusCode: http.StatusBadRequest, Code: "NotFoundException", Message: fmt.Sprintf("Key '%s' does not exist", input.KeyID)})
+		return nil, false
+	}
+	return key, true
+}
+
+func (s *Server) sortedKMSKeys() []*KMSKey {
+	keys := make([]*KMSKey, 0, len(s.kmsKeys))
+	for _, key := range s.kmsKeys {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b *KMSKey) int { return strings.Compare(a.ID, b.ID) })
+	return keys
+}
+
+func writeAwsJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) listKeys(w http.ResponseWriter) {
+	var keys []map[string]string
+	for _, key := range s.sortedKMSKeys() {
+		keys = append(keys, map[string]string{"KeyId": key.ID, "KeyArn": s.kmsKeyArn(key.ID)})
+	}
+	writeAwsJSON(w, map[string]interface{}{"Keys": keys, "Truncated": false})
+}
+
+func (s *Server) describeKey(w http.ResponseWriter, r *http.Request, body []byte) {
+	key, ok := s.kmsKey(w, r, body)
+	if !ok {
+		return
+	}
+	writeAwsJSON(w, map[string]interface{}{
+		"KeyMetadata": map[string]interface{}{
+			"KeyId":        key.ID,
+			"Arn":          s.kmsKeyArn(key.ID),
+			"Description":  key.Description,
+			"KeyState":     key.State,
+			"Enabled":      key.State == "Enabled",
+			"CreationDate": 0,
+		},
+	})
+}
+
+func (s *Server) listAliases(w http.ResponseWriter) {
+	var aliases []map[string]string
+	for _, key := range s.sortedKMSKeys() {
+		for _, alias := range key.Aliases {
+			aliases = append(aliases, map[string]string{
+				"AliasName":   alias,
+				"AliasArn":    fmt.Sprintf("arn:aws:kms:eu-central-1:%s:%s", s.AccountID, alias),
+				"TargetKeyId": key.ID,
+			})
+		}
+	}
+	writeAwsJSON(w, map[string]interface{}{"Aliases": aliases, "Truncated": false})
+}
+
+func (s *Server) listResourceTags(w http.ResponseWriter, r *http.Request, body []byte) {
+	key, ok := s.kmsKey(w, r, body)
+	if !ok {
+		return
+	}
+
+	var tags []map[string]string
+	for tagKey, value := range key.Tags {
+		tags = append(tags, map[string]string{"TagKey": tagKey, "TagValue": value})
+	}
+	slices.SortFunc(tags, func(a, b map[string]string) int { return strings.Compare(a["TagKey"], b["TagKey"]) })
+	writeAwsJSON(w, map[string]interface{}{"Tags": tags, "Truncated": false})
+}
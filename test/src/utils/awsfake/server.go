@@ -0,0 +1,753 @@
+// Package awsfake provides an in-process fake of the AWS APIs used by the test helpers and the plans of the modules.
+// It is served by httptest and targeted with utils.WithAwsEndpoint, so the helpers can be
+// unit tested without network access or AWS account.
+package awsfake
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UpdateStatus values of an EKS update, they match the EKS API
+const (
+	UpdateInProgress = "InProgress"
+	UpdateSuccessful = "Successful"
+	UpdateFailed     = "Failed"
+	UpdateCancelled  = "Cancelled"
+)
+
+// Cluster is the state of a fake EKS cluster
+type Cluster struct {
+	Name       string
+	Version    string
+	Status     string
+	Endpoint   string
+	CAData     string
+	OIDCIssuer string
+	VpcID      string
+	SubnetIDs  []string
+	Addons     []string
+	Nodegroups []string
+	// AddonVersions are the versions of the installed add-ons, v0.0.1-eksbuild.1 by default
+	AddonVersions map[string]string
+	// NodegroupVersions are the kubernetes versions of the node groups, the version of the cluster by default.
+	// Each node group has a single node.
+	NodegroupVersions map[string]string
+	// Insights are the upgrade insights returned by ListInsights
+	Insights []Insight
+}
+
+// Update is the state of a fake EKS update, each DescribeUpdate moves it to the next status of Script,
+// the last status of the script is kept once reached
+type Update struct {
+	ID      string
+	Cluster string
+	Type    string
+	Version string
+	// Addon or Nodegroup is set for the updates of an add-on or a node group
+	Addon     string
+	Nodegroup string
+	Script    []string
+	position  int
+}
+
+// Status returns the current status of the update
+func (u *Update) Status() string {
+	return u.Script[u.position]
+}
+
+// Bucket is the state of a fake S3 bucket
+type Bucket struct {
+	Name    string
+	Region  string
+	Tags    map[string]string
+	Objects map[string][]byte
+	// LastModified is the modification time of the objects, the creation time of the bucket is used for the missing ones
+	LastModified map[string]time.Time
+	created      time.Time
+}
+
+// Fault is an error returned by the fake in place of the response of an operation
+type Fault struct {
+	StatusCode int
+	Code       string
+	Message    string
+	// Times is the number of requests affected by the fault, 0 means every request
+	Times int
+}
+
+// NotFound returns a fault with the 404 error used by the service for the operation
+func NotFound(code string) Fault {
+	return Fault{StatusCode: http.StatusNotFound, Code: code, Message: "resource not found"}
+}
+
+// AccessDenied returns a 403 fault
+func AccessDenied() Fault {
+	return Fault{StatusCode: http.StatusForbidden, Code: "AccessDeniedException", Message: "not authorized to perform this operation"}
+}
+
+// Throttling returns a throttling fault affecting the given number of requests
+func Throttling(times int) Fault {
+	return Fault{StatusCode: http.StatusBadRequest, Code: "ThrottlingException", Message: "rate exceeded", Times: times}
+}
+
+// protocol is the wire protocol of an AWS service, it defines how the errors are encoded
+type protocol int
+
+const (
+	// restJSON is used by EKS
+	restJSON protocol = iota
+	// restXML is used by S3
+	restXML
+	// awsQuery is used by STS, IAM and RDS
+	awsQuery
+	// ec2Query is used by EC2
+	ec2Query
+	// awsJSON is used by Service Quotas and KMS
+	awsJSON
+)
+
+// Server is a scriptable fake of the EKS and S3 APIs, it also answers the read-only calls
+// of the terraform data sources of the modules (STS, EC2 and Service Quotas) and lists the resources
+// of the inventory (EKS, RDS, OpenSearch, IAM and KMS)
+type Server struct {
+	*httptest.Server
+
+	mu                 sync.Mutex
+	clusters           map[string]*Cluster
+	updates            map[string]*Update
+	buckets            map[string]*Bucket
+	vpcs               map[string]*Vpc
+	addonVersions      map[string][]AddonVersion
+	clusterVersions    []ClusterVersion
+	engineVersions     []EngineVersion
+	openSearchVersions []string
+	dbClusters         map[string]*DBCluster
+	domains            map[string]*Domain
+	roles              map[string]*Role
+	kmsKeys            map[string]*KMSKey
+	faults             map[string][]*Fault
+	calls              map[string]int
+	// UpdateScript is the sequence of statuses used by the updates created with UpdateClusterVersion,
+	// UpdateAddon and UpdateNodegroupVersion
+	UpdateScript []string
+	// UpdateScripts overrides UpdateScript for the updates of the add-ons and node groups, indexed by their name
+	UpdateScripts map[string][]string
+	nextUpdate    int
+	// ModifyScript is the sequence of statuses of an RDS cluster after ModifyDBCluster, one per DescribeDBClusters,
+	// the new engine version is applied with the available status
+	ModifyScript []string
+	// AccountID is the account returned by GetCallerIdentity
+	AccountID string
+	// ElasticIPQuota is the value of the quota L-0263D0A3 returned by GetServiceQuota
+	ElasticIPQuota float64
+}
+
+// NewServer starts a fake server, it is closed at the end of the test through Close
+func NewServer() *Server {
+	s := &Server{
+		clusters:       make(map[string]*Cluster),
+		updates:        make(map[string]*Update),
+		buckets:        make(map[string]*Bucket),
+		vpcs:           make(map[string]*Vpc),
+		addonVersions:  make(map[string][]AddonVersion),
+		dbClusters:     make(map[string]*DBCluster),
+		domains:        make(map[string]*Domain),
+		roles:          make(map[string]*Role),
+		kmsKeys:        make(map[string]*KMSKey),
+		faults:         make(map[string][]*Fault),
+		calls:          make(map[string]int),
+		UpdateScript:   []string{UpdateInProgress, UpdateSuccessful},
+		UpdateScripts:  make(map[string][]string),
+		ModifyScript:   []string{"upgrading", "available"},
+		AccountID:      "000000000000",
+		ElasticIPQuota: 5,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// AddCluster registers an EKS cluster
+func (s *Server) AddCluster(cluster Cluster) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cluster.Status == "" {
+		cluster.Status = "ACTIVE"
+	}
+	cluster.AddonVersions = maps.Clone(cluster.AddonVersions)
+	if cluster.AddonVersions == nil {
+		cluster.AddonVersions = make(map[string]string)
+	}
+	for _, addon := range cluster.Addons {
+		if _, ok := cluster.AddonVersions[addon]; !ok {
+			cluster.AddonVersions[addon] = "v0.0.1-eksbuild.1"
+		}
+	}
+	cluster.NodegroupVersions = maps.Clone(cluster.NodegroupVersions)
+	if cluster.NodegroupVersions == nil {
+		cluster.NodegroupVersions = make(map[string]string)
+	}
+	for _, nodegroup := range cluster.Nodegroups {
+		if _, ok := cluster.NodegroupVersions[nodegroup]; !ok {
+			cluster.NodegroupVersions[nodegroup] = cluster.Version
+		}
+	}
+	s.clusters[cluster.Name] = &cluster
+}
+
+// Cluster returns a copy of the state of the cluster
+func (s *Server) Cluster(name string) (Cluster, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cluster, ok := s.clusters[name]
+	if !ok {
+		return Cluster{}, false
+	}
+	result := *cluster
+	result.AddonVersions = maps.Clone(cluster.AddonVersions)
+	result.NodegroupVersions = maps.Clone(cluster.NodegroupVersions)
+	return result, true
+}
+
+// AddBucket registers an S3 bucket
+func (s *Server) AddBucket(bucket Bucket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if bucket.Tags == nil {
+		bucket.Tags = make(map[string]string)
+	}
+	if bucket.Objects == nil {
+		bucket.Objects = make(map[string][]byte)
+	}
+	if bucket.LastModified == nil {
+		bucket.LastModified = make(map[string]time.Time)
+	}
+	bucket.created = time.Now()
+	s.buckets[bucket.Name] = &bucket
+}
+
+// Bucket returns a copy of the state of the bucket
+func (s *Server) Bucket(name string) (Bucket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[name]
+	if !ok {
+		return Bucket{}, false
+	}
+	return *bucket, true
+}
+
+// InjectFault makes the next calls of operation (e.g. "HeadBucket", "DescribeUpdate") fail with fault
+func (s *Server) InjectFault(operation string, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults[operation] = append(s.faults[operation], &fault)
+}
+
+// Calls returns the number of requests received for operation, including the failed ones
+func (s *Server) Calls(operation string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[operation]
+}
+
+// takeFault returns the fault to apply to the operation, if any, the lock must be held
+func (s *Server) takeFault(operation string) *Fault {
+	faults := s.faults[operation]
+	if len(faults) == 0 {
+		return nil
+	}
+
+	fault := faults[0]
+	if fault.Times > 0 {
+		fault.Times--
+		if fault.Times == 0 {
+			s.faults[operation] = faults[1:]
+		}
+	}
+	return fault
+}
+
+// route identifies the operation of the request and its protocol, the path parameters are returned in params
+func route(r *http.Request, body []byte) (operation string, params []string, proto protocol) {
+	// the query and JSON protocols post every operation on /
+	if r.URL.Path == "/" && r.Method == http.MethodPost {
+		if target := r.Header.Get("X-Amz-Target"); target != "" {
+			_, operation, _ = strings.Cut(target, ".")
+			return operation, nil, awsJSON
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "", nil, awsQuery
+		}
+		operation = form.Get("Action")
+		if _, ok := ec2Operations[operation]; ok {
+			return operation, nil, ec2Query
+		}
+		return operation, nil, awsQuery
+	}
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if path[0] == "clusters" {
+		switch {
+		case len(path) == 1 && r.Method == http.MethodGet:
+			return "ListClusters", nil, restJSON
+		case len(path) == 2 && r.Method == http.MethodGet:
+			return "DescribeCluster", path[1:], restJSON
+		case len(path) == 3 && path[2] == "updates" && r.Method == http.MethodPost:
+			return "UpdateClusterVersion", path[1:2], restJSON
+		case len(path) == 4 && path[2] == "updates" && r.Method == http.MethodGet:
+			return "DescribeUpdate", []string{path[1], path[3]}, restJSON
+		case len(path) == 3 && path[2] == "addons" && r.Method == http.MethodGet:
+			return "ListAddons", path[1:2], restJSON
+		case len(path) == 4 && path[2] == "addons" && r.Method == http.MethodGet:
+			return "DescribeAddon", []string{path[1], path[3]}, restJSON
+		case len(path) == 5 && path[2] == "addons" && path[4] == "update" && r.Method == http.MethodPost:
+			return "UpdateAddon", []string{path[1], path[3]}, restJSON
+		case len(path) == 3 && path[2] == "node-groups" && r.Method == http.MethodGet:
+			return "ListNodegroups", path[1:2], restJSON
+		case len(path) == 4 && path[2] == "node-groups" && r.Method == http.MethodGet:
+			return "DescribeNodegroup", []string{path[1], path[3]}, restJSON
+		case len(path) == 5 && path[2] == "node-groups" && path[4] == "update-version" && r.Method == http.MethodPost:
+			return "UpdateNodegroupVersion", []string{path[1], path[3]}, restJSON
+		case len(path) == 3 && path[2] == "insights" && r.Method == http.MethodPost:
+			return "ListInsights", path[1:2], restJSON
+		}
+		return "", nil, restJSON
+	}
+	if r.URL.Path == "/addons/supported-versions" && r.Method == http.MethodGet {
+		return "DescribeAddonVersions", nil, restJSON
+	}
+	if r.URL.Path == "/cluster-versions" && r.Method == http.MethodGet {
+		return "DescribeClusterVersions", nil, restJSON
+	}
+	if r.URL.Path == "/2021-01-01/domain" && r.Method == http.MethodGet {
+		return "ListDomainNames", nil, restJSON
+	}
+	if r.URL.Path == "/2021-01-01/opensearch/versions" && r.Method == http.MethodGet {
+		return "ListVersions", nil, restJSON
+	}
+
+	// S3 uses the path style addressing on IP endpoints: /<bucket>/<key>
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+		return "HeadBucket", []string{bucket}, restXML
+	case key == "" && r.Method == http.MethodPut && r.URL.Query().Has("tagging"):
+		return "PutBucketTagging", []string{bucket}, restXML
+	case key == "" && r.Method == http.MethodPut:
+		return "CreateBucket", []string{bucket}, restXML
+	case key == "" && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		return "ListObjectsV2", []string{bucket}, restXML
+	case key != "" && r.Method == http.MethodDelete:
+		return "DeleteObject", []string{bucket, key}, restXML
+	}
+	return "", nil, restXML
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	operation, params, proto := route(r, body)
+	if operation == "" {
+		http.Error(w, fmt.Sprintf("awsfake: unsupported request %s %s", r.Method, r.URL), http.StatusNotImplemented)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[operation]++
+
+	if fault := s.takeFault(operation); fault != nil {
+		writeFault(w, r, proto, *fault)
+		return
+	}
+
+	switch operation {
+	case "DescribeCluster":
+		s.describeCluster(w, r, params[0])
+	case "UpdateClusterVersion":
+		s.updateClusterVersion(w, r, params[0], body)
+	case "DescribeUpdate":
+		s.describeUpdate(w, r, params[0], params[1])
+	case "ListAddons":
+		s.listAddons(w, r, params[0])
+	case "DescribeAddon":
+		s.describeAddon(w, r, params[0], params[1])
+	case "UpdateAddon":
+		s.updateAddon(w, r, params[0], params[1], body)
+	case "DescribeNodegroup":
+		s.describeNodegroup(w, r, params[0], params[1])
+	case "UpdateNodegroupVersion":
+		s.updateNodegroupVersion(w, r, params[0], params[1], body)
+	case "ListInsights":
+		s.listInsights(w, r, params[0], body)
+	case "DescribeClusterVersions":
+		s.describeClusterVersions(w, r)
+	case "DescribeDBEngineVersions":
+		s.describeDBEngineVersions(w, body)
+	case "ListVersions":
+		s.listVersions(w)
+	case "HeadBucket":
+		s.headBucket(w, r, params[0])
+	case "CreateBucket":
+		s.createBucket(w, r, params[0], body)
+	case "PutBucketTagging":
+		s.putBucketTagging(w, r, params[0], body)
+	case "ListObjectsV2":
+		s.listObjectsV2(w, r, params[0])
+	case "DeleteObject":
+		s.deleteObject(w, r, params[0], params[1])
+	case "DescribeAddonVersions":
+		s.describeAddonVersions(w, r)
+	case "GetCallerIdentity":
+		s.getCallerIdentity(w)
+	case "DescribeVpcs":
+		s.describeVpcs(w, body)
+	case "DescribeAddresses":
+		s.describeAddresses(w)
+	case "DescribeSubnets":
+		s.describeSubnets(w, body)
+	case "DescribeRouteTables":
+		describeEmptySet(w, operation, "routeTableSet")
+	case "DescribeInternetGateways":
+		describeEmptySet(w, operation, "internetGatewaySet")
+	case "DescribeNatGateways":
+		describeEmptySet(w, operation, "natGatewaySet")
+	case "GetServiceQuota":
+		s.getServiceQuota(w, r, body)
+	case "ListClusters":
+		s.listClusters(w)
+	case "ListNodegroups":
+		s.listNodegroups(w, r, params[0])
+	case "DescribeDBClusters":
+		s.describeDBClusters(w, r, body)
+	case "DescribeDBInstances":
+		s.describeDBInstances(w, r, body)
+	case "ModifyDBCluster":
+		s.modifyDBCluster(w, r, body)
+	case "ListDomainNames":
+		s.listDomainNames(w)
+	case "ListRoles":
+		s.listRoles(w)
+	case "ListAttachedRolePolicies":
+		s.listAttachedRolePolicies(w, r, body)
+	case "GetPolicy":
+		s.getPolicy(w, r, body)
+	case "GetPolicyVersion":
+		s.getPolicyVersion(w, r, body)
+	case "ListKeys":
+		s.listKeys(w)
+	case "DescribeKey":
+		s.describeKey(w, r, body)
+	case "ListAliases":
+		s.listAliases(w)
+	case "ListResourceTags":
+		s.listResourceTags(w, r, body)
+	default:
+		writeFault(w, r, proto, Fault{StatusCode: http.StatusBadRequest, Code: "InvalidAction", Message: fmt.Sprintf("awsfake: unsupported operation %s", operation)})
+	}
+}
+
+// writeFault encodes the fault in the error format of the protocol of the service
+func writeFault(w http.ResponseWriter, r *http.Request, proto protocol, fault Fault) {
+	type xmlError struct {
+		Type    string `xml:"Type,omitempty"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+
+	switch proto {
+	case restXML:
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(fault.StatusCode)
+		// HEAD responses have no body, the SDK relies on the status code
+		if r.Method != http.MethodHead {
+			_ = xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"Error"`
+				xmlError
+			}{xmlError: xmlError{Code: fault.Code, Message: fault.Message}})
+		}
+	case awsQuery:
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(fault.StatusCode)
+		_ = xml.NewEncoder(w).Encode(struct {
+			XMLName xml.Name `xml:"ErrorResponse"`
+			Error   xmlError `xml:"Error"`
+		}{Error: xmlError{Type: "Sender", Code: fault.Code, Message: fault.Message}})
+	case ec2Query:
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(fault.StatusCode)
+		_ = xml.NewEncoder(w).Encode(struct {
+			XMLName xml.Name   `xml:"Response"`
+			Errors  []xmlError `xml:"Errors>Error"`
+		}{Errors: []xmlError{{Code: fault.Code, Message: fault.Message}}})
+	case awsJSON:
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(fault.StatusCode)
+		_ = json.NewEncoder(w).Encode(map[string]string{"__type": fault.Code, "message": fault.Message})
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Amzn-Errortype", fault.Code)
+		w.WriteHeader(fault.StatusCode)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": fault.Message})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) describeCluster(w http.ResponseWriter, r *http.Request, name string) {
+	cluster, ok := s.clusters[name]
+	if !ok {
+		writeFault(w, r, restJSON, NotFound("ResourceNotFoundException"))
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"cluster": map[string]interface{}{
+			"name":                 cluster.Name,
+			"arn":                  fmt.Sprintf("arn:aws:eks:eu-central-1:000000000000:cluster/%s", cluster.Name),
+			"version":              cluster.Version,
+			"status":               cluster.Status,
+			"endpoint":             cluster.Endpoint,
+			"certificateAuthority": map[string]string{"data": cluster.CAData},
+			"identity":             map[string]interface{}{"oidc": map[string]string{"issuer": cluster.OIDCIssuer}},
+			"resourcesVpcConfig":   map[string]interface{}{"vpcId": cluster.VpcID, "subnetIds": cluster.SubnetIDs},
+		},
+	})
+}
+
+func (s *Server) updateClusterVersion(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	cluster, ok := s.clusters[name]
+	if !ok {
+		writeFault(w, r, restJSON, NotFound("ResourceNotFoundException"))
+		return
+	}
+
+	var input struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		writeFault(w, r, restJSON, Fault{StatusCode: http.StatusBadRequest, Code: "InvalidParameterException", Message: err.Error()})
+		return
+	}
+
+	update := s.startUpdate(&Update{Cluster: cluster.Name, Type: "VersionUpdate", Version: input.Version})
+	writeJSON(w, map[string]interface{}{"update": updateJSON(update)})
+}
+
+// startUpdate registers the update with the next ID and its script
+func (s *Server) startUpdate(update *Update) *Update {
+	s.nextUpdate++
+	update.ID = fmt.Sprintf("update-%d", s.nextUpdate)
+	script := s.UpdateScript
+	if name := update.Addon + update.Nodegroup; name != "" {
+		if override, ok := s.UpdateScripts[name]; ok {
+			script = override
+		}
+	}
+	update.Script = append([]string(nil), script...)
+	s.updates[update.ID] = update
+	return update
+}
+
+func (s *Server) describeUpdate(w http.ResponseWriter, r *http.Request, name, updateID string) {
+	update, ok := s.updates[updateID]
+	// the updates of the add-ons and node groups are only found with their name, as with EKS
+	query := r.URL.Query()
+	if !ok || update.Cluster != name || update.Addon != query.Get("addonName") || update.Nodegroup != query.Get("nodegroupName") {
+		writeFault(w, r, restJSON, NotFound("ResourceNotFoundException"))
+		return
+	}
+
+	if update.position < len(update.Script)-1 {
+		update.position++
+	}
+	if update.Status() == UpdateSuccessful {
+		cluster := s.clusters[name]
+		switch {
+		case update.Addon != "":
+			cluster.AddonVersions[update.Addon] = update.Version
+		case update.Nodegroup != "":
+			cluster.NodegroupVersions[update.Nodegroup] = update.Version
+		case update.Type == "VersionUpdate":
+			cluster.Version = update.Version
+		}
+	}
+
+	writeJSON(w, map[string]interface{}{"update": updateJSON(update)})
+}
+
+func updateJSON(update *Update) map[string]interface{} {
+	param := "Version"
+	if update.Addon != "" {
+		param = "AddonVersion"
+	}
+	result := map[string]interface{}{
+		"id":     update.ID,
+		"status": update.Status(),
+		"type":   update.Type,
+		"params": []map[string]string{{"type": param, "value": update.Version}},
+	}
+	if update.Status() == UpdateFailed {
+		result["errors"] = []map[string]interface{}{{"errorCode": "Other", "errorMessage": "scripted failure"}}
+	}
+	return result
+}
+
+func (s *Server) listAddons(w http.ResponseWriter, r *http.Request, name string) {
+	cluster, ok := s.clusters[name]
+	if !ok {
+		writeFault(w, r, restJSON, NotFound("ResourceNotFoundException"))
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"addons": cluster.Addons})
+}
+
+func (s *Server) headBucket(w http.ResponseWriter, r *http.Request, name string) {
+	if _, ok := s.buckets[name]; !ok {
+		writeFault(w, r, restXML, NotFound("NotFound"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) createBucket(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	if _, ok := s.buckets[name]; ok {
+		writeFault(w, r, restXML, Fault{StatusCode: http.StatusConflict, Code: "BucketAlreadyOwnedByYou", Message: "bucket already exists"})
+		return
+	}
+
+	var input struct {
+		LocationConstraint string `xml:"LocationConstraint"`
+	}
+	if len(body) > 0 {
+		if err := xml.Unmarshal(body, &input); err != nil {
+			writeFault(w, r, restXML, Fault{StatusCode: http.StatusBadRequest, Code: "MalformedXML", Message: err.Error()})
+			return
+		}
+	}
+
+	s.buckets[name] = &Bucket{
+		Name:         name,
+		Region:       input.LocationConstraint,
+		Tags:         make(map[string]string),
+		Objects:      make(map[string][]byte),
+		LastModified: make(map[string]time.Time),
+		created:      time.Now(),
+	}
+	w.Header().Set("Location", "/"+name)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) putBucketTagging(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	bucket, ok := s.buckets[name]
+	if !ok {
+		writeFault(w, r, restXML, NotFound("NoSuchBucket"))
+		return
+	}
+
+	var input struct {
+		Tags []struct {
+			Key   string `xml:"Key"`
+			Value string `xml:"Value"`
+		} `xml:"TagSet>Tag"`
+	}
+	if err := xml.Unmarshal(body, &input); err != nil {
+		writeFault(w, r, restXML, Fault{StatusCode: http.StatusBadRequest, Code: "MalformedXML", Message: err.Error()})
+		return
+	}
+
+	bucket.Tags = make(map[string]string)
+	for _, tag := range input.Tags {
+		bucket.Tags[tag.Key] = tag.Value
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, name, key string) {
+	bucket, ok := s.buckets[name]
+	if !ok {
+		writeFault(w, r, restXML, NotFound("NoSuchBucket"))
+		return
+	}
+
+	// like S3, deleting a missing key is not an error
+	delete(bucket.Objects, key)
+	delete(bucket.LastModified, key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listObjectsV2 lists the objects matching the prefix in a single page sorted by key
+func (s *Server) listObjectsV2(w http.ResponseWriter, r *http.Request, name string) {
+	bucket, ok := s.buckets[name]
+	if !ok {
+		writeFault(w, r, restXML, NotFound("NoSuchBucket"))
+		return
+	}
+
+	type content struct {
+		Key          string `xml:"Key"`
+		LastModified string `xml:"LastModified"`
+		Size         int    `xml:"Size"`
+	}
+	result := struct {
+		XMLName     xml.Name  `xml:"ListBucketResult"`
+		Name        string    `xml:"Name"`
+		Prefix      string    `xml:"Prefix"`
+		KeyCount    int       `xml:"KeyCount"`
+		IsTruncated bool      `xml:"IsTruncated"`
+		Contents    []content `xml:"Contents"`
+	}{Name: name, Prefix: r.URL.Query().Get("prefix")}
+
+	keys := make([]string, 0, len(bucket.Objects))
+	for key := range bucket.Objects {
+		if strings.HasPrefix(key, result.Prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		lastModified, ok := bucket.LastModified[key]
+		if !ok {
+			lastModified = bucket.created
+		}
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: lastModified.UTC().Format(time.RFC3339),
+			Size:         len(bucket.Objects[key]),
+		})
+	}
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,263 @@
+package awsfake
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// Insight is an upgrade readiness insight of a fake EKS cluster
+type Insight struct {
+	Name string
+	// KubernetesVersion is the version of kubernetes checked by the insight, e.g. "1.30"
+	KubernetesVersion string
+	// Status is PASSING, WARNING, ERROR or UNKNOWN
+	Status string
+	Reason string
+}
+
+// ClusterVersion is a kubernetes version of EKS returned by DescribeClusterVersions
+type ClusterVersion struct {
+	Version string
+	// Status is STANDARD_SUPPORT, EXTENDED_SUPPORT or UNSUPPORTED
+	Status  string
+	Default bool
+}
+
+// AddClusterVersion registers a kubernetes version of EKS
+func (s *Server) AddClusterVersion(version ClusterVersion) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clusterVersions = append(s.clusterVersions, version)
+}
+
+// describeClusterVersions returns the registered versions, the UNSUPPORTED ones are only returned with includeAll.
+// Only the clusterVersions, versionStatus, defaultOnly and includeAll filters are supported.
+func (s *Server) describeClusterVersions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	clusterVersions := query["clusterVersions"]
+
+	versions := make([]map[string]interface{}, 0, len(s.clusterVersions))
+	for _, version := range s.clusterVersions {
+		switch {
+		case len(clusterVersions) > 0 && !slices.Contains(clusterVersions, version.Version):
+			continue
+		case query.Has("versionStatus") && query.Get("versionStatus") != version.Status:
+			continue
+		case query.Get("defaultOnly") == "true" && !version.Default:
+			continue
+		case query.Get("includeAll") != "true" && version.Status == "UNSUPPORTED":
+			continue
+		}
+		versions = append(versions, map[string]interface{}{
+			"clusterType":            "eks",
+			"clusterVersion":         version.Version,
+			"defaultVersion":         version.Default,
+			"kubernetesPatchVersion": version.Version + ".0",
+			"versionStatus":          version.Status,
+		})
+	}
+	writeJSON(w, map[string]interface{}{"clusterVersions": versions})
+}
+
+// EngineVersion is an RDS engine version returned by DescribeDBEngineVersions
+type EngineVersion struct {
+	Engine  string
+	Version string
+	// Status is available (default) or deprecated
+	Status string
+	// UpgradeTargets are the versions this version can be upgraded to, any newer version when empty
+	UpgradeTargets []string
+}
+
+// AddEngineVersion registers an RDS engine version
+func (s *Server) AddEngineVersion(version EngineVersion) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version.Status == "" {
+		version.Status = "available"
+	}
+	version.UpgradeTargets = slices.Clone(version.UpgradeTargets)
+	s.engineVersions = append(s.engineVersions, version)
+}
+
+// AddOpenSearchVersion registers a version returned by ListVersions, e.g. OpenSearch_2.15 or Elasticsearch_7.10
+func (s *Server) AddOpenSearchVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.openSearchVersions = append(s.openSearchVersions, version)
+}
+
+// describeDBEngineVersions returns the registered engine versions with their upgrade targets,
+// only the Engine and EngineVersion filters are supported
+func (s *Server) describeDBEngineVersions(w http.ResponseWriter, body []byte) {
+	form, _ := url.ParseQuery(string(body))
+
+	type upgradeTarget struct {
+		Engine                string `xml:"Engine"`
+		EngineVersion         string `xml:"EngineVersion"`
+		IsMajorVersionUpgrade bool   `xml:"IsMajorVersionUpgrade"`
+	}
+	type engineVersion struct {
+		Engine         string          `xml:"Engine"`
+		EngineVersion  string          `xml:"EngineVersion"`
+		Status         string          `xml:"Status"`
+		UpgradeTargets []upgradeTarget `xml:"ValidUpgradeTarget>UpgradeTarget"`
+	}
+	var versions []engineVersion
+	for _, version := range s.engineVersions {
+		if (form.Has("Engine") && form.Get("Engine") != version.Engine) || (form.Has("EngineVersion") && form.Get("EngineVersion") != version.Version) {
+			continue
+		}
+		var targets []upgradeTarget
+		for _, target := range version.UpgradeTargets {
+			targets = append(targets, upgradeTarget{Engine: version.Engine, EngineVersion: target, IsMajorVersionUpgrade: majorVersion(target) != majorVersion(version.Version)})
+		}
+		versions = append(versions, engineVersion{Engine: version.Engine, EngineVersion: version.Version, Status: version.Status, UpgradeTargets: targets})
+	}
+
+	writeXML(w, struct {
+		XMLName   xml.Name        `xml:"http://rds.amazonaws.com/doc/2014-10-31/ DescribeDBEngineVersionsResponse"`
+		Versions  []engineVersion `xml:"DescribeDBEngineVersionsResult>DBEngineVersions>DBEngineVersion"`
+		RequestID string          `xml:"ResponseMetadata>RequestId"`
+	}{Versions: versions, RequestID: "awsfake"})
+}
+
+func (s *Server) listVersions(w http.ResponseWriter) {
+	writeJSON(w, map[string]interface{}{"Versions": s.openSearchVersions})
+}
+
+func (s *Server) describeAddon(w http.ResponseWriter, r *http.Request, name, addon string) {
+	cluster, ok := s.clusters[name]
+	if !ok || !slices.Contains(cluster.Addons, addon) {
+		writeFault(w, r, restJSON, NotFound("ResourceNotFoundException"))
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"addon": map[string]interface{}{
+			"addonName":    addon,
+			"clusterName":  cluster.Name,
+			"addonVersion": cluster.AddonVersions[addon],
+			"status":       "ACTIVE",
+		},
+	})
+}
+
+// updateAddon starts the update of the add-on, the version must be one of its registered versions (see AddAddonVersion)
+func (s *Server) updateAddon(w http.ResponseWriter, r *http.Request, name, addon string, body []byte) {
+	cluster, ok := s.clusters[name]
+	if !ok || !slices.Contains(cluster.Addons, addon) {
+		writeFault(w, r, restJSON, NotFound("ResourceNotFoundException"))
+		return
+	}
+
+	var input struct {
+		AddonVersion string `json:"addonVersion"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		writeFault(w, r, restJSON, Fault{StatusCode: http.StatusBadRequest, Code: "InvalidParameterException", Message: err.Error()})
+		return
+	}
+	if versions, ok := s.addonVersions[addon]; ok && !slices.ContainsFunc(versions, func(version AddonVersion) bool { return version.Version == input.AddonVersion }) {
+		writeFault(w, r, restJSON, Fault{StatusCode: http.StatusBadRequest, Code: "InvalidParameterException", Message: fmt.Sprintf("addon version %s of %s is not supported", input.AddonVersion, addon)})
+		return
+	}
+
+	update := s.startUpdate(&Update{Cluster: cluster.Name, Type: "AddonUpdate", Version: input.AddonVersion, Addon: addon})
+	writeJSON(w, map[string]interface{}{"update": updateJSON(update)})
+}
+
+func (s *Server) describeNodegroup(w http.ResponseWriter, r *http.Request, name, nodegroup string) {
+	cluster, ok := s.clusters[name]
+	if !ok || !slices.Contains(cluster.Nodegroups, nodegroup) {
+		writeFault(w, r, restJSON, NotFound("ResourceNotFoundException"))
+		return
+	}
+
+	version := cluster.NodegroupVersions[nodegroup]
+	writeJSON(w, map[string]interface{}{
+		"nodegroup": map[string]interface{}{
+			"nodegroupName":  nodegroup,
+			"clusterName":    cluster.Name,
+			"version":        version,
+			"releaseVersion": fmt.Sprintf("%s.0-20250101", version),
+			"status":         "ACTIVE",
+			"scalingConfig":  map[string]int{"minSize": 1, "maxSize": 1, "desiredSize": 1},
+		},
+	})
+}
+
+// updateNodegroupVersion starts the update of the node group to the requested version or, by default,
+// to the version of the control plane. As with EKS, a node group cannot be newer than its control plane.
+func (s *Server) updateNodegroupVersion(w http.ResponseWriter, r *http.Request, name, nodegroup string, body []byte) {
+	cluster, ok := s.clusters[name]
+	if !ok || !slices.Contains(cluster.Nodegroups, nodegroup) {
+		writeFault(w, r, restJSON, NotFound("ResourceNotFoundException"))
+		return
+	}
+
+	var input struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		writeFault(w, r, restJSON, Fault{StatusCode: http.StatusBadRequest, Code: "InvalidParameterException", Message: err.Error()})
+		return
+	}
+	if input.Version == "" {
+		input.Version = cluster.Version
+	}
+	if input.Version != cluster.Version {
+		writeFault(w, r, restJSON, Fault{StatusCode: http.StatusBadRequest, Code: "InvalidParameterException", Message: fmt.Sprintf("requested Kubernetes version %s is not the version of the cluster %s", input.Version, cluster.Version)})
+		return
+	}
+
+	update := s.startUpdate(&Update{Cluster: cluster.Name, Type: "VersionUpdate", Version: input.Version, Nodegroup: nodegroup})
+	writeJSON(w, map[string]interface{}{"update": updateJSON(update)})
+}
+
+// listInsights returns the insights of the cluster, only the kubernetesVersions and statuses filters are supported
+func (s *Server) listInsights(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	cluster, ok := s.clusters[name]
+	if !ok {
+		writeFault(w, r, restJSON, NotFound("ResourceNotFoundException"))
+		return
+	}
+
+	var input struct {
+		Filter struct {
+			KubernetesVersions []string `json:"kubernetesVersions"`
+			Statuses           []string `json:"statuses"`
+		} `json:"filter"`
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &input); err != nil {
+			writeFault(w, r, restJSON, Fault{StatusCode: http.StatusBadRequest, Code: "InvalidParameterException", Message: err.Error()})
+			return
+		}
+	}
+
+	insights := make([]map[string]interface{}, 0, len(cluster.Insights))
+	for i, insight := range cluster.Insights {
+		if len(input.Filter.KubernetesVersions) > 0 && !slices.Contains(input.Filter.KubernetesVersions, insight.KubernetesVersion) {
+			continue
+		}
+		if len(input.Filter.Statuses) > 0 && !slices.Contains(input.Filter.Statuses, insight.Status) {
+			continue
+		}
+		insights = append(insights, map[string]interface{}{
+			"id":                fmt.Sprintf("insight-%d", i+1),
+			"name":              insight.Name,
+			"category":          "UPGRADE_READINESS",
+			"kubernetesVersion": insight.KubernetesVersion,
+			"insightStatus":     map[string]string{"status": insight.Status, "reason": insight.Reason},
+		})
+	}
+	writeJSON(w, map[string]interface{}{"insights": insights})
+}
@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TestsConfigFileEnv is the env variable pointing to an optional YAML file of the tests configuration
+const TestsConfigFileEnv = "TESTS_CONFIG_FILE"
+
+// testsEnvPrefix is the prefix of the env variables of the tests, an unknown variable with this prefix is rejected
+const testsEnvPrefix = "TESTS_"
+
+var (
+	awsRegionRegexp = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-[0-9]+$`)
+	bucketRegexp    = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+)
+
+// TestConfig is the configuration of the tests, it is read from the YAML file referenced by `TESTS_CONFIG_FILE`
+// (if set), then each field is overridden by its env variable (see testConfigEnv)
+type TestConfig struct {
+	ClusterID            string `yaml:"cluster_id"`
+	ClusterRegion        string `yaml:"cluster_region"`
+	StateBucket          string `yaml:"state_bucket"`
+	StateBucketRegion    string `yaml:"state_bucket_region"`
+	TFBinaryName         string `yaml:"tf_binary_name"`
+	CleanClusterAtTheEnd *bool  `yaml:"clean_cluster_at_the_end"`
+	AwsProfile           string `yaml:"aws_profile"`
+}
+
+// testConfigEnv lists the env variables of TestConfig in the order of the fields
+var testConfigEnv = []string{
+	"TESTS_CLUSTER_ID",
+	"TESTS_CLUSTER_REGION",
+	"TF_STATE_BUCKET",
+	"TF_STATE_BUCKET_REGION",
+	"TESTS_TF_BINARY_NAME",
+	"CLEAN_CLUSTER_AT_THE_END",
+	"AWS_PROFILE",
+}
+
+// LoadTestConfig loads the configuration of the tests from `TESTS_CONFIG_FILE` and the environment,
+// applies the defaults and validates the result
+func LoadTestConfig() (*TestConfig, error) {
+	cfg := &TestConfig{}
+
+	if path := os.Getenv(TestsConfigFileEnv); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the tests configuration %s: %w", path, err)
+		}
+		if err := decodeTestConfig(content, cfg); err != nil {
+			return nil, fmt.Errorf("invalid tests configuration %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	cfg.applyDefaults()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// decodeTestConfig decodes a YAML configuration, unknown keys are rejected
+func decodeTestConfig(content []byte, cfg *TestConfig) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// applyEnv overrides the fields from the env variables (KEY=value), unknown `TESTS_` variables are rejected
+// as they are most likely a typo of a known one
+func (c *TestConfig) applyEnv(environ []string) error {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		env[key] = value
+	}
+
+	var unknown []string
+	for key := range env {
+		if strings.HasPrefix(key, testsEnvPrefix) && key != TestsConfigFileEnv && !isTestConfigEnv(key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown tests configuration env variables %v, known variables are %v", unknown, testConfigEnv)
+	}
+
+	override := func(field *string, key string) {
+		if value, ok := env[key]; ok {
+			*field = value
+		}
+	}
+	override(&c.ClusterID, "TESTS_CLUSTER_ID")
+	override(&c.ClusterRegion, "TESTS_CLUSTER_REGION")
+	override(&c.StateBucket, "TF_STATE_BUCKET")
+	override(&c.StateBucketRegion, "TF_STATE_BUCKET_REGION")
+	override(&c.TFBinaryName, "TESTS_TF_BINARY_NAME")
+	if _, ok := env["AWS_PROFILE"]; !ok {
+		override(&c.AwsProfile, "AWS_DEFAULT_PROFILE")
+	}
+	override(&c.AwsProfile, "AWS_PROFILE")
+
+	if value, ok := env["CLEAN_CLUSTER_AT_THE_END"]; ok {
+		clean, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q for CLEAN_CLUSTER_AT_THE_END", value)
+		}
+		c.CleanClusterAtTheEnd = &clean
+	}
+	return nil
+}
+
+func isTestConfigEnv(key string) bool {
+	for _, known := range testConfigEnv {
+		if key == known {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDefaults fills the fields left empty by the file and the environment
+func (c *TestConfig) applyDefaults() {
+	if c.ClusterID == "" {
+		c.ClusterID = strings.ToLower(random.UniqueId())
+	}
+	if c.ClusterRegion == "" {
+		c.ClusterRegion = "eu-central-1"
+	}
+	if c.StateBucketRegion == "" {
+		c.StateBucketRegion = c.ClusterRegion
+	}
+	if c.StateBucket == "" {
+		c.StateBucket = fmt.Sprintf("tests-eks-tf-state-%s", c.StateBucketRegion)
+	}
+	if c.TFBinaryName == "" {
+		c.TFBinaryName = "terraform"
+	}
+	if c.CleanClusterAtTheEnd == nil {
+		clean := true
+		c.CleanClusterAtTheEnd = &clean
+	}
+	if c.AwsProfile == "" {
+		c.AwsProfile = "infex"
+	}
+}
+
+// Validate checks the format of the regions and the naming rules of the state bucket
+func (c *TestConfig) Validate() error {
+	var errs []error
+	if !IsValidAwsRegion(c.ClusterRegion) {
+		errs = append(errs, fmt.Errorf("invalid cluster region %q", c.ClusterRegion))
+	}
+	if !IsValidAwsRegion(c.StateBucketRegion) {
+		errs = append(errs, fmt.Errorf("invalid state bucket region %q", c.StateBucketRegion))
+	}
+	if err := ValidateBucketName(c.StateBucket); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ClusterID == "" || strings.ToLower(c.ClusterID) != c.ClusterID {
+		errs = append(errs, fmt.Errorf("invalid cluster id %q, it must be a non empty lowercase string", c.ClusterID))
+	}
+	if c.TFBinaryName == "" {
+		errs = append(errs, errors.New("the terraform binary name can't be empty"))
+	}
+	return errors.Join(errs...)
+}
+
+// CleanAtTheEnd returns whether the resources must be destroyed at the end of the tests
+func (c *TestConfig) CleanAtTheEnd() bool {
+	return c.CleanClusterAtTheEnd == nil || *c.CleanClusterAtTheEnd
+}
+
+// String returns the effective configuration, one `key: value (ENV)` per line
+func (c *TestConfig) String() string {
+	values := []string{
+		c.ClusterID,
+		c.ClusterRegion,
+		c.StateBucket,
+		c.StateBucketRegion,
+		c.TFBinaryName,
+		strconv.FormatBool(c.CleanAtTheEnd()),
+		c.AwsProfile,
+	}
+	keys := []string{"cluster_id", "cluster_region", "state_bucket", "state_bucket_region", "tf_binary_name", "clean_cluster_at_the_end", "aws_profile"}
+
+	var sb strings.Builder
+	for i, key := range keys {
+		fmt.Fprintf(&sb, "%s: %s (%s)\n", key, values[i], testConfigEnv[i])
+	}
+	return sb.String()
+}
+
+// IsValidAwsRegion returns whether region has the format of an AWS region, e.g. eu-central-1
+func IsValidAwsRegion(region string) bool {
+	return awsRegionRegexp.MatchString(region)
+}
+
+// ValidateBucketName checks the general purpose S3 bucket naming rules
+func ValidateBucketName(name string) error {
+	switch {
+	case !bucketRegexp.MatchString(name):
+		return fmt.Errorf("invalid bucket name %q, it must be 3 to 63 lowercase letters, numbers, dots or hyphens and start and end with a letter or a number", name)
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("invalid bucket name %q, it can't contain two adjacent periods", name)
+	case strings.HasPrefix(name, "xn--") || strings.HasPrefix(name, "sthree-"):
+		return fmt.Errorf("invalid bucket name %q, the prefix is reserved", name)
+	case strings.HasSuffix(name, "-s3alias") || strings.HasSuffix(name, "--ol-s3"):
+		return fmt.Errorf("invalid bucket name %q, the suffix is reserved", name)
+	}
+	if addr, err := netip.ParseAddr(name); err == nil && addr.Is4() {
+		return fmt.Errorf("invalid bucket name %q, it can't be formatted as an IP address", name)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTestConfigDefaults(t *testing.T) {
+	cfg := &TestConfig{}
+	require.NoError(t, cfg.applyEnv([]string{"TESTS_CLUSTER_REGION=eu-west-1"}))
+	cfg.applyDefaults()
+
+	require.NoError(t, cfg.Validate())
+	assert.NotEmpty(t, cfg.ClusterID)
+	assert.Equal(t, "eu-west-1", cfg.ClusterRegion)
+	assert.Equal(t, "eu-west-1", cfg.StateBucketRegion)
+	assert.Equal(t, "tests-eks-tf-state-eu-west-1", cfg.StateBucket)
+	assert.Equal(t, "terraform", cfg.TFBinaryName)
+	assert.True(t, cfg.CleanAtTheEnd())
+	assert.Equal(t, "infex", cfg.AwsProfile)
+}
+
+func TestTestConfigEnvOverridesFile(t *testing.T) {
+	cfg := &TestConfig{}
+	require.NoError(t, decodeTestConfig([]byte(`
+cluster_id: fromfile
+cluster_region: eu-north-1
+tf_binary_name: tofu
+clean_cluster_at_the_end: false
+aws_profile: file-profile
+`), cfg))
+	require.NoError(t, cfg.applyEnv([]string{
+		"TESTS_CLUSTER_ID=fromenv",
+		"AWS_DEFAULT_PROFILE=default-profile",
+	}))
+	cfg.applyDefaults()
+
+	assert.Equal(t, "fromenv", cfg.ClusterID)
+	assert.Equal(t, "eu-north-1", cfg.ClusterRegion)
+	assert.Equal(t, "tofu", cfg.TFBinaryName)
+	assert.False(t, cfg.CleanAtTheEnd())
+	assert.Equal(t, "default-profile", cfg.AwsProfile)
+
+	require.NoError(t, cfg.applyEnv([]string{"AWS_PROFILE=profile", "AWS_DEFAULT_PROFILE=default-profile"}))
+	assert.Equal(t, "profile", cfg.AwsProfile)
+}
+
+func TestTestConfigRejectsUnknownKeys(t *testing.T) {
+	err := decodeTestConfig([]byte("cluster_regon: eu-west-1\n"), &TestConfig{})
+	assert.ErrorContains(t, err, "cluster_regon")
+
+	err = (&TestConfig{}).applyEnv([]string{"TESTS_CLUSTER_REGON=eu-west-1", "TESTS_CONFIG_FILE=config.yml"})
+	assert.ErrorContains(t, err, "TESTS_CLUSTER_REGON")
+}
+
+func TestTestConfigRejectsInvalidBoolean(t *testing.T) {
+	err := (&TestConfig{}).applyEnv([]string{"CLEAN_CLUSTER_AT_THE_END=yes"})
+	assert.ErrorContains(t, err, "CLEAN_CLUSTER_AT_THE_END")
+
+	err = decodeTestConfig([]byte("clean_cluster_at_the_end: maybe\n"), &TestConfig{})
+	assert.Error(t, err)
+}
+
+func TestTestConfigValidate(t *testing.T) {
+	cfg := &TestConfig{ClusterRegion: "eu-central", StateBucket: "My_Bucket"}
+	cfg.applyDefaults()
+
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, `invalid cluster region "eu-central"`)
+	assert.ErrorContains(t, err, `invalid state bucket region "eu-central"`)
+	assert.ErrorContains(t, err, `invalid bucket name "My_Bucket"`)
+}
+
+func TestLoadTestConfigFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte("cluster_id: myfile\nstate_bucket: my-bucket\n"), 0o600))
+	t.Setenv(TestsConfigFileEnv, path)
+	t.Setenv("TESTS_CLUSTER_ID", "myenv")
+
+	cfg, err := LoadTestConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "myenv", cfg.ClusterID)
+	assert.Equal(t, "my-bucket", cfg.StateBucket)
+	assert.Contains(t, cfg.String(), "state_bucket: my-bucket (TF_STATE_BUCKET)\n")
+}
+
+func TestIsValidAwsRegion(t *testing.T) {
+	for _, region := range []string{"eu-central-1", "us-east-2", "ap-southeast-4", "us-gov-west-1"} {
+		assert.Truef(t, IsValidAwsRegion(region), "region %s", region)
+	}
+	for _, region := range []string{"", "eu-central", "EU-CENTRAL-1", "eu_central_1", "europe-central-1"} {
+		assert.Falsef(t, IsValidAwsRegion(region), "region %s", region)
+	}
+}
+
+func TestValidateBucketName(t *testing.T) {
+	for _, name := range []string{"tests-eks-tf-state-eu-central-1", "my.bucket", "abc"} {
+		assert.NoErrorf(t, ValidateBucketName(name), "bucket %s", name)
+	}
+	for _, name := range []string{"ab", "-bucket", "bucket-", "Bucket", "my..bucket", "192.168.5.4", "xn--bucket", "bucket-s3alias"} {
+		assert.Errorf(t, ValidateBucketName(name), "bucket %s", name)
+	}
+}
@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ModuleFixtures maps each module of modules/ to the name of its fixture, fixtures/fixtures.default.<fixture>.tfvars
+var ModuleFixtures = map[string]string{
+	"eks-cluster": "eks",
+	"aurora":      "aurora",
+	"opensearch":  "opensearch",
+}
+
+// ModuleVariable is a `variable` block of a module
+type ModuleVariable struct {
+	Name        string
+	Description string
+	HasDefault  bool
+	// Type is the type constraint of the variable, nil when the variable accepts any type
+	Type  hcl.Expression
+	Range hcl.Range
+}
+
+// ModuleOutput is an `output` block of a module
+type ModuleOutput struct {
+	Name        string
+	Description string
+	Range       hcl.Range
+}
+
+// Module is the static description of a terraform module parsed from its .tf files
+type Module struct {
+	Name      string
+	Dir       string
+	Variables map[string]*ModuleVariable
+	Outputs   map[string]*ModuleOutput
+	// References are the variables referenced outside their own `variable` block (var.<name>)
+	References map[string]struct{}
+}
+
+// ContractIssue is a breach of the contract of a module found by CheckModuleContract
+type ContractIssue struct {
+	Module  string
+	Range   hcl.Range
+	Message string
+}
+
+func (i ContractIssue) String() string {
+	if i.Range.Filename == "" {
+		return fmt.Sprintf("%s: %s", i.Module, i.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", i.Range.Filename, i.Range.Start.Line, i.Module, i.Message)
+}
+
+// LoadModule parses the .tf files of the module in dir, it does not require terraform nor network access
+func LoadModule(dir string) (*Module, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no terraform file in %s", dir)
+	}
+
+	module := &Module{
+		Name:       filepath.Base(dir),
+		Dir:        dir,
+		Variables:  make(map[string]*ModuleVariable),
+		Outputs:    make(map[string]*ModuleOutput),
+		References: make(map[string]struct{}),
+	}
+	for _, file := range files {
+		body, err := parseHCLBody(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, block := range body.Blocks {
+			switch {
+			case block.Type == "variable" && len(block.Labels) == 1:
+				module.Variables[block.Labels[0]] = parseVariableBlock(block)
+				continue
+			case block.Type == "output" && len(block.Labels) == 1:
+				module.Outputs[block.Labels[0]] = &ModuleOutput{
+					Name:        block.Labels[0],
+					Description: stringAttribute(block.Body, "description"),
+					Range:       block.DefRange(),
+				}
+			}
+			collectVariableReferences(block, module.References)
+		}
+	}
+	return module, nil
+}
+
+func parseHCLBody(file string) (*hclsyntax.Body, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	parsed, diags := hclsyntax.ParseConfig(content, file, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, diags)
+	}
+	return parsed.Body.(*hclsyntax.Body), nil
+}
+
+func parseVariableBlock(block *hclsyntax.Block) *ModuleVariable {
+	variable := &ModuleVariable{
+		Name:        block.Labels[0],
+		Description: stringAttribute(block.Body, "description"),
+		Range:       block.DefRange(),
+	}
+	_, variable.HasDefault = block.Body.Attributes["default"]
+	if typeAttribute, ok := block.Body.Attributes["type"]; ok {
+		variable.Type = typeAttribute.Expr
+	}
+	return variable
+}
+
+// stringAttribute returns the value of a literal string attribute of body, empty if it is not set or not a literal
+func stringAttribute(body *hclsyntax.Body, name string) string {
+	attribute, ok := body.Attributes[name]
+	if !ok {
+		return ""
+	}
+	value, diags := attribute.Expr.Value(nil)
+	if diags.HasErrors() || !value.Type().Equals(cty.String) || value.IsNull() {
+		return ""
+	}
+	return value.AsString()
+}
+
+func collectVariableReferences(node hclsyntax.Node, references map[string]struct{}) {
+	_ = hclsyntax.VisitAll(node, func(node hclsyntax.Node) hcl.Diagnostics {
+		expr, ok := node.(*hclsyntax.ScopeTraversalExpr)
+		if !ok || len(expr.Traversal) < 2 || expr.Traversal.RootName() != "var" {
+			return nil
+		}
+		if attribute, ok := expr.Traversal[1].(hcl.TraverseAttr); ok {
+			references[attribute.Name] = struct{}{}
+		}
+		return nil
+	})
+}
+
+// RequiredVariables returns the sorted names of the variables of the module without default value
+func (m *Module) RequiredVariables() []string {
+	var names []string
+	for name, variable := range m.Variables {
+		if !variable.HasDefault {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTfvars parses the top level attributes of a .tfvars file, without evaluating them
+func LoadTfvars(file string) (map[string]*hclsyntax.Attribute, error) {
+	body, err := parseHCLBody(file)
+	if err != nil {
+		return nil, err
+	}
+	return body.Attributes, nil
+}
+
+// CheckModuleContract checks the module against the conventions of the repository:
+//   - every variable without default is set by DestroyVars, otherwise the cleanup cannot destroy the module,
+//   - every variable set by DestroyVars and by the fixture of the module is declared by the module,
+//   - every output has a description,
+//   - every variable is referenced by the module.
+func CheckModuleContract(modulesDir, moduleName string) ([]ContractIssue, error) {
+	module, err := LoadModule(filepath.Join(modulesDir, moduleName))
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []ContractIssue
+	report := func(r hcl.Range, format string, args ...interface{}) {
+		issues = append(issues, ContractIssue{Module: moduleName, Range: r, Message: fmt.Sprintf(format, args...)})
+	}
+
+	destroyVars, ok := DestroyVars(moduleName, "contract", "eu-central-1")
+	if !ok {
+		report(hcl.Range{}, "the module is not handled by DestroyVars in test/src/utils/reaper.go")
+	}
+	for _, name := range module.RequiredVariables() {
+		if _, ok := destroyVars[name]; !ok {
+			report(module.Variables[name].Range, "variable %q has no default and is not set by DestroyVars in test/src/utils/reaper.go", name)
+		}
+	}
+	for _, name := range sortedKeys(destroyVars) {
+		if _, ok := module.Variables[name]; !ok {
+			report(hcl.Range{}, "DestroyVars sets %q which is not a variable of the module", name)
+		}
+	}
+
+	fixture, ok := ModuleFixtures[moduleName]
+	if !ok {
+		report(hcl.Range{}, "the module has no fixture in ModuleFixtures")
+	} else {
+		fixtureFile := filepath.Join(modulesDir, "fixtures", fmt.Sprintf("fixtures.default.%s.tfvars", fixture))
+		attributes, err := LoadTfvars(fixtureFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range sortedKeys(attributes) {
+			if _, ok := module.Variables[name]; !ok {
+				report(attributes[name].SrcRange, "the fixture sets %q which is not a variable of the module", name)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(module.Outputs) {
+		if strings.TrimSpace(module.Outputs[name].Description) == "" {
+			report(module.Outputs[name].Range, "output %q has no description", name)
+		}
+	}
+
+	for _, name := range sortedKeys(module.Variables) {
+		if _, ok := module.References[name]; !ok {
+			report(module.Variables[name].Range, "variable %q is declared but never referenced", name)
+		}
+	}
+	return issues, nil
+}
+
+// CheckModulesContract checks the contract of every module of modulesDir, see CheckModuleContract
+func CheckModulesContract(modulesDir string) ([]ContractIssue, error) {
+	entries, err := os.ReadDir(modulesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []ContractIssue
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "fixtures" {
+			continue
+		}
+		moduleName := entry.Name()
+		moduleIssues, err := CheckModuleContract(modulesDir, moduleName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check the module %s: %w", moduleName, err)
+		}
+		issues = append(issues, moduleIssues...)
+	}
+	return issues, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestModulesContract fails with the report of CheckModulesContract when a module of the repository breaks its contract
+func TestModulesContract(t *testing.T) {
+	issues, err := CheckModulesContract(testModulesDir)
+	require.NoError(t, err)
+
+	var report []string
+	for _, issue := range issues {
+		report = append(report, issue.String())
+	}
+	assert.Emptyf(t, issues, "the modules break their contract:\n%s", strings.Join(report, "\n"))
+}
+
+func writeModuleFiles(t *testing.T, files map[string]string) string {
+	modulesDir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(modulesDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return modulesDir
+}
+
+func TestLoadModule(t *testing.T) {
+	modulesDir := writeModuleFiles(t, map[string]string{
+		"aurora/variables.tf": `
+variable "cluster_name" {
+  type        = string
+  description = "Name of the cluster"
+}
+
+variable "engine" {
+  default = "aurora-postgresql"
+
+  validation {
+    condition     = var.engine != ""
+    error_message = "engine must be set"
+  }
+}
+`,
+		"aurora/main.tf": `
+resource "aws_rds_cluster" "this" {
+  cluster_identifier = "${var.cluster_name}-cluster"
+}
+
+output "id" {
+  value       = aws_rds_cluster.this.id
+  description = "ID of the cluster"
+}
+`,
+	})
+
+	module, err := LoadModule(filepath.Join(modulesDir, "aurora"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"cluster_name"}, module.RequiredVariables())
+	assert.Equal(t, "Name of the cluster", module.Variables["cluster_name"].Description)
+	assert.NotNil(t, module.Variables["cluster_name"].Type)
+	assert.Nil(t, module.Variables["engine"].Type)
+	assert.Equal(t, "ID of the cluster", module.Outputs["id"].Description)
+	assert.Contains(t, module.References, "cluster_name")
+	// a reference in the validation of the variable itself is not a use of the variable
+	assert.NotContains(t, module.References, "engine")
+}
+
+func TestCheckModuleContract(t *testing.T) {
+	modulesDir := writeModuleFiles(t, map[string]string{
+		"aurora/variables.tf": `
+variable "cluster_name" {}
+variable "username" {}
+variable "engine_mode" {}
+variable "unused" {
+  default = "x"
+}
+`,
+		"aurora/main.tf": `
+resource "aws_rds_cluster" "this" {
+  cluster_identifier = var.cluster_name
+  master_username    = var.username
+  engine_mode        = var.engine_mode
+}
+
+output "id" {
+  value = aws_rds_cluster.this.id
+}
+`,
+		"fixtures/fixtures.default.aurora.tfvars": `
+tags = {}
+engine_mode = "provisioned"
+`,
+	})
+
+	issues, err := CheckModuleContract(modulesDir, "aurora")
+	require.NoError(t, err)
+
+	var messages []string
+	for _, issue := range issues {
+		messages = append(messages, issue.Message)
+	}
+	assert.Equal(t, []string{
+		`variable "engine_mode" has no default and is not set by DestroyVars in test/src/utils/reaper.go`,
+		`DestroyVars sets "cidr_blocks" which is not a variable of the module`,
+		`DestroyVars sets "password" which is not a variable of the module`,
+		`DestroyVars sets "subnet_ids" which is not a variable of the module`,
+		`DestroyVars sets "vpc_id" which is not a variable of the module`,
+		`the fixture sets "tags" which is not a variable of the module`,
+		`output "id" has no description`,
+		`variable "unused" is declared but never referenced`,
+	}, messages)
+
+	assert.Equal(t, filepath.Join(modulesDir, "aurora", "variables.tf"), issues[0].Range.Filename)
+	assert.Equal(t, 4, issues[0].Range.Start.Line)
+	assert.Contains(t, issues[0].String(), "variables.tf:4: aurora: ")
+}
+
+func TestCheckModulesContractFlagsUnknownModules(t *testing.T) {
+	modulesDir := writeModuleFiles(t, map[string]string{
+		"new-module/main.tf": `resource "null_resource" "this" {}`,
+		"fixtures/README.md": "fixtures",
+	})
+
+	issues, err := CheckModulesContract(modulesDir)
+	require.NoError(t, err)
+
+	require.Len(t, issues, 2)
+	assert.Equal(t, "new-module: the module is not handled by DestroyVars in test/src/utils/reaper.go", issues[0].String())
+	assert.Equal(t, "new-module: the module has no fixture in ModuleFixtures", issues[1].String())
+}
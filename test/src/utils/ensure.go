@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// EnsureFieldManager is the field manager of the server-side applies of the Ensure helpers
+const EnsureFieldManager = "camunda-tf-eks-module-tests"
+
+// EnsureResult reports what an Ensure helper changed to reach the desired state
+type EnsureResult struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Created   bool
+	// Recreated is set when the object has been deleted and created again because an immutable field changed
+	Recreated bool
+	// Changes lists the labels, annotations and keys that were added, updated or removed.
+	// The values of the data of the ConfigMaps and Secrets are never reported.
+	Changes []string
+}
+
+// Changed returns true if the object has been created or modified
+func (r EnsureResult) Changed() bool {
+	return r.Created || r.Recreated || len(r.Changes) > 0
+}
+
+func (r EnsureResult) String() string {
+	name := r.Name
+	if r.Namespace != "" {
+		name = r.Namespace + "/" + r.Name
+	}
+	switch {
+	case r.Created:
+		return fmt.Sprintf("%s %s created", r.Kind, name)
+	case r.Recreated:
+		return fmt.Sprintf("%s %s recreated: %s", r.Kind, name, strings.Join(r.Changes, ", "))
+	case len(r.Changes) > 0:
+		return fmt.Sprintf("%s %s updated: %s", r.Kind, name, strings.Join(r.Changes, ", "))
+	default:
+		return fmt.Sprintf("%s %s unchanged", r.Kind, name)
+	}
+}
+
+// EnsureNamespace applies the labels and annotations of the namespace
+func EnsureNamespace(ctx context.Context, clientSet kubernetes.Interface, namespace *corev1.Namespace) (EnsureResult, error) {
+	client := clientSet.CoreV1().Namespaces()
+	return ensure(ctx, "Namespace", namespace.ObjectMeta,
+		func(ctx context.Context) (*corev1.Namespace, error) {
+			return client.Get(ctx, namespace.Name, metav1.GetOptions{})
+		},
+		func(ctx context.Context) (*corev1.Namespace, error) {
+			config, err := applyConfiguration(corev1ac.Namespace(namespace.Name), &corev1.Namespace{ObjectMeta: desiredMeta(namespace.ObjectMeta)})
+			if err != nil {
+				return nil, err
+			}
+			return client.Apply(ctx, config, applyOptions())
+		},
+		nil,
+	)
+}
+
+// EnsureServiceAccount applies the labels and annotations of the service account,
+// e.g. the eks.amazonaws.com/role-arn annotation left by a previous run is replaced by the desired one
+func EnsureServiceAccount(ctx context.Context, clientSet kubernetes.Interface, serviceAccount *corev1.ServiceAccount) (EnsureResult, error) {
+	client := clientSet.CoreV1().ServiceAccounts(serviceAccount.Namespace)
+	return ensure(ctx, "ServiceAccount", serviceAccount.ObjectMeta,
+		func(ctx context.Context) (*corev1.ServiceAccount, error) {
+			return client.Get(ctx, serviceAccount.Name, metav1.GetOptions{})
+		},
+		func(ctx context.Context) (*corev1.ServiceAccount, error) {
+			config, err := applyConfiguration(corev1ac.ServiceAccount(serviceAccount.Name, serviceAccount.Namespace), &corev1.ServiceAccount{ObjectMeta: desiredMeta(serviceAccount.ObjectMeta)})
+			if err != nil {
+				return nil, err
+			}
+			return client.Apply(ctx, config, applyOptions())
+		},
+		nil,
+	)
+}
+
+// EnsureConfigMap applies the labels, annotations and data of the ConfigMap
+func EnsureConfigMap(ctx context.Context, clientSet kubernetes.Interface, configMap *corev1.ConfigMap) (EnsureResult, error) {
+	client := clientSet.CoreV1().ConfigMaps(configMap.Namespace)
+	return ensure(ctx, "ConfigMap", configMap.ObjectMeta,
+		func(ctx context.Context) (*corev1.ConfigMap, error) {
+			return client.Get(ctx, configMap.Name, metav1.GetOptions{})
+		},
+		func(ctx context.Context) (*corev1.ConfigMap, error) {
+			desired := &corev1.ConfigMap{ObjectMeta: desiredMeta(configMap.ObjectMeta), Data: configMap.Data, BinaryData: configMap.BinaryData}
+			config, err := applyConfiguration(corev1ac.ConfigMap(configMap.Name, configMap.Namespace), desired)
+			if err != nil {
+				return nil, err
+			}
+			return client.Apply(ctx, config, applyOptions())
+		},
+		func(existing, applied *corev1.ConfigMap) []string {
+			changes := diffKeys("data", existing.Data, applied.Data)
+			return append(changes, diffKeys("binaryData", existing.BinaryData, applied.BinaryData)...)
+		},
+	)
+}
+
+// EnsureSecret applies the labels, annotations and data of the Secret, its StringData is applied as Data
+func EnsureSecret(ctx context.Context, clientSet kubernetes.Interface, secret *corev1.Secret) (EnsureResult, error) {
+	client := clientSet.CoreV1().Secrets(secret.Namespace)
+	return ensure(ctx, "Secret", secret.ObjectMeta,
+		func(ctx context.Context) (*corev1.Secret, error) {
+			return client.Get(ctx, secret.Name, metav1.GetOptions{})
+		},
+		func(ctx context.Context) (*corev1.Secret, error) {
+			// stringData is write-only, the applied data are compared to the stored ones
+			data := maps.Clone(secret.Data)
+			if data == nil && len(secret.StringData) > 0 {
+				data = make(map[string][]byte, len(secret.StringData))
+			}
+			for key, value := range secret.StringData {
+				data[key] = []byte(value)
+			}
+			desired := &corev1.Secret{ObjectMeta: desiredMeta(secret.ObjectMeta), Type: secret.Type, Data: data}
+			config, err := applyConfiguration(corev1ac.Secret(secret.Name, secret.Namespace), desired)
+			if err != nil {
+				return nil, err
+			}
+			return client.Apply(ctx, config, applyOptions())
+		},
+		func(existing, applied *corev1.Secret) []string {
+			return diffKeys("data", existing.Data, applied.Data)
+		},
+	)
+}
+
+// EnsureJob applies the job, its pod template is immutable: when it changed, the job and its pods are deleted and the job is applied again
+func EnsureJob(ctx context.Context, clientSet kubernetes.Interface, job *batchv1.Job) (EnsureResult, error) {
+	client := clientSet.BatchV1().Jobs(job.Namespace)
+	apply := func(ctx context.Context) (*batchv1.Job, error) {
+		desired := &batchv1.Job{ObjectMeta: desiredMeta(job.ObjectMeta), Spec: job.Spec}
+		config, err := applyConfiguration(batchv1ac.Job(job.Name, job.Namespace), desired)
+		if err != nil {
+			return nil, err
+		}
+		return client.Apply(ctx, config, applyOptions())
+	}
+	diffSpec := func(existing, applied *batchv1.Job) []string {
+		if !equality.Semantic.DeepDerivative(job.Spec.Template.Spec, existing.Spec.Template.Spec) {
+			return []string{"spec.template changed"}
+		}
+		return nil
+	}
+
+	result, err := ensure(ctx, "Job", job.ObjectMeta,
+		func(ctx context.Context) (*batchv1.Job, error) {
+			return client.Get(ctx, job.Name, metav1.GetOptions{})
+		},
+		apply, diffSpec,
+	)
+	if err == nil || !apierrors.IsInvalid(err) {
+		return result, err
+	}
+
+	// the pod template of a job cannot be updated
+	if err := deletePreviousJobs(ctx, clientSet, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: job.Name, Namespace: job.Namespace}}); err != nil {
+		return result, err
+	}
+	if _, err := apply(ctx); err != nil {
+		return result, fmt.Errorf("failed to apply the Job %s/%s: %w", job.Namespace, job.Name, err)
+	}
+	return EnsureResult{Kind: "Job", Namespace: job.Namespace, Name: job.Name, Recreated: true, Changes: []string{"spec.template changed"}}, nil
+}
+
+// ensure applies the object and reports the differences of its labels, annotations and of diff with the existing object
+func ensure[T metav1.Object](ctx context.Context, kind string, meta metav1.ObjectMeta, get func(context.Context) (T, error), apply func(context.Context) (T, error), diff func(existing, applied T) []string) (EnsureResult, error) {
+	result := EnsureResult{Kind: kind, Namespace: meta.Namespace, Name: meta.Name}
+	name := meta.Name
+	if meta.Namespace != "" {
+		name = meta.Namespace + "/" + meta.Name
+	}
+
+	existing, err := get(ctx)
+	found := err == nil
+	if err != nil && !IsNotFound(err) {
+		return result, fmt.Errorf("failed to get the %s %s: %w", kind, name, err)
+	}
+
+	applied, err := apply(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to apply the %s %s: %w", kind, name, err)
+	}
+
+	if !found {
+		result.Created = true
+		return result, nil
+	}
+	result.Changes = append(diffKeys("label", existing.GetLabels(), applied.GetLabels()), diffKeys("annotation", existing.GetAnnotations(), applied.GetAnnotations())...)
+	if diff != nil {
+		result.Changes = append(result.Changes, diff(existing, applied)...)
+	}
+	return result, nil
+}
+
+// diffKeys describes the keys added, updated or removed between two maps, e.g. "label app added"
+func diffKeys[V any](field string, existing, applied map[string]V) []string {
+	var changes []string
+	for _, key := range slices.Sorted(maps.Keys(applied)) {
+		previous, found := existing[key]
+		switch {
+		case !found:
+			changes = append(changes, fmt.Sprintf("%s %s added", field, key))
+		case !equality.Semantic.DeepEqual(previous, applied[key]):
+			changes = append(changes, fmt.Sprintf("%s %s updated", field, key))
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(existing)) {
+		if _, found := applied[key]; !found {
+			changes = append(changes, fmt.Sprintf("%s %s removed", field, key))
+		}
+	}
+	return changes
+}
+
+// desiredMeta keeps the fields of the metadata managed by the Ensure helpers
+func desiredMeta(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: meta.Name, Namespace: meta.Namespace, Labels: meta.Labels, Annotations: meta.Annotations}
+}
+
+// applyConfiguration fills the apply configuration, which sets the kind and the apiVersion, with the fields of the typed object
+func applyConfiguration[T any](config *T, desired any) (*T, error) {
+	data, err := json.Marshal(desired)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to build the apply configuration: %w", err)
+	}
+	return config, nil
+}
+
+// applyOptions forces the ownership of the applied fields, the values set by other managers (e.g. a previous run using Create) are replaced
+func applyOptions() metav1.ApplyOptions {
+	return metav1.ApplyOptions{FieldManager: EnsureFieldManager, Force: true}
+}
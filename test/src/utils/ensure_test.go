@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"testing"
+)
+
+const roleAnnotation = "eks.amazonaws.com/role-arn"
+
+func TestEnsureServiceAccountReconcilesTheRole(t *testing.T) {
+	ctx := context.Background()
+	// the service account has been created by a previous run with another role
+	clientSet := fake.NewClientset(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:        "aurora-access-sa",
+		Namespace:   "aurora",
+		Annotations: map[string]string{roleAnnotation: "arn:aws:iam::123456789012:role/AuroraRole-previous-run"},
+	}})
+	desired := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:        "aurora-access-sa",
+		Namespace:   "aurora",
+		Labels:      map[string]string{"app": "aurora"},
+		Annotations: map[string]string{roleAnnotation: "arn:aws:iam::123456789012:role/AuroraRole-cluster-rds"},
+	}}
+
+	result, err := EnsureServiceAccount(ctx, clientSet, desired)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"label app added", "annotation eks.amazonaws.com/role-arn updated"}, result.Changes)
+	assert.Equal(t, "ServiceAccount aurora/aurora-access-sa updated: label app added, annotation eks.amazonaws.com/role-arn updated", result.String())
+
+	serviceAccount, err := clientSet.CoreV1().ServiceAccounts("aurora").Get(ctx, "aurora-access-sa", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, desired.Annotations, serviceAccount.Annotations)
+	assert.Equal(t, desired.Labels, serviceAccount.Labels)
+
+	// a rerun changes nothing
+	result, err = EnsureServiceAccount(ctx, clientSet, desired)
+	require.NoError(t, err)
+	assert.False(t, result.Changed())
+	assert.Equal(t, "ServiceAccount aurora/aurora-access-sa unchanged", result.String())
+}
+
+func TestEnsureNamespace(t *testing.T) {
+	ctx := context.Background()
+	clientSet := fake.NewClientset()
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "aurora", Labels: map[string]string{"app": "aurora", "run": "1"}}}
+
+	result, err := EnsureNamespace(ctx, clientSet, namespace)
+	require.NoError(t, err)
+	assert.True(t, result.Created)
+	assert.Equal(t, "Namespace aurora created", result.String())
+
+	// the labels no longer desired are removed
+	namespace.Labels = map[string]string{"app": "aurora"}
+	result, err = EnsureNamespace(ctx, clientSet, namespace)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"label run removed"}, result.Changes)
+
+	existing, err := clientSet.CoreV1().Namespaces().Get(ctx, "aurora", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"app": "aurora"}, existing.Labels)
+}
+
+func TestEnsureConfigMapAndSecret(t *testing.T) {
+	ctx := context.Background()
+	clientSet := fake.NewClientset(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "aurora-config", Namespace: "aurora"}, Data: map[string]string{"aurora_endpoint": "old", "aurora_port": "5432"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "aurora-secret", Namespace: "aurora"}, Data: map[string][]byte{"aurora_password": []byte("old")}},
+	)
+
+	result, err := EnsureConfigMap(ctx, clientSet, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "aurora-config", Namespace: "aurora"},
+		Data:       map[string]string{"aurora_endpoint": "aurora.cluster.local", "aurora_port": "5432", "aws_region": "eu-central-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data aurora_endpoint updated", "data aws_region added"}, result.Changes)
+
+	result, err = EnsureSecret(ctx, clientSet, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "aurora-secret", Namespace: "aurora"},
+		StringData: map[string]string{"aurora_password": "new-password"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data aurora_password updated"}, result.Changes)
+	// the values of the secrets are not reported
+	assert.NotContains(t, result.String(), "new-password")
+
+	secret, err := clientSet.CoreV1().Secrets("aurora").Get(ctx, "aurora-secret", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new-password"), secret.Data["aurora_password"])
+}
+
+func TestEnsureJobRecreatesImmutableTemplates(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	ctx := context.Background()
+	job := newTestJob("postgres-client")
+	job.Namespace = "aurora"
+	clientSet := fake.NewClientset()
+
+	result, err := EnsureJob(ctx, clientSet, job)
+	require.NoError(t, err)
+	assert.True(t, result.Created)
+
+	result, err = EnsureJob(ctx, clientSet, job)
+	require.NoError(t, err)
+	assert.False(t, result.Changed())
+
+	// the API server rejects the update of the pod template of an existing job
+	rejected := false
+	clientSet.PrependReactor("patch", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if _, err := clientSet.Tracker().Get(batchv1.SchemeGroupVersion.WithResource("jobs"), "aurora", "postgres-client"); err == nil && !rejected {
+			rejected = true
+			return true, nil, apierrors.NewInvalid(batchv1.SchemeGroupVersion.WithKind("Job").GroupKind(), "postgres-client", field.ErrorList{
+				field.Invalid(field.NewPath("spec", "template"), nil, "field is immutable"),
+			})
+		}
+		return false, nil, nil
+	})
+	job.Spec.Template.Spec.Containers[0].Image = "postgres:16"
+
+	result, err = EnsureJob(ctx, clientSet, job)
+	require.NoError(t, err)
+	assert.True(t, result.Recreated)
+	assert.Equal(t, "Job aurora/postgres-client recreated: spec.template changed", result.String())
+
+	updated, err := clientSet.BatchV1().Jobs("aurora").Get(ctx, "postgres-client", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "postgres:16", updated.Spec.Template.Spec.Containers[0].Image)
+}
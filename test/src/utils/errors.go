@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	"io"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// The predicates of this file classify the errors of the AWS SDK (by error code, see AwsErrorCode)
+// and of the kubernetes client the same way, so the idempotent helpers and the retry loops share one behavior.
+// They see through the wrapping of fmt.Errorf("...: %w", err) and errors.Join.
+
+// accessDeniedCodes are the error codes of the AWS services denying an operation to the caller
+var accessDeniedCodes = map[string]struct{}{
+	"AccessDenied":          {},
+	"AccessDeniedException": {},
+	"UnauthorizedOperation": {},
+	"AuthorizationError":    {},
+}
+
+// notFoundCodes are the error codes of the AWS services for a missing resource
+var notFoundCodes = map[string]struct{}{
+	"NotFound":                  {},
+	"NotFoundException":         {},
+	"NoSuchEntity":              {},
+	"NoSuchBucket":              {},
+	"NoSuchKey":                 {},
+	"ResourceNotFoundException": {},
+	"DBClusterNotFoundFault":    {},
+}
+
+// alreadyExistsCodes are the error codes of the AWS services for a resource created twice
+var alreadyExistsCodes = map[string]struct{}{
+	"AlreadyExistsException":         {},
+	"EntityAlreadyExists":            {},
+	"BucketAlreadyOwnedByYou":        {},
+	"ResourceAlreadyExistsException": {},
+	"DBClusterAlreadyExistsFault":    {},
+}
+
+// retryableStatusCodes are the HTTP status codes of the transient errors of the AWS services
+var retryableStatusCodes = map[int]struct{}{
+	http.StatusInternalServerError: {},
+	http.StatusBadGateway:          {},
+	http.StatusServiceUnavailable:  {},
+	http.StatusGatewayTimeout:      {},
+}
+
+// AwsErrorCode returns the error code of the AWS API error wrapped by err (e.g. AccessDeniedException), or "" for other errors
+func AwsErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+// awsStatusCode returns the HTTP status code of the AWS response of err, or 0 for other errors
+func awsStatusCode(err error) int {
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.HTTPStatusCode()
+	}
+	return 0
+}
+
+func hasAwsErrorCode(err error, codes map[string]struct{}) bool {
+	_, ok := codes[AwsErrorCode(err)]
+	return ok
+}
+
+// IsNotFound reports whether err is an AWS or kubernetes error for a missing resource,
+// an AWS response without error code is classified by its 404 status
+func IsNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	return hasAwsErrorCode(err, notFoundCodes) || apierrors.IsNotFound(err) ||
+		(AwsErrorCode(err) == "" && awsStatusCode(err) == http.StatusNotFound)
+}
+
+// IsAccessDenied reports whether err is an AWS or kubernetes error denying the operation to the caller
+func IsAccessDenied(err error) bool {
+	if err == nil {
+		return false
+	}
+	return hasAwsErrorCode(err, accessDeniedCodes) || apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err)
+}
+
+// IsThrottled reports whether err is an AWS throttling error (the codes retried by the SDK) or a kubernetes 429
+func IsThrottled(err error) bool {
+	if err == nil {
+		return false
+	}
+	return hasAwsErrorCode(err, retry.DefaultThrottleErrorCodes) || apierrors.IsTooManyRequests(err)
+}
+
+// IsAlreadyExists reports whether err is an AWS or kubernetes error for a resource created twice
+func IsAlreadyExists(err error) bool {
+	if err == nil {
+		return false
+	}
+	return hasAwsErrorCode(err, alreadyExistsCodes) || apierrors.IsAlreadyExists(err)
+}
+
+// IsRetryable reports whether err is transient: throttling, 5xx responses of AWS, server timeouts and unavailability
+// of the kubernetes API, network timeouts and reset connections. WaitFor keeps polling on these errors.
+func IsRetryable(err error) bool {
+	// the context errors are net.Error timeouts, they end the retries
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if IsThrottled(err) || hasAwsErrorCode(err, retry.DefaultRetryableErrorCodes) {
+		return true
+	}
+	if _, ok := retryableStatusCodes[awsStatusCode(err)]; ok {
+		return true
+	}
+	if apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsServiceUnavailable(err) || apierrors.IsInternalError(err) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
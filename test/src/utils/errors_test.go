@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+	"io"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// awsError returns an error wrapped like the errors of the SDK
+func awsError(code string) error {
+	return fmt.Errorf("operation error KMS: DescribeKey: %w", &smithy.GenericAPIError{Code: code, Message: "message"})
+}
+
+// awsResponseError returns an error of the SDK for a response without error code
+func awsResponseError(statusCode int) error {
+	return &smithy.OperationError{ServiceID: "S3", OperationName: "HeadBucket", Err: &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}}, Err: errors.New("http error")},
+	}}
+}
+
+var namespaces = schema.GroupResource{Resource: "namespaces"}
+
+func TestAwsErrorCode(t *testing.T) {
+	assert.Equal(t, "AccessDeniedException", AwsErrorCode(awsError("AccessDeniedException")))
+	assert.Equal(t, "", AwsErrorCode(errors.New("not an AWS error")))
+	assert.Equal(t, "", AwsErrorCode(nil))
+}
+
+func TestErrorPredicates(t *testing.T) {
+	tests := []struct {
+		name      string
+		predicate func(error) bool
+		matches   []error
+		others    []error
+	}{
+		{
+			name:      "IsNotFound",
+			predicate: IsNotFound,
+			matches: []error{
+				awsError("NotFoundException"), awsError("NoSuchEntity"), awsError("ResourceNotFoundException"),
+				awsResponseError(http.StatusNotFound),
+				apierrors.NewNotFound(namespaces, "aurora"),
+				fmt.Errorf("failed to get the namespace: %w", apierrors.NewNotFound(namespaces, "aurora")),
+			},
+			others: []error{nil, awsError("AccessDeniedException"), awsResponseError(http.StatusForbidden), apierrors.NewForbidden(namespaces, "aurora", nil)},
+		},
+		{
+			name:      "IsAccessDenied",
+			predicate: IsAccessDenied,
+			matches: []error{
+				awsError("AccessDeniedException"), awsError("AccessDenied"), awsError("UnauthorizedOperation"),
+				apierrors.NewForbidden(namespaces, "aurora", errors.New("rbac")), apierrors.NewUnauthorized("token expired"),
+			},
+			others: []error{nil, awsError("ValidationException"), apierrors.NewNotFound(namespaces, "aurora")},
+		},
+		{
+			name:      "IsThrottled",
+			predicate: IsThrottled,
+			matches:   []error{awsError("ThrottlingException"), awsError("Throttling"), awsError("TooManyRequestsException"), apierrors.NewTooManyRequests("slow down", 1)},
+			others:    []error{nil, awsError("ValidationException"), apierrors.NewInternalError(errors.New("boom"))},
+		},
+		{
+			name:      "IsAlreadyExists",
+			predicate: IsAlreadyExists,
+			matches:   []error{awsError("EntityAlreadyExists"), awsError("BucketAlreadyOwnedByYou"), apierrors.NewAlreadyExists(namespaces, "aurora")},
+			others:    []error{nil, awsError("NotFoundException"), apierrors.NewConflict(namespaces, "aurora", errors.New("conflict"))},
+		},
+		{
+			name:      "IsRetryable",
+			predicate: IsRetryable,
+			matches: []error{
+				awsError("ThrottlingException"), awsError("RequestTimeout"), awsResponseError(http.StatusServiceUnavailable),
+				apierrors.NewTooManyRequests("slow down", 1), apierrors.NewServerTimeout(namespaces, "get", 1),
+				apierrors.NewServiceUnavailable("starting"), apierrors.NewInternalError(errors.New("etcd")),
+				fmt.Errorf("read: %w", syscall.ECONNRESET), io.ErrUnexpectedEOF,
+			},
+			others: []error{
+				nil, awsError("AccessDeniedException"), awsResponseError(http.StatusBadRequest),
+				apierrors.NewNotFound(namespaces, "aurora"), context.DeadlineExceeded, context.Canceled, errors.New("boom"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, err := range tt.matches {
+				assert.Truef(t, tt.predicate(err), "%v", err)
+				assert.Truef(t, tt.predicate(errors.Join(errors.New("other"), err)), "joined %v", err)
+			}
+			for _, err := range tt.others {
+				assert.Falsef(t, tt.predicate(err), "%v", err)
+			}
+		})
+	}
+}
+
+func TestWaitForRetriesRetryableErrors(t *testing.T) {
+	attempts := 0
+	err := WaitFor(context.Background(), fastWaitOptions(time.Second), func(ctx context.Context) (bool, error) {
+		attempts++
+		if attempts < 3 {
+			return false, apierrors.NewServiceUnavailable("starting")
+		}
+		return true, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	err = WaitFor(context.Background(), fastWaitOptions(20*time.Millisecond), func(ctx context.Context) (bool, error) {
+		return false, awsError("ThrottlingException")
+	})
+	var timeoutErr *TimeoutError
+	assert.ErrorAs(t, err, &timeoutErr)
+	assert.True(t, IsThrottled(timeoutErr.LastError))
+	assert.Contains(t, err.Error(), "last error")
+}
@@ -1,10 +1,8 @@
 package utils
 
 import (
-	"fmt"
+	"github.com/camunda/camunda-tf-eks-module/utils/version"
 	"os"
-	"strconv"
-	"strings"
 )
 
 func GetEnv(key, fallback string) string {
@@ -15,19 +13,12 @@ func GetEnv(key, fallback string) string {
 	return value
 }
 
-func IncrementMinorVersionTwoParts(version string) (string, error) {
-	parts := strings.Split(version, ".")
-
-	if len(parts) != 2 {
-		return "", fmt.Errorf("invalid version format, expected 2 parts got %d", len(parts))
-	}
-
-	minor, err := strconv.Atoi(parts[1])
+// IncrementMinorVersionTwoParts returns the next minor version in the "<major>.<minor>" format, e.g. "1.30" for "1.29" or "v1.29.3",
+// see PlanEKSUpgradePath to go through several minor versions
+func IncrementMinorVersionTwoParts(versionValue string) (string, error) {
+	parsed, err := version.Parse(version.EKS, versionValue)
 	if err != nil {
 		return "", err
 	}
-
-	newVersion := fmt.Sprintf("%s.%d", parts[0], minor+1)
-
-	return newVersion, nil
+	return parsed.NextMinor().String(), nil
 }
@@ -0,0 +1,177 @@
+package iampolicy
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Decision is the result of the evaluation of a request by a policy document
+type Decision string
+
+// Decisions of Evaluate, an explicit deny overrides any allow and a request allowed by no statement is implicitly denied
+const (
+	Allowed      Decision = "Allowed"
+	ExplicitDeny Decision = "ExplicitDeny"
+	ImplicitDeny Decision = "ImplicitDeny"
+)
+
+// Request is the request evaluated by a policy document
+type Request struct {
+	// Principal maps the type of the principal (e.g. Federated) to its identifier, it is only matched by the statements with a Principal (trust policies)
+	Principal map[string]string
+	Action    string
+	// Resource is only matched by the statements with a Resource (access policies)
+	Resource string
+	// Context holds the values of the condition keys, e.g. <oidc provider>:sub
+	Context map[string]string
+}
+
+// AssumeRoleWithWebIdentityRequest returns the request of a kubernetes service account assuming a role through IRSA
+func AssumeRoleWithWebIdentityRequest(accountID, oidcProviderID, namespace, serviceAccount string) Request {
+	return Request{
+		Principal: map[string]string{PrincipalFederated: OIDCProviderARN(accountID, oidcProviderID)},
+		Action:    "sts:AssumeRoleWithWebIdentity",
+		Context: map[string]string{
+			fmt.Sprintf("%s:sub", oidcProviderID): ServiceAccountSubject(namespace, serviceAccount),
+			fmt.Sprintf("%s:aud", oidcProviderID): "sts.amazonaws.com",
+		},
+	}
+}
+
+// ParseEncoded decodes a URL encoded policy document, as returned by the IAM API (e.g. AssumeRolePolicyDocument of GetRole)
+func ParseEncoded(policy string) (Document, error) {
+	decoded, err := url.PathUnescape(policy)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to decode the policy document: %w", err)
+	}
+	return Parse(decoded)
+}
+
+// Evaluate returns the decision of the document for the request, it fails on a condition operator it does not support.
+// Only the subset of the policy language used by the modules is supported: Allow/Deny, wildcards (* and ?)
+// in the actions, resources and principals, and the StringEquals/StringLike conditions.
+func (d Document) Evaluate(request Request) (Decision, error) {
+	decision := ImplicitDeny
+	for i, statement := range d.Statement {
+		matches, err := statement.matches(request)
+		if err != nil {
+			return ImplicitDeny, fmt.Errorf("statement %d: %w", i, err)
+		}
+		if !matches {
+			continue
+		}
+
+		switch statement.Effect {
+		case Deny:
+			return ExplicitDeny, nil
+		case Allow:
+			decision = Allowed
+		default:
+			return ImplicitDeny, fmt.Errorf("statement %d: invalid effect %q", i, statement.Effect)
+		}
+	}
+	return decision, nil
+}
+
+// Allows returns whether the document allows the request, an evaluation error denies it
+func (d Document) Allows(request Request) bool {
+	decision, err := d.Evaluate(request)
+	return err == nil && decision == Allowed
+}
+
+func (s Statement) matches(request Request) (bool, error) {
+	// actions are case insensitive, resources and principals are not
+	if !slices.ContainsFunc(s.Action, func(pattern string) bool {
+		return matchWildcard(strings.ToLower(pattern), strings.ToLower(request.Action))
+	}) {
+		return false, nil
+	}
+
+	if len(s.Resource) > 0 && !slices.ContainsFunc(s.Resource, func(pattern string) bool {
+		return matchWildcard(pattern, request.Resource)
+	}) {
+		return false, nil
+	}
+
+	if len(s.Principal) > 0 && !s.Principal.matches(request.Principal) {
+		return false, nil
+	}
+
+	return s.Condition.matches(request.Context)
+}
+
+func (p Principal) matches(principal map[string]string) bool {
+	for principalType, patterns := range p {
+		identifier, ok := principal[principalType]
+		if !ok {
+			continue
+		}
+		if slices.ContainsFunc(patterns, func(pattern string) bool { return matchWildcard(pattern, identifier) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionOperators are the supported condition operators
+var conditionOperators = map[string]func(pattern, value string) bool{
+	StringEquals: func(pattern, value string) bool { return pattern == value },
+	StringLike:   matchWildcard,
+}
+
+// matches returns whether every condition is met, a condition on a key missing from the context is not met
+func (c Condition) matches(context map[string]string) (bool, error) {
+	for operator := range c {
+		if _, ok := conditionOperators[operator]; !ok {
+			return false, fmt.Errorf("unsupported condition operator %q", operator)
+		}
+	}
+
+	for operator, keys := range c {
+		match := conditionOperators[operator]
+		for key, patterns := range keys {
+			value, ok := contextValue(context, key)
+			if !ok || !slices.ContainsFunc(patterns, func(pattern string) bool { return match(pattern, value) }) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// contextValue returns the value of the condition key, the keys are case insensitive
+func contextValue(context map[string]string, key string) (string, bool) {
+	for contextKey, value := range context {
+		if strings.EqualFold(contextKey, key) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// matchWildcard matches value against a pattern where * matches any sequence of characters and ? any character
+func matchWildcard(pattern, value string) bool {
+	p, v := 0, 0
+	starPattern, starValue := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			starPattern, starValue = p, v
+			p++
+		case starPattern >= 0:
+			starValue++
+			p, v = starPattern+1, starValue
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,90 @@
+package iampolicy
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+func TestMatchWildcard(t *testing.T) {
+	assert.True(t, matchWildcard("*", ""))
+	assert.True(t, matchWildcard("es:ESHttp*", "es:ESHttpGet"))
+	assert.True(t, matchWildcard("arn:aws:rds-db:eu-central-1:123456789012:dbuser:*/myirsauser", "arn:aws:rds-db:eu-central-1:123456789012:dbuser:cluster-ABC/myirsauser"))
+	assert.True(t, matchWildcard("system:serviceaccount:aurora:aurora-?ccess-*", "system:serviceaccount:aurora:aurora-access-sa"))
+	assert.False(t, matchWildcard("es:ESHttp*", "es:CreateDomain"))
+	assert.False(t, matchWildcard("arn:aws:rds-db:eu-central-1:123456789012:dbuser:*/myirsauser", "arn:aws:rds-db:eu-central-1:123456789012:dbuser:cluster-ABC/admin"))
+	assert.False(t, matchWildcard("a?", "a"))
+}
+
+func TestIRSATrustPolicyEvaluation(t *testing.T) {
+	policy := IRSATrustPolicy("123456789012", oidcProviderID, "aurora", "aurora-access-sa")
+
+	assert.True(t, policy.Allows(AssumeRoleWithWebIdentityRequest("123456789012", oidcProviderID, "aurora", "aurora-access-sa")))
+
+	decision, err := policy.Evaluate(AssumeRoleWithWebIdentityRequest("123456789012", oidcProviderID, "aurora", "other-sa"))
+	require.NoError(t, err)
+	assert.Equal(t, ImplicitDeny, decision)
+	assert.False(t, policy.Allows(AssumeRoleWithWebIdentityRequest("123456789012", oidcProviderID, "default", "aurora-access-sa")))
+	// the OIDC provider of another cluster or account
+	assert.False(t, policy.Allows(AssumeRoleWithWebIdentityRequest("123456789012", "oidc.eks.eu-central-1.amazonaws.com/id/OTHER", "aurora", "aurora-access-sa")))
+	assert.False(t, policy.Allows(AssumeRoleWithWebIdentityRequest("210987654321", oidcProviderID, "aurora", "aurora-access-sa")))
+
+	request := AssumeRoleWithWebIdentityRequest("123456789012", oidcProviderID, "aurora", "aurora-access-sa")
+	request.Action = "sts:AssumeRole"
+	assert.False(t, policy.Allows(request))
+}
+
+func TestAccessPoliciesEvaluation(t *testing.T) {
+	rdsPolicy := RDSConnectPolicy("eu-central-1", "123456789012", "myirsauser")
+	assert.True(t, rdsPolicy.Allows(Request{Action: "rds-db:connect", Resource: "arn:aws:rds-db:eu-central-1:123456789012:dbuser:cluster-ABCDEFGHIJ/myirsauser"}))
+	assert.True(t, rdsPolicy.Allows(Request{Action: "RDS-DB:Connect", Resource: "arn:aws:rds-db:eu-central-1:123456789012:dbuser:cluster-ABCDEFGHIJ/myirsauser"}))
+	assert.False(t, rdsPolicy.Allows(Request{Action: "rds-db:connect", Resource: "arn:aws:rds-db:eu-central-1:123456789012:dbuser:cluster-ABCDEFGHIJ/adminuser"}))
+	assert.False(t, rdsPolicy.Allows(Request{Action: "rds:DeleteDBCluster", Resource: "arn:aws:rds-db:eu-central-1:123456789012:dbuser:cluster-ABCDEFGHIJ/myirsauser"}))
+
+	osPolicy := OpenSearchHTTPPolicy("eu-central-1", "123456789012", "os-test")
+	assert.True(t, osPolicy.Allows(Request{Action: "es:ESHttpGet", Resource: "arn:aws:es:eu-central-1:123456789012:domain/os-test/_cluster/health"}))
+	assert.False(t, osPolicy.Allows(Request{Action: "es:ESHttpDelete", Resource: "arn:aws:es:eu-central-1:123456789012:domain/os-test/index"}))
+	assert.False(t, osPolicy.Allows(Request{Action: "es:ESHttpGet", Resource: "arn:aws:es:eu-central-1:123456789012:domain/other/index"}))
+}
+
+func TestEvaluateExplicitDeny(t *testing.T) {
+	policy := NewDocument(
+		Statement{Effect: Allow, Action: Values{"es:*"}, Resource: Values{"*"}},
+		Statement{Effect: Deny, Action: Values{"es:ESHttpDelete"}, Resource: Values{"*"}},
+	)
+
+	decision, err := policy.Evaluate(Request{Action: "es:ESHttpDelete", Resource: "arn:aws:es:eu-central-1:123456789012:domain/os-test/index"})
+	require.NoError(t, err)
+	assert.Equal(t, ExplicitDeny, decision)
+	assert.True(t, policy.Allows(Request{Action: "es:ESHttpGet", Resource: "arn:aws:es:eu-central-1:123456789012:domain/os-test/index"}))
+}
+
+func TestEvaluateConditions(t *testing.T) {
+	policy := NewDocument(Statement{
+		Effect:    Allow,
+		Principal: Principal{PrincipalFederated: {OIDCProviderARN("123456789012", oidcProviderID)}},
+		Action:    Values{"sts:AssumeRoleWithWebIdentity"},
+		Condition: Condition{
+			StringLike:   {oidcProviderID + ":sub": {"system:serviceaccount:aurora:*"}},
+			StringEquals: {oidcProviderID + ":aud": {"sts.amazonaws.com"}},
+		},
+	})
+	assert.True(t, policy.Allows(AssumeRoleWithWebIdentityRequest("123456789012", oidcProviderID, "aurora", "any-sa")))
+	assert.False(t, policy.Allows(AssumeRoleWithWebIdentityRequest("123456789012", oidcProviderID, "opensearch", "any-sa")))
+
+	request := AssumeRoleWithWebIdentityRequest("123456789012", oidcProviderID, "aurora", "any-sa")
+	delete(request.Context, oidcProviderID+":aud")
+	assert.False(t, policy.Allows(request), "a missing condition key does not meet the condition")
+
+	policy.Statement[0].Condition["ArnLike"] = map[string]Values{"aws:SourceArn": {"*"}}
+	_, err := policy.Evaluate(AssumeRoleWithWebIdentityRequest("123456789012", oidcProviderID, "aurora", "any-sa"))
+	assert.ErrorContains(t, err, `unsupported condition operator "ArnLike"`)
+}
+
+func TestParseEncoded(t *testing.T) {
+	policy := IRSATrustPolicy("123456789012", oidcProviderID, "aurora", "aurora-access-sa")
+	parsed, err := ParseEncoded(url.PathEscape(policy.String()))
+	require.NoError(t, err)
+	assert.Equal(t, policy, parsed)
+}
@@ -0,0 +1,198 @@
+// Package iampolicy provides typed IAM policy documents and builders for the policies used by the tests
+// (IRSA trust policies, rds-db:connect and es:ESHttp* access policies), so the JSON is never formatted by hand.
+package iampolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Version is the version of the policy language
+const Version = "2012-10-17"
+
+// Effect of a statement
+const (
+	Allow = "Allow"
+	Deny  = "Deny"
+)
+
+// Condition operators supported by the builders and the evaluator
+const (
+	StringEquals = "StringEquals"
+	StringLike   = "StringLike"
+)
+
+// Principal types
+const (
+	PrincipalAWS       = "AWS"
+	PrincipalFederated = "Federated"
+	PrincipalService   = "Service"
+)
+
+// Values is a list of strings serialized as a single string when it has one element, like the IAM JSON
+type Values []string
+
+// MarshalJSON serializes a single value as a string
+func (v Values) MarshalJSON() ([]byte, error) {
+	if len(v) == 1 {
+		return json.Marshal(v[0])
+	}
+	return json.Marshal([]string(v))
+}
+
+// UnmarshalJSON accepts a string or a list of strings
+func (v *Values) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*v = Values{single}
+		return nil
+	}
+
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("expected a string or a list of strings: %w", err)
+	}
+	*v = values
+	return nil
+}
+
+// Principal maps a principal type (AWS, Federated, Service) to its identifiers, "*" is decoded as {"AWS": "*"}
+type Principal map[string]Values
+
+// UnmarshalJSON accepts the "*" principal
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		if wildcard != "*" {
+			return fmt.Errorf("invalid principal %q", wildcard)
+		}
+		*p = Principal{PrincipalAWS: {"*"}}
+		return nil
+	}
+
+	principal := make(map[string]Values)
+	if err := json.Unmarshal(data, &principal); err != nil {
+		return err
+	}
+	*p = principal
+	return nil
+}
+
+// Condition maps a condition operator (e.g. StringEquals) to the expected values of each condition key
+type Condition map[string]map[string]Values
+
+// Statement is a statement of a policy document
+type Statement struct {
+	Sid       string    `json:"Sid,omitempty"`
+	Effect    string    `json:"Effect"`
+	Principal Principal `json:"Principal,omitempty"`
+	Action    Values    `json:"Action"`
+	Resource  Values    `json:"Resource,omitempty"`
+	Condition Condition `json:"Condition,omitempty"`
+}
+
+// Document is an IAM policy document
+type Document struct {
+	Version   string      `json:"Version"`
+	Statement []Statement `json:"Statement"`
+}
+
+// NewDocument returns a policy document of the current version with the statements
+func NewDocument(statements ...Statement) Document {
+	return Document{Version: Version, Statement: statements}
+}
+
+// Parse decodes a policy document
+func Parse(policy string) (Document, error) {
+	var document Document
+	if err := json.Unmarshal([]byte(policy), &document); err != nil {
+		return Document{}, fmt.Errorf("failed to parse the policy document: %w", err)
+	}
+	return document, nil
+}
+
+// String returns the compact JSON of the document
+func (d Document) String() string {
+	// the types of the document are always serializable
+	content, _ := json.Marshal(d)
+	return string(content)
+}
+
+// hclEscaper escapes a string nested in the HCL generated by terratest for terraform.Options.Vars,
+// terratest quotes the nested strings without escaping them
+var hclEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "${", "$${", "%{", "%%{")
+
+// TerraformString returns the compact JSON of the document escaped to be nested in a list or a map of terraform.Options.Vars,
+// e.g. in iam_roles_with_policies
+func (d Document) TerraformString() string {
+	return hclEscaper.Replace(d.String())
+}
+
+// RoleWithPolicies returns an element of the iam_roles_with_policies variable of the aurora and opensearch modules
+func RoleWithPolicies(roleName string, trustPolicy, accessPolicy Document) map[string]interface{} {
+	return map[string]interface{}{
+		"role_name":     roleName,
+		"trust_policy":  trustPolicy.TerraformString(),
+		"access_policy": accessPolicy.TerraformString(),
+	}
+}
+
+// ServiceAccountSubject returns the subject of the tokens of a kubernetes service account
+func ServiceAccountSubject(namespace, serviceAccount string) string {
+	return fmt.Sprintf("system:serviceaccount:%s:%s", namespace, serviceAccount)
+}
+
+// OIDCProviderARN returns the ARN of the IAM OIDC provider of an EKS cluster,
+// oidcProviderID is the issuer without scheme, e.g. oidc.eks.<region>.amazonaws.com/id/<id>
+func OIDCProviderARN(accountID, oidcProviderID string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:oidc-provider/%s", accountID, oidcProviderID)
+}
+
+// IRSATrustPolicy allows the service account of the namespace to assume the role through the OIDC provider of the cluster
+func IRSATrustPolicy(accountID, oidcProviderID, namespace, serviceAccount string) Document {
+	return NewDocument(Statement{
+		Effect:    Allow,
+		Principal: Principal{PrincipalFederated: {OIDCProviderARN(accountID, oidcProviderID)}},
+		Action:    Values{"sts:AssumeRoleWithWebIdentity"},
+		Condition: Condition{
+			StringEquals: {
+				fmt.Sprintf("%s:sub", oidcProviderID): {ServiceAccountSubject(namespace, serviceAccount)},
+			},
+		},
+	})
+}
+
+// RDSDBUserARN returns the ARN of a database user of every Aurora instance (dbuser:*) for the IAM authentication
+func RDSDBUserARN(region, accountID, dbUser string) string {
+	return fmt.Sprintf("arn:aws:rds-db:%s:%s:dbuser:*/%s", region, accountID, dbUser)
+}
+
+// RDSConnectPolicy allows to connect to the Aurora instances as dbUser with the IAM authentication
+func RDSConnectPolicy(region, accountID, dbUser string) Document {
+	return NewDocument(Statement{
+		Effect:   Allow,
+		Action:   Values{"rds-db:connect"},
+		Resource: Values{RDSDBUserARN(region, accountID, dbUser)},
+	})
+}
+
+// OpenSearchDomainARN returns the ARN of the paths of an OpenSearch domain
+func OpenSearchDomainARN(region, accountID, domainName string) string {
+	return fmt.Sprintf("arn:aws:es:%s:%s:domain/%s/*", region, accountID, domainName)
+}
+
+// DefaultOpenSearchHTTPActions are the HTTP methods allowed by OpenSearchHTTPPolicy when no action is given
+var DefaultOpenSearchHTTPActions = []string{"es:ESHttpGet", "es:ESHttpPut", "es:ESHttpPost"}
+
+// OpenSearchHTTPPolicy allows the es:ESHttp* actions (DefaultOpenSearchHTTPActions by default) on the paths of the domain
+func OpenSearchHTTPPolicy(region, accountID, domainName string, actions ...string) Document {
+	if len(actions) == 0 {
+		actions = DefaultOpenSearchHTTPActions
+	}
+	return NewDocument(Statement{
+		Effect:   Allow,
+		Action:   append(Values{}, actions...),
+		Resource: Values{OpenSearchDomainARN(region, accountID, domainName)},
+	})
+}
@@ -0,0 +1,96 @@
+package iampolicy
+
+import (
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	"strings"
+	"testing"
+)
+
+const oidcProviderID = "oidc.eks.eu-central-1.amazonaws.com/id/EXAMPLED539D4633E53DE1B71EXAMPLE"
+
+func TestIRSATrustPolicy(t *testing.T) {
+	policy := IRSATrustPolicy("123456789012", oidcProviderID, "aurora", "aurora-access-sa")
+
+	assert.JSONEq(t, `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Principal": {
+        "Federated": "arn:aws:iam::123456789012:oidc-provider/oidc.eks.eu-central-1.amazonaws.com/id/EXAMPLED539D4633E53DE1B71EXAMPLE"
+      },
+      "Action": "sts:AssumeRoleWithWebIdentity",
+      "Condition": {
+        "StringEquals": {
+          "oidc.eks.eu-central-1.amazonaws.com/id/EXAMPLED539D4633E53DE1B71EXAMPLE:sub": "system:serviceaccount:aurora:aurora-access-sa"
+        }
+      }
+    }
+  ]
+}`, policy.String())
+}
+
+func TestAccessPolicies(t *testing.T) {
+	assert.JSONEq(t, `{
+  "Version": "2012-10-17",
+  "Statement": [{"Effect": "Allow", "Action": "rds-db:connect", "Resource": "arn:aws:rds-db:eu-central-1:123456789012:dbuser:*/myirsauser"}]
+}`, RDSConnectPolicy("eu-central-1", "123456789012", "myirsauser").String())
+
+	assert.JSONEq(t, `{
+  "Version": "2012-10-17",
+  "Statement": [{
+    "Effect": "Allow",
+    "Action": ["es:ESHttpGet", "es:ESHttpPut", "es:ESHttpPost"],
+    "Resource": "arn:aws:es:eu-central-1:123456789012:domain/os-test/*"
+  }]
+}`, OpenSearchHTTPPolicy("eu-central-1", "123456789012", "os-test").String())
+
+	policy := OpenSearchHTTPPolicy("eu-central-1", "123456789012", "os-test", "es:ESHttp*")
+	assert.Equal(t, Values{"es:ESHttp*"}, policy.Statement[0].Action)
+}
+
+func TestParse(t *testing.T) {
+	document, err := Parse(`{"Version": "2012-10-17", "Statement": [{"Effect": "Deny", "Principal": "*", "Action": ["s3:*"], "Resource": "*"}]}`)
+	require.NoError(t, err)
+	assert.Equal(t, Principal{PrincipalAWS: {"*"}}, document.Statement[0].Principal)
+	assert.Equal(t, Values{"s3:*"}, document.Statement[0].Action)
+
+	policy := IRSATrustPolicy("123456789012", oidcProviderID, "aurora", "aurora-access-sa")
+	parsed, err := Parse(policy.String())
+	require.NoError(t, err)
+	assert.Equal(t, policy, parsed)
+
+	_, err = Parse(`{"Statement": [{"Principal": "someone"}]}`)
+	assert.Error(t, err)
+}
+
+// TestRoleWithPoliciesTerraformVar checks that the policies are read back unchanged by terraform from the HCL of terratest
+func TestRoleWithPoliciesTerraformVar(t *testing.T) {
+	trustPolicy := IRSATrustPolicy("123456789012", oidcProviderID, "aurora", "aurora-access-sa")
+	accessPolicy := NewDocument(Statement{
+		Effect:   Allow,
+		Action:   Values{"s3:GetObject"},
+		Resource: Values{`arn:aws:s3:::bucket/${aws:username}/\path`},
+	})
+
+	args := terraform.FormatTerraformVarsAsArgs(map[string]interface{}{
+		"iam_roles_with_policies": []interface{}{RoleWithPolicies("AuroraRole", trustPolicy, accessPolicy)},
+	})
+	require.Len(t, args, 2)
+	_, hclValue, _ := strings.Cut(args[1], "=")
+
+	expr, diags := hclsyntax.ParseExpression([]byte(hclValue), "vars", hcl.InitialPos)
+	require.False(t, diags.HasErrors(), diags.Error())
+	value, diags := expr.Value(nil)
+	require.False(t, diags.HasErrors(), diags.Error())
+
+	role := value.Index(cty.NumberIntVal(0))
+	assert.Equal(t, "AuroraRole", role.GetAttr("role_name").AsString())
+	assert.Equal(t, trustPolicy.String(), role.GetAttr("trust_policy").AsString())
+	assert.Equal(t, accessPolicy.String(), role.GetAttr("access_policy").AsString())
+}
@@ -0,0 +1,311 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/opensearch"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"sort"
+	"strings"
+)
+
+// Types of the resources of an Inventory
+const (
+	ResourceVpc              = "vpc"
+	ResourceEKSCluster       = "eks-cluster"
+	ResourceEKSNodegroup     = "eks-nodegroup"
+	ResourceRDSCluster       = "rds-cluster"
+	ResourceOpenSearchDomain = "opensearch-domain"
+	ResourceIAMRole          = "iam-role"
+	ResourceKMSKey           = "kms-key"
+	ResourceStateObject      = "s3-state"
+)
+
+// InventoryResource is a resource created by the tests
+type InventoryResource struct {
+	Type string `json:"type"`
+	// Name is the name matched against the prefixes: Name tag of the VPC, description of the KMS key, key of the state...
+	Name string `json:"name"`
+	ID   string `json:"id,omitempty"`
+}
+
+// Inventory lists the resources of the tests, its JSON is sorted and has no timestamp so two inventories can be diffed
+type Inventory struct {
+	Prefixes  []string            `json:"prefixes"`
+	Region    string              `json:"region"`
+	Resources []InventoryResource `json:"resources"`
+	// Errors are the sources that could not be listed, their resources are missing from the inventory
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// InventoryOptions configures ListInventory
+type InventoryOptions struct {
+	// Prefixes are the cluster names (or their prefix, e.g. cluster-rds) of the resources, a resource matches if its name
+	// contains one of them delimited by separators: postgres-<cluster>, <cluster>-ebs-cs-role... (see containsName)
+	Prefixes []string
+	// Bucket is the bucket of the terraform states, the states are not listed if it is empty
+	Bucket       string
+	BucketRegion string
+}
+
+// Count returns the number of resources of the inventory of the given type, all types if resourceType is empty
+func (i Inventory) Count(resourceType string) int {
+	count := 0
+	for _, resource := range i.Resources {
+		if resourceType == "" || resource.Type == resourceType {
+			count++
+		}
+	}
+	return count
+}
+
+// JSON returns the indented JSON of the inventory
+func (i Inventory) JSON() string {
+	content, _ := json.MarshalIndent(i, "", "  ")
+	return string(content)
+}
+
+func (o InventoryOptions) matches(name string) bool {
+	for _, prefix := range o.Prefixes {
+		if prefix != "" && containsName(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// nameSeparators delimit the cluster names in the names of the resources
+const nameSeparators = " -_./"
+
+func isNameSeparator(c byte) bool {
+	return strings.IndexByte(nameSeparators, c) >= 0
+}
+
+// containsName reports whether name contains clusterName delimited by separators or by the bounds of name,
+// e.g. cluster-rds-1 matches postgres-cluster-rds-1 and cluster-rds-1-vpc but neither cluster-rds-10 nor mycluster-rds-1
+func containsName(name, clusterName string) bool {
+	for offset := 0; offset < len(name); {
+		index := strings.Index(name[offset:], clusterName)
+		if index < 0 {
+			return false
+		}
+		start, end := offset+index, offset+index+len(clusterName)
+		startsName := start == 0 || isNameSeparator(name[start-1]) || isNameSeparator(clusterName[0])
+		endsName := end == len(name) || isNameSeparator(name[end]) || isNameSeparator(clusterName[len(clusterName)-1])
+		if startsName && endsName {
+			return true
+		}
+		offset = start + 1
+	}
+	return false
+}
+
+// inventorySource lists the resources of a type matching the options
+type inventorySource struct {
+	name string
+	list func(ctx context.Context, sess aws.Config, opts InventoryOptions) ([]InventoryResource, error)
+}
+
+var inventorySources = []inventorySource{
+	{"ec2:DescribeVpcs", listVpcs},
+	{"eks:ListClusters", listEKSClusters},
+	{"rds:DescribeDBClusters", listRDSClusters},
+	{"opensearch:ListDomainNames", listOpenSearchDomains},
+	{"iam:ListRoles", listIAMRoles},
+	{"kms:ListKeys", listKMSKeys},
+	{"s3:ListObjectsV2", listStateResources},
+}
+
+// ListInventory lists the resources of the region of sess whose name contains one of the prefixes (see InventoryOptions).
+// A source that cannot be listed (e.g. access denied) is reported in Inventory.Errors and in the returned error,
+// the resources of the other sources are still returned.
+func ListInventory(ctx context.Context, sess aws.Config, opts InventoryOptions) (Inventory, error) {
+	inventory := Inventory{
+		Prefixes:  append([]string(nil), opts.Prefixes...),
+		Region:    sess.Region,
+		Resources: []InventoryResource{},
+	}
+	sort.Strings(inventory.Prefixes)
+
+	var errs []error
+	for _, source := range inventorySources {
+		resources, err := source.list(ctx, sess, opts)
+		if err != nil {
+			if inventory.Errors == nil {
+				inventory.Errors = make(map[string]string)
+			}
+			inventory.Errors[source.name] = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", source.name, err))
+			continue
+		}
+		inventory.Resources = append(inventory.Resources, resources...)
+	}
+
+	sort.Slice(inventory.Resources, func(i, j int) bool {
+		a, b := inventory.Resources[i], inventory.Resources[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+	return inventory, errors.Join(errs...)
+}
+
+func listVpcs(ctx context.Context, sess aws.Config, opts InventoryOptions) ([]InventoryResource, error) {
+	var resources []InventoryResource
+	paginator := ec2.NewDescribeVpcsPaginator(ec2.NewFromConfig(sess), &ec2.DescribeVpcsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, vpc := range page.Vpcs {
+			name := ec2TagValue(vpc.Tags, "Name")
+			if opts.matches(name) {
+				resources = append(resources, InventoryResource{Type: ResourceVpc, Name: name, ID: aws.ToString(vpc.VpcId)})
+			}
+		}
+	}
+	return resources, nil
+}
+
+func ec2TagValue(tags []ec2types.Tag, key string) string {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
+
+// listEKSClusters lists the clusters and their node groups, the node groups are named <cluster>/<node group>
+func listEKSClusters(ctx context.Context, sess aws.Config, opts InventoryOptions) ([]InventoryResource, error) {
+	client := eks.NewFromConfig(sess)
+
+	var resources []InventoryResource
+	paginator := eks.NewListClustersPaginator(client, &eks.ListClustersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, clusterName := range page.Clusters {
+			if !opts.matches(clusterName) {
+				continue
+			}
+			resources = append(resources, InventoryResource{Type: ResourceEKSCluster, Name: clusterName})
+
+			nodegroupsPaginator := eks.NewListNodegroupsPaginator(client, &eks.ListNodegroupsInput{ClusterName: aws.String(clusterName)})
+			for nodegroupsPaginator.HasMorePages() {
+				nodegroupsPage, err := nodegroupsPaginator.NextPage(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("failed to list the node groups of %s: %w", clusterName, err)
+				}
+				for _, nodegroup := range nodegroupsPage.Nodegroups {
+					resources = append(resources, InventoryResource{Type: ResourceEKSNodegroup, Name: fmt.Sprintf("%s/%s", clusterName, nodegroup)})
+				}
+			}
+		}
+	}
+	return resources, nil
+}
+
+func listRDSClusters(ctx context.Context, sess aws.Config, opts InventoryOptions) ([]InventoryResource, error) {
+	var resources []InventoryResource
+	paginator := rds.NewDescribeDBClustersPaginator(rds.NewFromConfig(sess), &rds.DescribeDBClustersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, cluster := range page.DBClusters {
+			if identifier := aws.ToString(cluster.DBClusterIdentifier); opts.matches(identifier) {
+				resources = append(resources, InventoryResource{Type: ResourceRDSCluster, Name: identifier})
+			}
+		}
+	}
+	return resources, nil
+}
+
+func listOpenSearchDomains(ctx context.Context, sess aws.Config, opts InventoryOptions) ([]InventoryResource, error) {
+	output, err := opensearch.NewFromConfig(sess).ListDomainNames(ctx, &opensearch.ListDomainNamesInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []InventoryResource
+	for _, domain := range output.DomainNames {
+		if name := aws.ToString(domain.DomainName); opts.matches(name) {
+			resources = append(resources, InventoryResource{Type: ResourceOpenSearchDomain, Name: name})
+		}
+	}
+	return resources, nil
+}
+
+func listIAMRoles(ctx context.Context, sess aws.Config, opts InventoryOptions) ([]InventoryResource, error) {
+	var resources []InventoryResource
+	paginator := iam.NewListRolesPaginator(iam.NewFromConfig(sess), &iam.ListRolesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range page.Roles {
+			if name := aws.ToString(role.RoleName); opts.matches(name) {
+				resources = append(resources, InventoryResource{Type: ResourceIAMRole, Name: name})
+			}
+		}
+	}
+	return resources, nil
+}
+
+// listKMSKeys lists the keys by description, the keys pending deletion are already deleted for the tests
+// and the keys the caller cannot describe are ignored
+func listKMSKeys(ctx context.Context, sess aws.Config, opts InventoryOptions) ([]InventoryResource, error) {
+	keys, err := NewKMSKeyFinder(kms.NewFromConfig(sess)).Find(ctx, KMSKeyFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []InventoryResource
+	for _, key := range keys {
+		if opts.matches(key.Description) {
+			resources = append(resources, InventoryResource{Type: ResourceKMSKey, Name: key.Description, ID: key.ID})
+		}
+	}
+	return resources, nil
+}
+
+func listStateResources(ctx context.Context, sess aws.Config, opts InventoryOptions) ([]InventoryResource, error) {
+	if opts.Bucket == "" {
+		return nil, nil
+	}
+
+	bucketSess := sess.Copy()
+	if opts.BucketRegion != "" {
+		bucketSess.Region = opts.BucketRegion
+	}
+	stateObjects, err := ListStateObjects(ctx, bucketSess, opts.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []InventoryResource
+	for _, stateObject := range stateObjects {
+		if opts.matches(stateObject.ClusterName) {
+			resources = append(resources, InventoryResource{Type: ResourceStateObject, Name: stateObject.Key})
+		}
+	}
+	return resources, nil
+}
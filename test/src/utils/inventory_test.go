@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"context"
+	"github.com/camunda/camunda-tf-eks-module/utils/awsfake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestListInventory(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddVpc(awsfake.Vpc{ID: "vpc-1", Tags: map[string]string{"Name": "cluster-rds-1-vpc"}})
+	server.AddVpc(awsfake.Vpc{ID: "vpc-2", Tags: map[string]string{"Name": "production"}})
+	server.AddCluster(awsfake.Cluster{Name: "cluster-rds-1", Version: "1.30", Nodegroups: []string{"services"}})
+	server.AddCluster(awsfake.Cluster{Name: "production", Version: "1.30", Nodegroups: []string{"services"}})
+	server.AddDBCluster(awsfake.DBCluster{Identifier: "postgres-cluster-rds-1", Engine: "aurora-postgresql"})
+	server.AddDomain(awsfake.Domain{Name: "domain-cluster-rds-1"})
+	server.AddRole(awsfake.Role{Name: "cluster-rds-1-cert-manager-role"})
+	server.AddRole(awsfake.Role{Name: "OrganizationAccountAccessRole"})
+	server.AddKMSKey(awsfake.KMSKey{ID: "key-1", Description: "cluster-rds-1 -  EKS Secret Encryption Key"})
+	server.AddKMSKey(awsfake.KMSKey{ID: "key-2", Description: "cluster-rds-0 -  EKS Secret Encryption Key", State: "PendingDeletion"})
+	server.AddBucket(awsfake.Bucket{
+		Name:   "tests-eks-tf-state",
+		Region: "eu-central-1",
+		Objects: map[string][]byte{
+			"terraform/cluster-rds-1/TestCustomEKSRDSTestSuite/eks-cluster/terraform.tfstate":      []byte("{}"),
+			"terraform/cluster-os-2/TestCustomEKSOpenSearchTestSuite/opensearch/terraform.tfstate": []byte("{}"),
+		},
+	})
+
+	inventory, err := ListInventory(context.Background(), sess, InventoryOptions{
+		Prefixes:     []string{"cluster-rds"},
+		Bucket:       "tests-eks-tf-state",
+		BucketRegion: "eu-central-1",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []InventoryResource{
+		{Type: ResourceEKSCluster, Name: "cluster-rds-1"},
+		{Type: ResourceEKSNodegroup, Name: "cluster-rds-1/services"},
+		{Type: ResourceIAMRole, Name: "cluster-rds-1-cert-manager-role"},
+		{Type: ResourceKMSKey, Name: "cluster-rds-1 -  EKS Secret Encryption Key", ID: "key-1"},
+		{Type: ResourceOpenSearchDomain, Name: "domain-cluster-rds-1"},
+		{Type: ResourceRDSCluster, Name: "postgres-cluster-rds-1"},
+		{Type: ResourceStateObject, Name: "terraform/cluster-rds-1/TestCustomEKSRDSTestSuite/eks-cluster/terraform.tfstate"},
+		{Type: ResourceVpc, Name: "cluster-rds-1-vpc", ID: "vpc-1"},
+	}, inventory.Resources)
+	assert.Equal(t, 1, inventory.Count(ResourceIAMRole))
+	assert.Equal(t, 8, inventory.Count(""))
+	assert.Empty(t, inventory.Errors)
+}
+
+func TestListInventoryEmpty(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddCluster(awsfake.Cluster{Name: "production", Version: "1.30"})
+
+	inventory, err := ListInventory(context.Background(), sess, InventoryOptions{Prefixes: []string{"cluster-test"}})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"prefixes": ["cluster-test"], "region": "eu-central-1", "resources": []}`, inventory.JSON())
+}
+
+func TestListInventoryReportsFailedSources(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddCluster(awsfake.Cluster{Name: "cluster-test-1", Version: "1.30"})
+	server.InjectFault("ListRoles", awsfake.AccessDenied())
+
+	inventory, err := ListInventory(context.Background(), sess, InventoryOptions{Prefixes: []string{"cluster-test"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "iam:ListRoles")
+
+	assert.Contains(t, inventory.Errors, "iam:ListRoles")
+	assert.Equal(t, 1, inventory.Count(ResourceEKSCluster))
+}
+
+func TestInventoryOptionsMatches(t *testing.T) {
+	opts := InventoryOptions{Prefixes: []string{"cluster-rds-1", "cl-os"}}
+	for name, expected := range map[string]bool{
+		"cluster-rds-1":                              true,
+		"postgres-cluster-rds-1":                     true,
+		"AuroraRole-cluster-rds-1":                   true,
+		"cluster-rds-1-vpc":                          true,
+		"cluster-rds-1 -  EKS Secret Encryption Key": true,
+		"terraform/cluster-rds-1/TestCustomEKSRDSTestSuite/aurora/terraform.tfstate": true,
+		"cl-os-2-cert-manager-role": true,
+		// other clusters whose name contains the cluster name
+		"cluster-rds-10":                false,
+		"postgres-cluster-rds-10":       false,
+		"mycluster-rds-1":               false,
+		"cluster-rds-upgrade-1":         false,
+		"OrganizationAccountAccessRole": false,
+	} {
+		assert.Equal(t, expected, opts.matches(name), name)
+	}
+
+	// a prefix ending with a separator matches the names starting with it
+	assert.True(t, InventoryOptions{Prefixes: []string{"cluster-rds-"}}.matches("postgres-cluster-rds-10"))
+}
@@ -0,0 +1,559 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultJobBackoffLimit is the backoffLimit of the jobs that do not define one, a probe is not retried by default
+const DefaultJobBackoffLimit int32 = 0
+
+const (
+	// jobDeletionTimeout bounds the deletion of the previous jobs of the same name
+	jobDeletionTimeout = 2 * time.Minute
+	// jobLogsGracePeriod is the time given to the log streams to reach the end of the logs once the job is finished
+	jobLogsGracePeriod = 30 * time.Second
+	// jobSummaryLogLines is the number of lines of logs of the failed containers reported by JobResult.Summary
+	jobSummaryLogLines = 20
+)
+
+// fatalWaitingReasons are the reasons of the waiting containers that will not start without a change of the job or its inputs
+var fatalWaitingReasons = []string{"ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError", "CreateContainerError"}
+
+// JobRun describes a job to run in the cluster with its inputs
+type JobRun struct {
+	Namespace string
+	Job       *batchv1.Job
+	// ConfigMaps and Secrets are the inputs of the job, they are applied before the job is created (see EnsureConfigMap)
+	ConfigMaps []*corev1.ConfigMap
+	Secrets    []*corev1.Secret
+	// Timeout bounds the execution of the job, the previous jobs of the same name or labels are deleted before
+	Timeout time.Duration
+	// LogOutput receives the logs of the containers while they run, each line is prefixed by pod/container (os.Stdout by default)
+	LogOutput io.Writer
+	// KeepResources keeps the job and its inputs in the cluster after the run
+	KeepResources bool
+}
+
+// ContainerResult is the final state of a container of a pod of the job
+type ContainerResult struct {
+	Name string
+	// ExitCode is the exit code of the terminated container, -1 if it did not terminate
+	ExitCode int32
+	// Reason is the reason of the termination (Completed, Error, OOMKilled) or of the wait (ImagePullBackOff)
+	Reason   string
+	Message  string
+	Restarts int32
+	Logs     string
+}
+
+// Failed returns true if the container terminated with a non zero exit code or is stuck waiting
+func (c ContainerResult) Failed() bool {
+	if c.ExitCode == -1 {
+		return slices.Contains(fatalWaitingReasons, c.Reason)
+	}
+	return c.ExitCode != 0
+}
+
+func (c ContainerResult) String() string {
+	var state string
+	if c.ExitCode == -1 {
+		state = fmt.Sprintf("waiting (%s)", c.Reason)
+	} else {
+		state = fmt.Sprintf("exited with code %d (%s)", c.ExitCode, c.Reason)
+	}
+	if c.Message != "" {
+		state = fmt.Sprintf("%s: %s", state, c.Message)
+	}
+	return state
+}
+
+// JobPodResult is the final state of a pod of the job
+type JobPodResult struct {
+	Name       string
+	Phase      corev1.PodPhase
+	Containers []ContainerResult
+}
+
+// JobResult is the outcome of RunJob
+type JobResult struct {
+	Name      string
+	Namespace string
+	Succeeded bool
+	Pods      []JobPodResult
+	// Events are the events of the job and its pods, formatted as "<type> <reason> <kind>/<name>: <message>"
+	Events []string
+}
+
+// FailureReasons lists the failed containers of the pods of the job, e.g. "postgres-client-x/postgres-client exited with code 1 (Error)"
+func (r JobResult) FailureReasons() []string {
+	var reasons []string
+	for _, pod := range r.Pods {
+		for _, container := range pod.Containers {
+			if container.Failed() {
+				reasons = append(reasons, fmt.Sprintf("%s/%s %s", pod.Name, container.Name, container))
+			}
+		}
+	}
+	return reasons
+}
+
+// Summary describes the pods, the containers and the events of the job with the last lines of logs of the failed containers
+func (r JobResult) Summary() string {
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "job %s/%s succeeded=%t\n", r.Namespace, r.Name, r.Succeeded)
+	for _, pod := range r.Pods {
+		fmt.Fprintf(&summary, "  pod %s: %s\n", pod.Name, pod.Phase)
+		for _, container := range pod.Containers {
+			fmt.Fprintf(&summary, "    container %s: %s, %d restarts\n", container.Name, container, container.Restarts)
+			if container.Failed() && container.Logs != "" {
+				for _, line := range lastLines(container.Logs, jobSummaryLogLines) {
+					fmt.Fprintf(&summary, "      | %s\n", line)
+				}
+			}
+		}
+	}
+	if len(r.Events) > 0 {
+		summary.WriteString("  events:\n")
+		for _, event := range r.Events {
+			fmt.Fprintf(&summary, "    %s\n", event)
+		}
+	}
+	return summary.String()
+}
+
+// lastLines returns the last count lines of logs
+func lastLines(logs string, count int) []string {
+	lines := strings.Split(strings.TrimRight(logs, "\n"), "\n")
+	return lines[max(0, len(lines)-count):]
+}
+
+// LoadJobManifest decodes the Job of a YAML manifest, e.g. a fixture of modules/fixtures
+func LoadJobManifest(path string) (*batchv1.Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the manifest %s: %w", path, err)
+	}
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return nil, fmt.Errorf("the manifest %s contains a %T, not a Job", path, obj)
+	}
+	return job, nil
+}
+
+// RunJob applies the inputs and replaces the previous jobs of the run, creates the job and waits until it completes or fails.
+// The logs of the containers are streamed to LogOutput while the job runs, the result reports the exit codes,
+// the logs and the events of the pods, it is returned even when the job fails.
+// The job fails as soon as a container cannot start (ImagePullBackOff, CreateContainerConfigError...) or its backoffLimit is exceeded.
+// Unless KeepResources is set, the job and its inputs are deleted at the end of the run.
+func RunJob(ctx context.Context, clientSet kubernetes.Interface, run JobRun) (result JobResult, err error) {
+	job := run.Job.DeepCopy()
+	job.Namespace = run.Namespace
+	if job.Spec.BackoffLimit == nil {
+		backoffLimit := DefaultJobBackoffLimit
+		job.Spec.BackoffLimit = &backoffLimit
+	}
+	result = JobResult{Name: job.Name, Namespace: run.Namespace}
+	description := fmt.Sprintf("job %s/%s", run.Namespace, job.Name)
+
+	if !run.KeepResources {
+		defer func() {
+			err = errors.Join(err, cleanupJobRun(context.WithoutCancel(ctx), clientSet, job, run))
+		}()
+	}
+
+	if err := applyJobInputs(ctx, clientSet, run); err != nil {
+		return result, err
+	}
+	if err := deletePreviousJobs(ctx, clientSet, job); err != nil {
+		return result, err
+	}
+
+	created, err := clientSet.BatchV1().Jobs(run.Namespace).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return result, fmt.Errorf("failed to create the %s: %w", description, err)
+	}
+
+	selector := jobPodSelector(created)
+	output := run.LogOutput
+	if output == nil {
+		output = os.Stdout
+	}
+	streamer := newJobLogStreamer(ctx, clientSet, run.Namespace, output)
+
+	opts := DefaultWaitOptions(description, run.Timeout)
+	opts.MaxInterval = min(opts.MaxInterval, 5*time.Second)
+	errWait := WaitFor(ctx, opts, func(ctx context.Context) (bool, error) {
+		current, err := clientSet.BatchV1().Jobs(run.Namespace).Get(ctx, created.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		WaitState(ctx, jobState(current))
+		if done, err := checkJobStatus(description, current); done || err != nil {
+			return done, err
+		}
+
+		pods, err := clientSet.CoreV1().Pods(run.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return false, err
+		}
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			streamer.follow(pod)
+			if container, reason := fatalWaitingContainer(pod); reason != "" {
+				return false, &TerminalStateError{Description: description, State: reason, Reason: fmt.Sprintf("container %s of pod %s cannot start", container, pod.Name)}
+			}
+		}
+		return false, nil
+	})
+	streamer.stop(jobLogsGracePeriod)
+
+	// the state of the pods is collected even when the job failed, it is the purpose of the runner
+	pods, errPods := collectJobPods(context.WithoutCancel(ctx), clientSet, run.Namespace, selector, streamer)
+	result.Pods = pods
+	events, errEvents := collectJobEvents(context.WithoutCancel(ctx), clientSet, created, pods)
+	result.Events = events
+	result.Succeeded = errWait == nil
+
+	if errWait != nil {
+		if reasons := result.FailureReasons(); len(reasons) > 0 {
+			errWait = fmt.Errorf("%w, containers: %s", errWait, strings.Join(reasons, "; "))
+		}
+		return result, errWait
+	}
+	return result, errors.Join(errPods, errEvents)
+}
+
+// jobCondition returns the condition of the job of the given type if it is True
+func jobCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		condition := &job.Status.Conditions[i]
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return condition
+		}
+	}
+	return nil
+}
+
+// jobPodSelector returns the label selector of the pods of the job, its selector is generated by the API server
+func jobPodSelector(job *batchv1.Job) string {
+	if job.Spec.Selector != nil {
+		if selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector); err == nil && !selector.Empty() {
+			return selector.String()
+		}
+	}
+	return labels.Set{batchv1.JobNameLabel: job.Name}.String()
+}
+
+// fatalWaitingContainer returns the first container of the pod waiting for a reason of fatalWaitingReasons
+func fatalWaitingContainer(pod *corev1.Pod) (string, string) {
+	for _, status := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+		if status.State.Waiting != nil && slices.Contains(fatalWaitingReasons, status.State.Waiting.Reason) {
+			return status.Name, status.State.Waiting.Reason
+		}
+	}
+	return "", ""
+}
+
+// applyJobInputs applies the ConfigMaps and Secrets of the run, the values left by a previous run are replaced
+func applyJobInputs(ctx context.Context, clientSet kubernetes.Interface, run JobRun) error {
+	var results []EnsureResult
+	for _, input := range run.ConfigMaps {
+		configMap := input.DeepCopy()
+		configMap.Namespace = run.Namespace
+		result, err := EnsureConfigMap(ctx, clientSet, configMap)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	for _, input := range run.Secrets {
+		secret := input.DeepCopy()
+		secret.Namespace = run.Namespace
+		result, err := EnsureSecret(ctx, clientSet, secret)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	for _, result := range results {
+		fmt.Println(result)
+	}
+	return nil
+}
+
+// deletePreviousJobs deletes the jobs with the name or the labels of job and waits until the name is available again
+func deletePreviousJobs(ctx context.Context, clientSet kubernetes.Interface, job *batchv1.Job) error {
+	jobs := clientSet.BatchV1().Jobs(job.Namespace)
+	names := []string{job.Name}
+	if len(job.Labels) > 0 {
+		previous, err := jobs.List(ctx, metav1.ListOptions{LabelSelector: labels.SelectorFromSet(job.Labels).String()})
+		if err != nil {
+			return fmt.Errorf("failed to list the previous jobs of %s/%s: %w", job.Namespace, job.Name, err)
+		}
+		for _, previousJob := range previous.Items {
+			if !slices.Contains(names, previousJob.Name) {
+				names = append(names, previousJob.Name)
+			}
+		}
+	}
+
+	// the foreground deletion removes the pods before the job, they are not mistaken for the pods of the new job
+	foreground := metav1.DeletePropagationForeground
+	for _, name := range names {
+		if err := jobs.Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &foreground}); err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to delete the job %s/%s: %w", job.Namespace, name, err)
+		}
+	}
+
+	return WaitFor(ctx, DefaultWaitOptions(fmt.Sprintf("deletion of the job %s/%s", job.Namespace, job.Name), jobDeletionTimeout), func(ctx context.Context) (bool, error) {
+		_, err := jobs.Get(ctx, job.Name, metav1.GetOptions{})
+		if IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
+
+// cleanupJobRun deletes the job, its pods and the inputs of the run
+func cleanupJobRun(ctx context.Context, clientSet kubernetes.Interface, job *batchv1.Job, run JobRun) error {
+	var errs []error
+	background := metav1.DeletePropagationBackground
+	if err := clientSet.BatchV1().Jobs(run.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &background}); err != nil && !IsNotFound(err) {
+		errs = append(errs, fmt.Errorf("failed to delete the job %s/%s: %w", run.Namespace, job.Name, err))
+	}
+	for _, configMap := range run.ConfigMaps {
+		if err := clientSet.CoreV1().ConfigMaps(run.Namespace).Delete(ctx, configMap.Name, metav1.DeleteOptions{}); err != nil && !IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete the configmap %s/%s: %w", run.Namespace, configMap.Name, err))
+		}
+	}
+	for _, secret := range run.Secrets {
+		if err := clientSet.CoreV1().Secrets(run.Namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{}); err != nil && !IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete the secret %s/%s: %w", run.Namespace, secret.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// collectJobPods returns the final state of the pods of the job with the logs of their containers
+func collectJobPods(ctx context.Context, clientSet kubernetes.Interface, namespace, selector string, streamer *jobLogStreamer) ([]JobPodResult, error) {
+	pods, err := clientSet.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the pods of the job: %w", err)
+	}
+
+	var results []JobPodResult
+	var errs []error
+	for _, pod := range pods.Items {
+		podResult := JobPodResult{Name: pod.Name, Phase: pod.Status.Phase}
+		for _, status := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+			container := ContainerResult{Name: status.Name, ExitCode: -1, Restarts: status.RestartCount}
+			switch {
+			case status.State.Terminated != nil:
+				container.ExitCode = status.State.Terminated.ExitCode
+				container.Reason = status.State.Terminated.Reason
+				container.Message = status.State.Terminated.Message
+			case status.State.Waiting != nil:
+				container.Reason = status.State.Waiting.Reason
+				container.Message = status.State.Waiting.Message
+			case status.State.Running != nil:
+				container.Reason = "Running"
+			}
+
+			logs, streamed := streamer.logs(pod.Name, status.Name)
+			if !streamed && status.State.Waiting == nil {
+				// the container ran between two polls of the job, its logs are read once
+				var err error
+				if logs, err = streamer.read(ctx, pod.Name, status.Name); err != nil {
+					errs = append(errs, fmt.Errorf("failed to get the logs of %s/%s: %w", pod.Name, status.Name, err))
+				}
+			}
+			container.Logs = logs
+			podResult.Containers = append(podResult.Containers, container)
+		}
+		results = append(results, podResult)
+	}
+
+	slices.SortFunc(results, func(a, b JobPodResult) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return results, errors.Join(errs...)
+}
+
+// collectJobEvents returns the events of the job and its pods sorted by time
+func collectJobEvents(ctx context.Context, clientSet kubernetes.Interface, job *batchv1.Job, pods []JobPodResult) ([]string, error) {
+	events, err := clientSet.CoreV1().Events(job.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the events of the job: %w", err)
+	}
+
+	involved := func(event corev1.Event) bool {
+		switch event.InvolvedObject.Kind {
+		case "Job":
+			return event.InvolvedObject.Name == job.Name && event.InvolvedObject.UID == job.UID
+		case "Pod":
+			return slices.ContainsFunc(pods, func(pod JobPodResult) bool { return pod.Name == event.InvolvedObject.Name })
+		}
+		return false
+	}
+
+	var selected []corev1.Event
+	for _, event := range events.Items {
+		if involved(event) {
+			selected = append(selected, event)
+		}
+	}
+	slices.SortStableFunc(selected, func(a, b corev1.Event) int {
+		return eventTime(a).Compare(eventTime(b))
+	})
+
+	formatted := make([]string, 0, len(selected))
+	for _, event := range selected {
+		formatted = append(formatted, fmt.Sprintf("%s %s %s/%s: %s", event.Type, event.Reason, event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Message))
+	}
+	return formatted, nil
+}
+
+// eventTime returns the last time the event was observed
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// jobLogStreamer follows the logs of the containers of the job, they are printed and kept for the JobResult
+type jobLogStreamer struct {
+	clientSet kubernetes.Interface
+	namespace string
+	output    io.Writer
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	buffers map[string]*bytes.Buffer
+}
+
+func newJobLogStreamer(ctx context.Context, clientSet kubernetes.Interface, namespace string, output io.Writer) *jobLogStreamer {
+	ctx, cancel := context.WithCancel(ctx)
+	return &jobLogStreamer{
+		clientSet: clientSet,
+		namespace: namespace,
+		output:    output,
+		ctx:       ctx,
+		cancel:    cancel,
+		buffers:   make(map[string]*bytes.Buffer),
+	}
+}
+
+// follow starts to stream the logs of the containers of the pod that have started
+func (s *jobLogStreamer) follow(pod *corev1.Pod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, status := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+		key := pod.Name + "/" + status.Name
+		if _, streamed := s.buffers[key]; streamed || (status.State.Running == nil && status.State.Terminated == nil) {
+			continue
+		}
+
+		buffer := &bytes.Buffer{}
+		s.buffers[key] = buffer
+		s.wg.Add(1)
+		go s.stream(pod.Name, status.Name, buffer)
+	}
+}
+
+func (s *jobLogStreamer) stream(podName, container string, buffer *bytes.Buffer) {
+	defer s.wg.Done()
+
+	if err := s.copyLogs(s.ctx, podName, container, true, buffer); err != nil && s.ctx.Err() == nil {
+		fmt.Fprintf(s.output, "[%s/%s] failed to stream the logs: %v\n", podName, container, err)
+	}
+}
+
+// read reads the logs of a container that has not been followed
+func (s *jobLogStreamer) read(ctx context.Context, podName, container string) (string, error) {
+	buffer := &bytes.Buffer{}
+	s.mu.Lock()
+	s.buffers[podName+"/"+container] = buffer
+	s.mu.Unlock()
+
+	err := s.copyLogs(ctx, podName, container, false, buffer)
+	logs, _ := s.logs(podName, container)
+	return logs, err
+}
+
+// copyLogs copies the logs of the container to buffer and prints them prefixed by pod/container
+func (s *jobLogStreamer) copyLogs(ctx context.Context, podName, container string, follow bool, buffer *bytes.Buffer) error {
+	stream, err := s.clientSet.CoreV1().Pods(s.namespace).GetLogs(podName, &corev1.PodLogOptions{Container: container, Follow: follow}).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		s.mu.Lock()
+		buffer.WriteString(scanner.Text() + "\n")
+		s.mu.Unlock()
+		fmt.Fprintf(s.output, "[%s/%s] %s\n", podName, container, scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// logs returns the logs streamed for the container and whether they were streamed
+func (s *jobLogStreamer) logs(podName, container string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buffer, streamed := s.buffers[podName+"/"+container]
+	if !streamed {
+		return "", false
+	}
+	return buffer.String(), true
+}
+
+// stop waits for the streams to reach the end of the logs during the grace period, then interrupts them
+func (s *jobLogStreamer) stop(gracePeriod time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(gracePeriod):
+	}
+	s.cancel()
+	<-done
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"testing"
+	"time"
+)
+
+func newTestJob(name string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"app": name}},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers:    []corev1.Container{{Name: name, Image: "amazonlinux:latest"}},
+				},
+			},
+		},
+	}
+}
+
+func newTestJobPod(job *batchv1.Job, name string, state corev1.ContainerState) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: job.Namespace,
+			Labels:    map[string]string{batchv1.JobNameLabel: job.Name},
+		},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodFailed,
+			ContainerStatuses: []corev1.ContainerStatus{{Name: job.Spec.Template.Spec.Containers[0].Name, State: state}},
+		},
+	}
+}
+
+// onJobCreation simulates the job controller: the created job gets the status and the pods returned by run
+func onJobCreation(t *testing.T, clientSet *fake.Clientset, run func(job *batchv1.Job) []*corev1.Pod) {
+	clientSet.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		for _, pod := range run(job) {
+			require.NoError(t, clientSet.Tracker().Add(pod))
+		}
+		// the default reactor stores the job with its status
+		return false, nil, nil
+	})
+}
+
+func TestRunJobSucceeds(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	previousJob := newTestJob("postgres-client")
+	previousJob.Namespace = "aurora"
+	previousJob.Name = "postgres-client-old"
+	clientSet := fake.NewClientset(
+		previousJob,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "aurora-config", Namespace: "aurora"}, Data: map[string]string{"aurora_endpoint": "old"}},
+	)
+	onJobCreation(t, clientSet, func(job *batchv1.Job) []*corev1.Pod {
+		assert.Equal(t, DefaultJobBackoffLimit, *job.Spec.BackoffLimit)
+		job.Status.Succeeded = 1
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		pod := newTestJobPod(job, "postgres-client-abcde", corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}})
+		pod.Status.Phase = corev1.PodSucceeded
+
+		// the inputs are replaced before the job is created
+		// (the reactors hold the lock of the clientset, the tracker is used directly)
+		configMap, err := clientSet.Tracker().Get(corev1.SchemeGroupVersion.WithResource("configmaps"), "aurora", "aurora-config")
+		require.NoError(t, err)
+		assert.Equal(t, "aurora.cluster.local", configMap.(*corev1.ConfigMap).Data["aurora_endpoint"])
+		_, err = clientSet.Tracker().Get(batchv1.SchemeGroupVersion.WithResource("jobs"), "aurora", "postgres-client-old")
+		assert.True(t, IsNotFound(err))
+		return []*corev1.Pod{pod}
+	})
+
+	var output bytes.Buffer
+	result, err := RunJob(context.Background(), clientSet, JobRun{
+		Namespace:  "aurora",
+		Job:        newTestJob("postgres-client"),
+		ConfigMaps: []*corev1.ConfigMap{{ObjectMeta: metav1.ObjectMeta{Name: "aurora-config"}, Data: map[string]string{"aurora_endpoint": "aurora.cluster.local"}}},
+		Secrets:    []*corev1.Secret{{ObjectMeta: metav1.ObjectMeta{Name: "aurora-secret"}, StringData: map[string]string{"aurora_password": "secret"}}},
+		Timeout:    time.Second,
+		LogOutput:  &output,
+	})
+	require.NoError(t, err)
+
+	assert.True(t, result.Succeeded)
+	require.Len(t, result.Pods, 1)
+	assert.Equal(t, []ContainerResult{{Name: "postgres-client", ExitCode: 0, Reason: "Completed", Logs: "fake logs\n"}}, result.Pods[0].Containers)
+	assert.Equal(t, "[postgres-client-abcde/postgres-client] fake logs\n", output.String())
+	assert.Empty(t, result.FailureReasons())
+
+	// the job and its inputs are deleted at the end of the run
+	jobs, err := clientSet.BatchV1().Jobs("aurora").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, jobs.Items)
+	_, err = clientSet.CoreV1().ConfigMaps("aurora").Get(context.Background(), "aurora-config", metav1.GetOptions{})
+	assert.True(t, IsNotFound(err))
+	_, err = clientSet.CoreV1().Secrets("aurora").Get(context.Background(), "aurora-secret", metav1.GetOptions{})
+	assert.True(t, IsNotFound(err))
+}
+
+func TestRunJobReportsFailures(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	clientSet := fake.NewClientset(&corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "postgres-client-abcde.1", Namespace: "aurora"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "postgres-client-abcde"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+	}, &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "other.1", Namespace: "aurora"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "other"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "Unrelated",
+	})
+	onJobCreation(t, clientSet, func(job *batchv1.Job) []*corev1.Pod {
+		job.Status.Failed = 1
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"}}
+		return []*corev1.Pod{newTestJobPod(job, "postgres-client-abcde", corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}})}
+	})
+
+	result, err := RunJob(context.Background(), clientSet, JobRun{Namespace: "aurora", Job: newTestJob("postgres-client"), Timeout: time.Second, LogOutput: &bytes.Buffer{}})
+
+	require.True(t, IsTerminalState(err))
+	assert.ErrorContains(t, err, "BackoffLimitExceeded: Job has reached the specified backoff limit")
+	assert.ErrorContains(t, err, "postgres-client-abcde/postgres-client exited with code 137 (OOMKilled)")
+	assert.False(t, result.Succeeded)
+	assert.Equal(t, []string{"Warning BackOff Pod/postgres-client-abcde: Back-off restarting failed container"}, result.Events)
+	assert.Contains(t, result.Summary(), "      | fake logs")
+}
+
+func TestRunJobFailsFastWhenContainersCannotStart(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	clientSet := fake.NewClientset()
+	onJobCreation(t, clientSet, func(job *batchv1.Job) []*corev1.Pod {
+		job.Status.Active = 1
+		return []*corev1.Pod{newTestJobPod(job, "opensearch-client-abcde", corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}})}
+	})
+
+	result, err := RunJob(context.Background(), clientSet, JobRun{Namespace: "opensearch", Job: newTestJob("opensearch-client"), Timeout: time.Minute, LogOutput: &bytes.Buffer{}})
+
+	var terminalErr *TerminalStateError
+	require.ErrorAs(t, err, &terminalErr)
+	assert.Equal(t, "ImagePullBackOff", terminalErr.State)
+	assert.Equal(t, []string{"opensearch-client-abcde/opensearch-client waiting (ImagePullBackOff): Back-off pulling image"}, result.FailureReasons())
+}
+
+func TestRunJobHonorsBackoffLimit(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	clientSet := fake.NewClientset()
+	onJobCreation(t, clientSet, func(job *batchv1.Job) []*corev1.Pod {
+		// the Failed condition is not set yet by the controller
+		job.Status.Failed = 3
+		return nil
+	})
+	job := newTestJob("postgres-client")
+	backoffLimit := int32(2)
+	job.Spec.BackoffLimit = &backoffLimit
+
+	_, err := RunJob(context.Background(), clientSet, JobRun{Namespace: "aurora", Job: job, Timeout: time.Minute, LogOutput: &bytes.Buffer{}})
+
+	assert.ErrorContains(t, err, "3 failed pods, the backoffLimit is 2")
+}
+
+func TestLoadJobManifest(t *testing.T) {
+	job, err := LoadJobManifest("../../../modules/fixtures/postgres-client.yml")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres-client", job.Name)
+	assert.Equal(t, "aurora-access-sa", job.Spec.Template.Spec.ServiceAccountName)
+
+	job, err = LoadJobManifest("../../../modules/fixtures/postgres-upgrade-client.yml")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres-upgrade-client", job.Name)
+
+	_, err = LoadJobManifest("../../../modules/fixtures/whoami-deployment.yml")
+	assert.ErrorContains(t, err, "not a Job")
+}
@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"golang.org/x/sync/errgroup"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultKMSConcurrency is the default number of concurrent DescribeKey and ListResourceTags calls of a KMSKeyFinder
+const DefaultKMSConcurrency = 8
+
+// ErrKMSKeyNotFound is returned by KMSKeyFinder.FindOne when no key matches the filter
+var ErrKMSKeyNotFound = errors.New("kms key not found")
+
+// KMSKey is a key described by a KMSKeyFinder
+type KMSKey struct {
+	ID          string
+	ARN         string
+	Description string
+	State       kmstypes.KeyState
+	// Aliases are only loaded once a filter by alias is used
+	Aliases []string
+	// Tags are only loaded once a filter by tag is used
+	Tags map[string]string
+}
+
+// KMSKeyFilter selects the keys of KMSKeyFinder.Find, every non empty field must match
+type KMSKeyFilter struct {
+	Description string
+	// Alias is the name of an alias of the key, with or without the alias/ prefix
+	Alias    string
+	TagKey   string
+	TagValue string
+	// IncludePendingDeletion also selects the keys scheduled for deletion
+	IncludePendingDeletion bool
+}
+
+// SkippedKMSKey is a key the caller cannot describe (access denied) or deleted while it was listed
+type SkippedKMSKey struct {
+	ID string
+	// Reason is the operation and the error code, e.g. DescribeKey: AccessDeniedException
+	Reason string
+}
+
+// KMSKeyFinder looks up the KMS keys of the region by description, alias or tag.
+// The keys are listed and described once (DescribeKey calls are spread on Concurrency workers)
+// and cached until Reset, so repeated lookups are cheap even on accounts with many keys.
+type KMSKeyFinder struct {
+	client *kms.Client
+	// Concurrency is the number of concurrent DescribeKey and ListResourceTags calls
+	Concurrency int
+	// ThrottlingBudget is the time spent retrying a throttled (or otherwise transient) call once the retries of the SDK are exhausted
+	ThrottlingBudget time.Duration
+
+	mu            sync.Mutex
+	keys          []*KMSKey
+	skipped       []SkippedKMSKey
+	loaded        bool
+	aliasesLoaded bool
+	tagsLoaded    bool
+}
+
+// NewKMSKeyFinder returns a finder using the client with DefaultKMSConcurrency workers
+func NewKMSKeyFinder(client *kms.Client) *KMSKeyFinder {
+	return &KMSKeyFinder{
+		client:           client,
+		Concurrency:      DefaultKMSConcurrency,
+		ThrottlingBudget: 2 * time.Minute,
+	}
+}
+
+// Reset clears the cache, the next lookup lists the keys again
+func (f *KMSKeyFinder) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.keys, f.skipped = nil, nil
+	f.loaded, f.aliasesLoaded, f.tagsLoaded = false, false, false
+}
+
+// Keys returns every key of the region the caller can describe, sorted by ID
+func (f *KMSKeyFinder) Keys(ctx context.Context) ([]KMSKey, error) {
+	return f.Find(ctx, KMSKeyFilter{IncludePendingDeletion: true})
+}
+
+// Skipped returns the keys ignored by the last listing because they cannot be described
+func (f *KMSKeyFinder) Skipped() []SkippedKMSKey {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return slices.Clone(f.skipped)
+}
+
+// Find returns the keys matching the filter sorted by ID, the keys pending deletion are ignored unless
+// IncludePendingDeletion is set. The keys the caller is not allowed to describe are skipped (see Skipped),
+// the other errors fail the lookup.
+func (f *KMSKeyFinder) Find(ctx context.Context, filter KMSKeyFilter) ([]KMSKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(ctx); err != nil {
+		return nil, err
+	}
+	if filter.Alias != "" {
+		if err := f.loadAliases(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if filter.TagKey != "" {
+		if err := f.loadTags(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	alias := filter.Alias
+	if alias != "" && !strings.HasPrefix(alias, "alias/") {
+		alias = "alias/" + alias
+	}
+
+	var keys []KMSKey
+	for _, key := range f.keys {
+		switch {
+		case !filter.IncludePendingDeletion && key.State == kmstypes.KeyStatePendingDeletion:
+		case filter.Description != "" && key.Description != filter.Description:
+		case alias != "" && !slices.Contains(key.Aliases, alias):
+		case filter.TagKey != "" && !hasTag(key.Tags, filter.TagKey, filter.TagValue):
+		default:
+			keys = append(keys, *key)
+		}
+	}
+	return keys, nil
+}
+
+// FindOne returns the only key matching the filter, it fails with ErrKMSKeyNotFound if none matches
+func (f *KMSKeyFinder) FindOne(ctx context.Context, filter KMSKeyFilter) (KMSKey, error) {
+	keys, err := f.Find(ctx, filter)
+	if err != nil {
+		return KMSKey{}, err
+	}
+	switch len(keys) {
+	case 0:
+		return KMSKey{}, fmt.Errorf("%w: %+v", ErrKMSKeyNotFound, filter)
+	case 1:
+		return keys[0], nil
+	default:
+		return KMSKey{}, fmt.Errorf("%d kms keys match %+v", len(keys), filter)
+	}
+}
+
+func hasTag(tags map[string]string, key, value string) bool {
+	tagValue, ok := tags[key]
+	return ok && (value == "" || tagValue == value)
+}
+
+// retry calls fn until it succeeds or fails with an error that is not retryable (see IsRetryable),
+// the retries are bound by the ThrottlingBudget
+func (f *KMSKeyFinder) retry(ctx context.Context, description string, fn func(ctx context.Context) error) error {
+	return WaitFor(ctx, DefaultWaitOptions(description, f.ThrottlingBudget), func(ctx context.Context) (bool, error) {
+		err := fn(ctx)
+		return err == nil, err
+	})
+}
+
+// forEachKey calls fn on each key with at most Concurrency concurrent calls, it stops at the first error
+func (f *KMSKeyFinder) forEachKey(ctx context.Context, fn func(ctx context.Context, key *KMSKey) error) error {
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(max(f.Concurrency, 1))
+	for _, key := range f.keys {
+		group.Go(func() error {
+			return fn(groupCtx, key)
+		})
+	}
+	return group.Wait()
+}
+
+// skip records a key that cannot be described, it returns false for the errors that must fail the lookup
+func (f *KMSKeyFinder) skip(skipped *[]SkippedKMSKey, mu *sync.Mutex, id, operation string, err error) bool {
+	if !IsAccessDenied(err) && !IsNotFound(err) {
+		return false
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	*skipped = append(*skipped, SkippedKMSKey{ID: id, Reason: fmt.Sprintf("%s: %s", operation, AwsErrorCode(err))})
+	return true
+}
+
+func (f *KMSKeyFinder) load(ctx context.Context) error {
+	if f.loaded {
+		return nil
+	}
+
+	var keys []*KMSKey
+	paginator := kms.NewListKeysPaginator(f.client, &kms.ListKeysInput{}, func(o *kms.ListKeysPaginatorOptions) {
+		o.Limit = 100
+	})
+	for paginator.HasMorePages() {
+		var page *kms.ListKeysOutput
+		errPage := f.retry(ctx, "kms:ListKeys", func(ctx context.Context) (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if errPage != nil {
+			return fmt.Errorf("failed to list the kms keys: %w", errPage)
+		}
+		for _, key := range page.Keys {
+			keys = append(keys, &KMSKey{ID: aws.ToString(key.KeyId), ARN: aws.ToString(key.KeyArn)})
+		}
+	}
+	f.keys = keys
+
+	var mu sync.Mutex
+	var skipped []SkippedKMSKey
+	err := f.forEachKey(ctx, func(ctx context.Context, key *KMSKey) error {
+		var output *kms.DescribeKeyOutput
+		errDescribe := f.retry(ctx, fmt.Sprintf("kms:DescribeKey %s", key.ID), func(ctx context.Context) (err error) {
+			output, err = f.client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(key.ID)})
+			return err
+		})
+		if errDescribe != nil {
+			if f.skip(&skipped, &mu, key.ID, "DescribeKey", errDescribe) {
+				return nil
+			}
+			return fmt.Errorf("failed to describe the kms key %s: %w", key.ID, errDescribe)
+		}
+
+		key.Description = aws.ToString(output.KeyMetadata.Description)
+		key.State = output.KeyMetadata.KeyState
+		return nil
+	})
+	if err != nil {
+		f.keys = nil
+		return err
+	}
+
+	// the skipped keys are not returned by the lookups
+	skippedIDs := make(map[string]struct{}, len(skipped))
+	for _, key := range skipped {
+		skippedIDs[key.ID] = struct{}{}
+	}
+	f.keys = slices.DeleteFunc(f.keys, func(key *KMSKey) bool {
+		_, ok := skippedIDs[key.ID]
+		return ok
+	})
+	slices.SortFunc(f.keys, func(a, b *KMSKey) int { return strings.Compare(a.ID, b.ID) })
+	slices.SortFunc(skipped, func(a, b SkippedKMSKey) int { return strings.Compare(a.ID, b.ID) })
+	f.skipped = skipped
+	f.loaded = true
+	return nil
+}
+
+func (f *KMSKeyFinder) loadAliases(ctx context.Context) error {
+	if f.aliasesLoaded {
+		return nil
+	}
+
+	aliases := make(map[string][]string)
+	paginator := kms.NewListAliasesPaginator(f.client, &kms.ListAliasesInput{})
+	for paginator.HasMorePages() {
+		var page *kms.ListAliasesOutput
+		errPage := f.retry(ctx, "kms:ListAliases", func(ctx context.Context) (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if errPage != nil {
+			return fmt.Errorf("failed to list the kms aliases: %w", errPage)
+		}
+		for _, alias := range page.Aliases {
+			if alias.TargetKeyId != nil {
+				aliases[*alias.TargetKeyId] = append(aliases[*alias.TargetKeyId], aws.ToString(alias.AliasName))
+			}
+		}
+	}
+
+	for _, key := range f.keys {
+		key.Aliases = aliases[key.ID]
+	}
+	f.aliasesLoaded = true
+	return nil
+}
+
+// loadTags lists the tags of every key, a key whose tags cannot be listed has no tag
+func (f *KMSKeyFinder) loadTags(ctx context.Context) error {
+	if f.tagsLoaded {
+		return nil
+	}
+
+	var mu sync.Mutex
+	err := f.forEachKey(ctx, func(ctx context.Context, key *KMSKey) error {
+		tags := make(map[string]string)
+		paginator := kms.NewListResourceTagsPaginator(f.client, &kms.ListResourceTagsInput{KeyId: aws.String(key.ID)})
+		for paginator.HasMorePages() {
+			var page *kms.ListResourceTagsOutput
+			errPage := f.retry(ctx, fmt.Sprintf("kms:ListResourceTags %s", key.ID), func(ctx context.Context) (err error) {
+				page, err = paginator.NextPage(ctx)
+				return err
+			})
+			if errPage != nil {
+				if f.skip(&f.skipped, &mu, key.ID, "ListResourceTags", errPage) {
+					break
+				}
+				return fmt.Errorf("failed to list the tags of the kms key %s: %w", key.ID, errPage)
+			}
+			for _, tag := range page.Tags {
+				tags[aws.ToString(tag.TagKey)] = aws.ToString(tag.TagValue)
+			}
+		}
+
+		key.Tags = tags
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.tagsLoaded = true
+	return nil
+}
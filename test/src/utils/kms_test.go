@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/camunda/camunda-tf-eks-module/utils/awsfake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// newKMSKeyFinder returns a finder whose client does not retry, the throttling is only retried by the finder
+func newKMSKeyFinder(sess aws.Config) *KMSKeyFinder {
+	finder := NewKMSKeyFinder(kms.NewFromConfig(sess, func(o *kms.Options) {
+		o.RetryMaxAttempts = 1
+	}))
+	finder.ThrottlingBudget = 5 * time.Second
+	return finder
+}
+
+func addKMSKeys(server *awsfake.Server) {
+	server.AddKMSKey(awsfake.KMSKey{
+		ID:          "key-eks",
+		Description: "cluster-test -  EKS Secret Encryption Key",
+		Aliases:     []string{"alias/eks/cluster-test"},
+		Tags:        map[string]string{"Cluster": "cluster-test"},
+	})
+	server.AddKMSKey(awsfake.KMSKey{
+		ID:          "key-aurora",
+		Description: "postgres-cluster-test-key",
+		Tags:        map[string]string{"Cluster": "cluster-test", "Module": "aurora"},
+	})
+	server.AddKMSKey(awsfake.KMSKey{
+		ID:          "key-old",
+		Description: "cluster-test -  EKS Secret Encryption Key",
+		State:       "PendingDeletion",
+	})
+}
+
+func TestKMSKeyFinder(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	addKMSKeys(server)
+	finder := newKMSKeyFinder(sess)
+	ctx := context.Background()
+
+	key, err := finder.FindOne(ctx, KMSKeyFilter{Description: "cluster-test -  EKS Secret Encryption Key"})
+	require.NoError(t, err)
+	assert.Equal(t, "key-eks", key.ID)
+
+	keys, err := finder.Find(ctx, KMSKeyFilter{Description: "cluster-test -  EKS Secret Encryption Key", IncludePendingDeletion: true})
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	key, err = finder.FindOne(ctx, KMSKeyFilter{Alias: "eks/cluster-test"})
+	require.NoError(t, err)
+	assert.Equal(t, "key-eks", key.ID)
+	assert.Equal(t, []string{"alias/eks/cluster-test"}, key.Aliases)
+
+	key, err = finder.FindOne(ctx, KMSKeyFilter{TagKey: "Module", TagValue: "aurora"})
+	require.NoError(t, err)
+	assert.Equal(t, "key-aurora", key.ID)
+
+	keys, err = finder.Find(ctx, KMSKeyFilter{TagKey: "Cluster"})
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	_, err = finder.FindOne(ctx, KMSKeyFilter{Description: "missing"})
+	assert.ErrorIs(t, err, ErrKMSKeyNotFound)
+
+	_, err = finder.FindOne(ctx, KMSKeyFilter{TagKey: "Cluster"})
+	assert.ErrorContains(t, err, "2 kms keys match")
+
+	// the keys are listed and described once
+	assert.Equal(t, 1, server.Calls("ListKeys"))
+	assert.Equal(t, 3, server.Calls("DescribeKey"))
+	assert.Equal(t, 1, server.Calls("ListAliases"))
+	assert.Equal(t, 3, server.Calls("ListResourceTags"))
+
+	finder.Reset()
+	_, err = finder.Keys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.Calls("ListKeys"))
+}
+
+func TestKMSKeyFinderManyKeys(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	for i := range 100 {
+		server.AddKMSKey(awsfake.KMSKey{ID: fmt.Sprintf("key-%03d", i), Description: fmt.Sprintf("key %d", i)})
+	}
+	finder := newKMSKeyFinder(sess)
+	finder.Concurrency = 4
+
+	keys, err := finder.Keys(context.Background())
+	require.NoError(t, err)
+	require.Len(t, keys, 100)
+	assert.Equal(t, "key-000", keys[0].ID)
+	assert.Equal(t, "key 99", keys[99].Description)
+}
+
+func TestKMSKeyFinderSkipsDeniedKeys(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	addKMSKeys(server)
+	server.InjectFault("DescribeKey", awsfake.Fault{StatusCode: 400, Code: "AccessDeniedException", Message: "not authorized", Times: 1})
+	finder := newKMSKeyFinder(sess)
+	finder.Concurrency = 1
+
+	keys, err := finder.Keys(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	// the keys are described in the order of ListKeys
+	assert.Equal(t, []SkippedKMSKey{{ID: "key-aurora", Reason: "DescribeKey: AccessDeniedException"}}, finder.Skipped())
+}
+
+func TestKMSKeyFinderRetriesThrottling(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	addKMSKeys(server)
+	server.InjectFault("DescribeKey", awsfake.Throttling(2))
+	finder := newKMSKeyFinder(sess)
+
+	keys, err := finder.Keys(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, keys, 3)
+	assert.Empty(t, finder.Skipped())
+	assert.Equal(t, 5, server.Calls("DescribeKey"))
+}
+
+func TestKMSKeyFinderRetriesInternalErrors(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	addKMSKeys(server)
+	server.InjectFault("DescribeKey", awsfake.Fault{StatusCode: 500, Code: "KMSInternalException", Message: "internal error", Times: 1})
+
+	keys, err := newKMSKeyFinder(sess).Keys(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, keys, 3)
+}
+
+func TestKMSKeyFinderFailsOnOtherErrors(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	addKMSKeys(server)
+	server.InjectFault("DescribeKey", awsfake.Fault{StatusCode: 400, Code: "KMSInvalidStateException", Message: "invalid state"})
+
+	_, err := newKMSKeyFinder(sess).Keys(context.Background())
+	assert.ErrorContains(t, err, "KMSInvalidStateException")
+}
@@ -2,193 +2,229 @@ package utils
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/service/eks/types"
-	"github.com/gruntwork-io/terratest/modules/k8s"
 	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/informers"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
-	"os/exec"
-	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
-	"sync/atomic"
+	watchtools "k8s.io/client-go/tools/watch"
 	"testing"
 	"time"
-
-	batchv1 "k8s.io/api/batch/v1"
 )
 
-func WaitForJobCompletion(clientset *kubernetes.Clientset, namespace, jobName string, timeout time.Duration, listOptions metav1.ListOptions) error {
-	// Create a context
-	ctx := context.Background()
-
-	// Watch for job events
-	watch, err := clientset.BatchV1().Jobs(namespace).Watch(ctx, listOptions)
-	if err != nil {
-		return fmt.Errorf("Error creating watcher: %v", err)
+// WaitForJobCompletion watches the job until it is complete, it fails as soon as the job fails (see checkJobStatus).
+// The job may not exist yet, the watch is re-established when the API server closes it and the wait is bound by both ctx and timeout.
+func WaitForJobCompletion(ctx context.Context, clientset kubernetes.Interface, namespace, jobName string, timeout time.Duration) error {
+	description := fmt.Sprintf("job %s/%s", namespace, jobName)
+	ctx, cancel := watchtools.ContextWithOptionalTimeout(ctx, timeout)
+	defer cancel()
+
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", jobName).String()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return clientset.BatchV1().Jobs(namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return clientset.BatchV1().Jobs(namespace).Watch(ctx, options)
+		},
 	}
-	defer watch.Stop()
 
-	// Channel to receive events
-	eventChan := watch.ResultChan()
+	start := time.Now()
+	lastState := "NotFound"
+	events := 0
+	_, err := watchtools.UntilWithSync(ctx, listWatch, &batchv1.Job{}, nil, func(event watch.Event) (bool, error) {
+		job, ok := event.Object.(*batchv1.Job)
+		if !ok || job.Name != jobName {
+			return false, nil
+		}
+		events++
+		if event.Type == watch.Deleted {
+			return false, &TerminalStateError{Description: description, State: "Deleted", Reason: "the job has been deleted before its completion"}
+		}
 
-	// Loop to wait for job completion
-	for {
-		select {
-		case event := <-eventChan:
-			job, ok := event.Object.(*batchv1.Job)
-			if !ok {
-				return fmt.Errorf("Unexpected event received: %v", event)
-			}
-			if job.Name == jobName {
-				// Check if the job has completed
-				if job.Status.CompletionTime != nil {
-					// The job has completed, check if it succeeded
-					// The job has completed, check if it succeeded
-					if job.Status.Succeeded == 1 {
-						return nil // Job completed successfully
-					} else {
-						return fmt.Errorf("Job completed with errors")
-					}
-				}
-			}
-		case <-time.After(timeout):
-			return fmt.Errorf("Timeout: job did not complete after %v minutes", timeout)
+		state := jobState(job)
+		if state != lastState {
+			fmt.Printf("%s: %s\n", description, state)
+			lastState = state
 		}
+		return checkJobStatus(description, job)
+	})
+
+	if err != nil && ctx.Err() != nil && !IsTerminalState(err) {
+		return &TimeoutError{Description: description, Elapsed: time.Since(start), Attempts: events, LastState: lastState, Cause: ctx.Err()}
 	}
+	return err
 }
 
-func CreateIfNotExistsNamespace(t *testing.T, kubeCtlOptions *k8s.KubectlOptions, namespace string) {
-	_, errFindNamespace := k8s.GetNamespaceE(t, kubeCtlOptions, namespace)
-	if errFindNamespace != nil {
-		if errors.IsNotFound(errFindNamespace) {
-			k8s.CreateNamespace(t, kubeCtlOptions, namespace)
-		} else {
-			require.NoError(t, errFindNamespace)
+// checkJobStatus returns true when the job is complete: its Complete condition is True or, for the jobs with
+// parallel completions, enough pods succeeded. A TerminalStateError is returned as soon as the job fails:
+// its Failed or FailureTarget condition is True (BackoffLimitExceeded, DeadlineExceeded...) or its backoffLimit is exceeded.
+func checkJobStatus(description string, job *batchv1.Job) (bool, error) {
+	if jobCondition(job, batchv1.JobComplete) != nil {
+		return true, nil
+	}
+
+	for _, conditionType := range []batchv1.JobConditionType{batchv1.JobFailed, batchv1.JobFailureTarget} {
+		if condition := jobCondition(job, conditionType); condition != nil {
+			return false, &TerminalStateError{Description: description, State: string(batchv1.JobFailed), Reason: fmt.Sprintf("%s: %s (%s)", condition.Reason, condition.Message, jobState(job))}
 		}
 	}
+
+	if limit := job.Spec.BackoffLimit; limit != nil && job.Spec.BackoffLimitPerIndex == nil && job.Status.Failed > *limit {
+		return false, &TerminalStateError{Description: description, State: string(batchv1.JobFailed), Reason: fmt.Sprintf("%d failed pods, the backoffLimit is %d (%s)", job.Status.Failed, *limit, jobState(job))}
+	}
+
+	if completions := job.Spec.Completions; completions != nil && job.Status.Succeeded >= *completions {
+		return true, nil
+	}
+	return false, nil
 }
 
-func CreateIfNotExistsServiceAccount(t *testing.T, kubeCtlOptions *k8s.KubectlOptions, serviceAccountName string, annotations map[string]string) {
-	_, errFindSA := k8s.GetServiceAccountE(t, kubeCtlOptions, serviceAccountName)
-	if errFindSA != nil {
-		if errors.IsNotFound(errFindSA) {
-			// Create service account with annotations if it does not exist
-			serviceAccount := &corev1.ServiceAccount{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:        serviceAccountName,
-					Namespace:   kubeCtlOptions.Namespace,
-					Annotations: annotations,
-				},
+// jobState describes the pods of the job, e.g. "active=1 succeeded=2/3 failed=0"
+func jobState(job *batchv1.Job) string {
+	succeeded := fmt.Sprintf("%d", job.Status.Succeeded)
+	if job.Spec.Completions != nil {
+		succeeded = fmt.Sprintf("%s/%d", succeeded, *job.Spec.Completions)
+	}
+	return fmt.Sprintf("active=%d succeeded=%s failed=%d", job.Status.Active, succeeded, job.Status.Failed)
+}
+
+// WaitUntilServiceAvailable waits until the service exists and has at least one ready endpoint
+func WaitUntilServiceAvailable(ctx context.Context, clientset kubernetes.Interface, namespace, serviceName string, timeout time.Duration) error {
+	description := fmt.Sprintf("service %s/%s", namespace, serviceName)
+	return WaitFor(ctx, DefaultWaitOptions(description, timeout), func(ctx context.Context) (bool, error) {
+		_, err := clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+		if err != nil {
+			if IsNotFound(err) {
+				WaitState(ctx, "NotFound")
+				return false, nil
 			}
-			clientset, errClient := k8s.GetKubernetesClientFromOptionsE(t, kubeCtlOptions)
-			require.NoError(t, errClient)
-			_, errSA := clientset.CoreV1().ServiceAccounts(kubeCtlOptions.Namespace).Create(context.Background(), serviceAccount, metav1.CreateOptions{})
-			require.NoError(t, errSA)
-		} else {
-			require.NoError(t, errFindSA)
+			return false, err
 		}
+
+		endpoints, err := clientset.CoreV1().Endpoints(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+		if err != nil {
+			if IsNotFound(err) {
+				WaitState(ctx, "NoEndpoints")
+				return false, nil
+			}
+			return false, err
+		}
+
+		for _, subset := range endpoints.Subsets {
+			if len(subset.Addresses) > 0 {
+				return true, nil
+			}
+		}
+		WaitState(ctx, "NoReadyEndpoints")
+		return false, nil
+	})
+}
+
+// CreateIfNotExistsNamespace creates the namespace if it does not exist, the test fails on error
+func CreateIfNotExistsNamespace(t *testing.T, clientSet kubernetes.Interface, namespace string) {
+	require.NoError(t, CreateIfNotExistsNamespaceE(context.Background(), clientSet, namespace))
+}
+
+// CreateIfNotExistsNamespaceE creates the namespace if it does not exist, an existing namespace is left as is
+func CreateIfNotExistsNamespaceE(ctx context.Context, clientSet kubernetes.Interface, namespace string) error {
+	_, err := clientSet.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if !IsNotFound(err) {
+		return err
+	}
+
+	_, err = clientSet.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}, metav1.CreateOptions{})
+	if IsAlreadyExists(err) {
+		// created concurrently, e.g. by another suite
+		return nil
+	}
+	return err
+}
+
+// CreateIfNotExistsServiceAccount creates the service account with its annotations if it does not exist, the test fails on error
+func CreateIfNotExistsServiceAccount(t *testing.T, clientSet kubernetes.Interface, namespace, serviceAccountName string, annotations map[string]string) {
+	require.NoError(t, CreateIfNotExistsServiceAccountE(context.Background(), clientSet, namespace, serviceAccountName, annotations))
+}
+
+// CreateIfNotExistsServiceAccountE creates the service account with its annotations if it does not exist,
+// the annotations of an existing service account are not updated (see EnsureServiceAccount)
+func CreateIfNotExistsServiceAccountE(ctx context.Context, clientSet kubernetes.Interface, namespace, serviceAccountName string, annotations map[string]string) error {
+	serviceAccounts := clientSet.CoreV1().ServiceAccounts(namespace)
+	_, err := serviceAccounts.Get(ctx, serviceAccountName, metav1.GetOptions{})
+	if !IsNotFound(err) {
+		return err
+	}
+
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        serviceAccountName,
+			Namespace:   namespace,
+			Annotations: annotations,
+		},
 	}
+	_, err = serviceAccounts.Create(ctx, serviceAccount, metav1.CreateOptions{})
+	if IsAlreadyExists(err) {
+		return nil
+	}
+	return err
 }
 
+// GenerateKubeConfigFromAWS writes the kubeconfig of the EKS cluster from DescribeCluster without the aws CLI,
+// its token file is renewed until the end of the test (see KubeClientFactory.WriteKubeconfig)
 func GenerateKubeConfigFromAWS(t *testing.T, region, clusterName, awsProfile, configOutputPath string) {
-	cmd := exec.Command("aws", "eks", "--region", region, "update-kubeconfig", "--name", clusterName, "--profile", awsProfile, "--kubeconfig", configOutputPath)
-	_, errCmdKubeProfile := cmd.Output()
-	require.NoError(t, errCmdKubeProfile)
+	sess, err := GetAwsClientF(awsProfile, region)
+	require.NoError(t, err)
+
+	factory, err := DescribeKubeClientFactory(context.Background(), sess, clusterName, awsProfile)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	require.NoError(t, factory.WriteKubeconfig(ctx, configOutputPath))
 }
 
-// WaitUntilKubeClusterIsReady waits until the kube cluster is read or returns an error
-func WaitUntilKubeClusterIsReady(cluster *types.Cluster, timeout time.Duration, expectedNodesCount uint64) error {
+// WaitUntilKubeClusterIsReady waits until the expected number of nodes of the EKS cluster are ready or returns an error
+func WaitUntilKubeClusterIsReady(ctx context.Context, cluster *types.Cluster, awsProfile string, timeout time.Duration, expectedNodesCount uint64) error {
 	// https://github.com/kubernetes/client-go
-	// https://www.rushtehrani.com/post/using-kubernetes-api
-	// https://rancher.com/using-kubernetes-api-go-kubecon-2017-session-recap
 	// https://gianarb.it/blog/kubernetes-shared-informer
 	// https://stackoverflow.com/questions/60547409/unable-to-obtain-kubeconfig-of-an-aws-eks-cluster-in-go-code/60573982#60573982
 
-	fmt.Printf("Expecting %d nodes to join cluster %s\n", expectedNodesCount, *cluster.Name)
+	fmt.Printf("Expecting %d nodes to be ready in cluster %s\n", expectedNodesCount, *cluster.Name)
 
-	clientSet, err := NewKubeClientSet(cluster)
+	clientSet, err := NewKubeClientSet(cluster, awsProfile)
 	if err != nil {
 		return err
 	}
 
-	factory := informers.NewSharedInformerFactory(clientSet, 0)
-	informer := factory.Core().V1().Nodes().Informer()
-	stopChannel := make(chan struct{})
-	var countOfWorkerNodes uint64 = 0
-
-	_, errEventHandler := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			node := obj.(*corev1.Node)
-			fmt.Printf("Worker Node %s has joined the EKS cluster at %s\n", node.Name, node.CreationTimestamp)
-			atomic.AddUint64(&countOfWorkerNodes, 1)
-
-			// this will not prevent race condition, a lock on the
-			// operation would be necessary, in case of too many nodes
-			// joining the cluster, this function will panic
-			if countOfWorkerNodes == expectedNodesCount {
-				stopChannel <- struct{}{}
-			} else if countOfWorkerNodes > expectedNodesCount {
-				fmt.Printf("Warning: More nodes (%d) than expected (%d) have joined the cluster.\n", countOfWorkerNodes, expectedNodesCount)
-			}
-		},
-	})
-	if errEventHandler != nil {
-		return errEventHandler
-	}
-
-	go informer.Run(stopChannel)
-	go func() {
-		// wait to receive a signal to close the channel
-		<-stopChannel
-		close(stopChannel)
-	}()
-
-	select {
-	case <-stopChannel:
-		msg := "All worker nodes have joined the Kube cluster"
-		fmt.Println(msg)
-	case <-time.After(timeout):
-		msg := "Not all worker nodes have joined the Kube cluster"
-		fmt.Println(msg)
-		return errors.NewResourceExpired(msg)
-	}
-	return nil
+	return WaitUntilNodesReady(ctx, clientSet, int(expectedNodesCount), "", timeout)
 }
 
-// NewKubeClientSet generate a kubernetes.Clientset from an EKS Cluster
-func NewKubeClientSet(cluster *types.Cluster) (*kubernetes.Clientset, error) {
-	gen, err := token.NewGenerator(true, false)
-	if err != nil {
-		return nil, err
-	}
-	opts := &token.GetTokenOptions{
-		ClusterID: *cluster.Name,
-	}
-	tok, err := gen.GetWithOptions(opts)
-	if err != nil {
-		return nil, err
+// NewKubeClientSet generate a kubernetes.Clientset from an EKS Cluster, the token is signed with awsProfile
+// (e.g. the AwsProfile of the TestConfig) and renewed before it expires (see KubeClientFactory)
+func NewKubeClientSet(cluster *types.Cluster, awsProfile string) (*kubernetes.Clientset, error) {
+	region := GetAwsRegion()
+	if cluster.Arn != nil {
+		if clusterArn, err := arn.Parse(*cluster.Arn); err == nil {
+			region = clusterArn.Region
+		}
 	}
-	ca, err := base64.StdEncoding.DecodeString(*cluster.CertificateAuthority.Data)
+
+	sess, err := GetAwsClientF(awsProfile, region)
 	if err != nil {
 		return nil, err
 	}
-	clientSet, err := kubernetes.NewForConfig(
-		&rest.Config{
-			Host:        *cluster.Endpoint,
-			BearerToken: tok.Token,
-			TLSClientConfig: rest.TLSClientConfig{
-				CAData: ca,
-			},
-		},
-	)
+	factory, err := NewKubeClientFactory(sess, cluster, awsProfile)
 	if err != nil {
 		return nil, err
 	}
-	return clientSet, nil
+	return factory.ClientSet()
 }
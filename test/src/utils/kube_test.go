@@ -0,0 +1,306 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"testing"
+	"time"
+)
+
+// newJobWatchers returns a fake clientset whose job watches are served by the returned channel,
+// each (re-)established watch receives a new fake watcher
+func newJobWatchers(objects ...*batchv1.Job) (*fake.Clientset, chan *watch.FakeWatcher) {
+	clientSet := fake.NewClientset()
+	for _, job := range objects {
+		_ = clientSet.Tracker().Add(job)
+	}
+
+	watchers := make(chan *watch.FakeWatcher, 10)
+	clientSet.PrependWatchReactor("jobs", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		watcher := watch.NewFakeWithChanSize(10, false)
+		watchers <- watcher
+		return true, watcher, nil
+	})
+	return clientSet, watchers
+}
+
+func newJobWithStatus(name string, status batchv1.JobStatus) *batchv1.Job {
+	job := newTestJob(name)
+	job.Namespace = "aurora"
+	job.Status = status
+	return job
+}
+
+func completeCondition() []batchv1.JobCondition {
+	return []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+}
+
+func TestWaitForJobCompletionSucceeds(t *testing.T) {
+	clientSet, watchers := newJobWatchers(newJobWithStatus("postgres-client", batchv1.JobStatus{Active: 1}))
+
+	go func() {
+		watcher := <-watchers
+		watcher.Modify(newJobWithStatus("postgres-client", batchv1.JobStatus{Active: 1}))
+		// the events of the other jobs of the namespace are ignored
+		watcher.Modify(newJobWithStatus("other", batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}}))
+		watcher.Modify(newJobWithStatus("postgres-client", batchv1.JobStatus{Succeeded: 1, Conditions: completeCondition()}))
+	}()
+
+	err := WaitForJobCompletion(context.Background(), clientSet, "aurora", "postgres-client", 10*time.Second)
+	require.NoError(t, err)
+}
+
+func TestWaitForJobCompletionAlreadyComplete(t *testing.T) {
+	clientSet, _ := newJobWatchers(newJobWithStatus("postgres-client", batchv1.JobStatus{Succeeded: 1, Conditions: completeCondition()}))
+
+	err := WaitForJobCompletion(context.Background(), clientSet, "aurora", "postgres-client", 10*time.Second)
+	require.NoError(t, err)
+}
+
+func TestWaitForJobCompletionFailsFast(t *testing.T) {
+	clientSet, watchers := newJobWatchers()
+
+	go func() {
+		watcher := <-watchers
+		// the job is created after the beginning of the wait
+		watcher.Add(newJobWithStatus("postgres-client", batchv1.JobStatus{Active: 1}))
+		watcher.Modify(newJobWithStatus("postgres-client", batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"},
+		}}))
+	}()
+
+	start := time.Now()
+	err := WaitForJobCompletion(context.Background(), clientSet, "aurora", "postgres-client", time.Minute)
+
+	var terminalErr *TerminalStateError
+	require.ErrorAs(t, err, &terminalErr)
+	assert.Equal(t, "Failed", terminalErr.State)
+	assert.Equal(t, "BackoffLimitExceeded: Job has reached the specified backoff limit (active=0 succeeded=0 failed=1)", terminalErr.Reason)
+	// a failed job has no CompletionTime, the wait must not last until the timeout
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestWaitForJobCompletionParallelCompletions(t *testing.T) {
+	job := newJobWithStatus("postgres-client", batchv1.JobStatus{Active: 3})
+	completions := int32(3)
+	job.Spec.Completions = &completions
+	clientSet, watchers := newJobWatchers(job)
+
+	go func() {
+		watcher := <-watchers
+		for succeeded := int32(1); succeeded <= completions; succeeded++ {
+			update := job.DeepCopy()
+			update.Status = batchv1.JobStatus{Active: completions - succeeded, Succeeded: succeeded}
+			watcher.Modify(update)
+		}
+	}()
+
+	// the Complete condition may not be set yet when the last pod succeeded
+	err := WaitForJobCompletion(context.Background(), clientSet, "aurora", "postgres-client", 10*time.Second)
+	require.NoError(t, err)
+
+	// a single succeeded pod does not complete the job
+	job.Status = batchv1.JobStatus{Active: 2, Succeeded: 1}
+	clientSet, _ = newJobWatchers(job)
+	err = WaitForJobCompletion(context.Background(), clientSet, "aurora", "postgres-client", 200*time.Millisecond)
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, "active=2 succeeded=1/3 failed=0", timeoutErr.LastState)
+}
+
+func TestWaitForJobCompletionReestablishesTheWatch(t *testing.T) {
+	clientSet, watchers := newJobWatchers(newJobWithStatus("postgres-client", batchv1.JobStatus{Active: 1}))
+
+	go func() {
+		// the API server closes the watch before the completion of the job
+		first := <-watchers
+		first.Modify(newJobWithStatus("postgres-client", batchv1.JobStatus{Active: 1}))
+		first.Stop()
+
+		second := <-watchers
+		second.Modify(newJobWithStatus("postgres-client", batchv1.JobStatus{Succeeded: 1, Conditions: completeCondition()}))
+	}()
+
+	err := WaitForJobCompletion(context.Background(), clientSet, "aurora", "postgres-client", 10*time.Second)
+	require.NoError(t, err)
+}
+
+func TestWaitForJobCompletionTimeout(t *testing.T) {
+	clientSet, _ := newJobWatchers(newJobWithStatus("postgres-client", batchv1.JobStatus{Active: 1}))
+
+	err := WaitForJobCompletion(context.Background(), clientSet, "aurora", "postgres-client", 200*time.Millisecond)
+
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, "active=1 succeeded=0 failed=0", timeoutErr.LastState)
+}
+
+func TestWaitForJobCompletionDeleted(t *testing.T) {
+	job := newJobWithStatus("postgres-client", batchv1.JobStatus{Active: 1})
+	clientSet, watchers := newJobWatchers(job)
+
+	go func() {
+		watcher := <-watchers
+		watcher.Delete(job)
+	}()
+
+	err := WaitForJobCompletion(context.Background(), clientSet, "aurora", "postgres-client", 10*time.Second)
+	assert.True(t, IsTerminalState(err))
+	assert.ErrorContains(t, err, "Deleted")
+}
+
+func TestCheckJobStatus(t *testing.T) {
+	backoffLimit := int32(1)
+	tests := []struct {
+		name     string
+		status   batchv1.JobStatus
+		done     bool
+		terminal string
+	}{
+		{name: "running", status: batchv1.JobStatus{Active: 1}},
+		{name: "complete", status: batchv1.JobStatus{Succeeded: 1, Conditions: completeCondition()}, done: true},
+		{name: "condition not true", status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionFalse}}}},
+		{
+			name:     "failure target",
+			status:   batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailureTarget, Status: corev1.ConditionTrue, Reason: "DeadlineExceeded", Message: "Job was active longer than specified deadline"}}},
+			terminal: "DeadlineExceeded: Job was active longer than specified deadline (active=0 succeeded=0 failed=1)",
+		},
+		{name: "backoff limit", status: batchv1.JobStatus{Failed: 2}, terminal: "2 failed pods, the backoffLimit is 1 (active=0 succeeded=0 failed=2)"},
+		{name: "within backoff limit", status: batchv1.JobStatus{Active: 1, Failed: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "job"}, Spec: batchv1.JobSpec{BackoffLimit: &backoffLimit}, Status: tt.status}
+			done, err := checkJobStatus("job", job)
+			assert.Equal(t, tt.done, done)
+			if tt.terminal == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var terminalErr *TerminalStateError
+			require.ErrorAs(t, err, &terminalErr)
+			assert.Equal(t, tt.terminal, terminalErr.Reason)
+		})
+	}
+}
+
+func TestCreateIfNotExistsNamespace(t *testing.T) {
+	ctx := context.Background()
+	clientSet := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "existing", Labels: map[string]string{"team": "infra"}}})
+
+	require.NoError(t, CreateIfNotExistsNamespaceE(ctx, clientSet, "aurora"))
+	_, err := clientSet.CoreV1().Namespaces().Get(ctx, "aurora", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// an existing namespace is left as is
+	clientSet.ClearActions()
+	require.NoError(t, CreateIfNotExistsNamespaceE(ctx, clientSet, "existing"))
+	require.Len(t, clientSet.Actions(), 1)
+	assert.Equal(t, "get", clientSet.Actions()[0].GetVerb())
+	existing, err := clientSet.CoreV1().Namespaces().Get(ctx, "existing", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "infra"}, existing.Labels)
+}
+
+func TestCreateIfNotExistsNamespaceErrors(t *testing.T) {
+	ctx := context.Background()
+
+	// the namespace has been created by another suite between the get and the create
+	clientSet := fake.NewClientset()
+	clientSet.PrependReactor("create", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewAlreadyExists(corev1.Resource("namespaces"), "aurora")
+	})
+	assert.NoError(t, CreateIfNotExistsNamespaceE(ctx, clientSet, "aurora"))
+
+	clientSet = fake.NewClientset()
+	clientSet.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("namespaces"), "aurora", errors.New("rbac"))
+	})
+	err := CreateIfNotExistsNamespaceE(ctx, clientSet, "aurora")
+	assert.True(t, IsAccessDenied(err))
+}
+
+func TestCreateIfNotExistsServiceAccount(t *testing.T) {
+	ctx := context.Background()
+	clientSet := fake.NewClientset(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:        "drifted-sa",
+		Namespace:   "aurora",
+		Annotations: map[string]string{roleAnnotation: "arn:aws:iam::123456789012:role/AuroraRole-previous-run"},
+	}})
+	annotations := map[string]string{roleAnnotation: "arn:aws:iam::123456789012:role/AuroraRole-cluster-rds"}
+
+	require.NoError(t, CreateIfNotExistsServiceAccountE(ctx, clientSet, "aurora", "aurora-access-sa", annotations))
+	serviceAccount, err := clientSet.CoreV1().ServiceAccounts("aurora").Get(ctx, "aurora-access-sa", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, annotations, serviceAccount.Annotations)
+
+	// the annotations of an existing service account are not updated
+	require.NoError(t, CreateIfNotExistsServiceAccountE(ctx, clientSet, "aurora", "drifted-sa", annotations))
+	drifted, err := clientSet.CoreV1().ServiceAccounts("aurora").Get(ctx, "drifted-sa", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/AuroraRole-previous-run", drifted.Annotations[roleAnnotation])
+
+	// the service accounts of other namespaces are ignored
+	require.NoError(t, CreateIfNotExistsServiceAccountE(ctx, clientSet, "opensearch", "drifted-sa", annotations))
+	other, err := clientSet.CoreV1().ServiceAccounts("opensearch").Get(ctx, "drifted-sa", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, annotations, other.Annotations)
+}
+
+func TestWaitUntilServiceAvailable(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	ctx := context.Background()
+	clientSet := fake.NewClientset(
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "whoami-service", Namespace: "example"}},
+		&corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: "whoami-service", Namespace: "example"}, Subsets: []corev1.EndpointSubset{
+			{NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}},
+		}},
+	)
+
+	err := WaitUntilServiceAvailable(ctx, clientSet, "example", "whoami-service", 200*time.Millisecond)
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, "NoReadyEndpoints", timeoutErr.LastState)
+
+	err = WaitUntilServiceAvailable(ctx, clientSet, "example", "missing", 200*time.Millisecond)
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, "NotFound", timeoutErr.LastState)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = clientSet.CoreV1().Endpoints("example").Update(ctx, &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: "whoami-service", Namespace: "example"}, Subsets: []corev1.EndpointSubset{
+			{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}},
+		}}, metav1.UpdateOptions{})
+	}()
+	require.NoError(t, WaitUntilServiceAvailable(ctx, clientSet, "example", "whoami-service", 5*time.Second))
+}
+
+func TestWaitForJobCompletionRetriedPods(t *testing.T) {
+	job := newJobWithStatus("postgres-client", batchv1.JobStatus{Active: 1})
+	backoffLimit := int32(2)
+	job.Spec.BackoffLimit = &backoffLimit
+	clientSet, watchers := newJobWatchers(job)
+
+	go func() {
+		watcher := <-watchers
+		// the failed pods within the backoffLimit are retried, only the last event decides
+		for _, status := range []batchv1.JobStatus{{Active: 1, Failed: 1}, {Active: 1, Failed: 2}, {Succeeded: 1, Failed: 2, Conditions: completeCondition()}} {
+			update := job.DeepCopy()
+			update.Status = status
+			watcher.Modify(update)
+		}
+	}()
+
+	require.NoError(t, WaitForJobCompletion(context.Background(), clientSet, "aurora", "postgres-client", 10*time.Second))
+}
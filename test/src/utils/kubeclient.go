@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/eks/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// kubeTokenPrefix and kubeClusterIDHeader are the format of the tokens of aws-iam-authenticator:
+	// a presigned sts:GetCallerIdentity URL signing the name of the cluster
+	kubeTokenPrefix     = "k8s-aws-v1."
+	kubeClusterIDHeader = "x-k8s-aws-id"
+	// KubeTokenLifetime is the validity of a token, STS accepts the presigned URL for 15 minutes and a minute of margin is kept
+	KubeTokenLifetime = 14 * time.Minute
+	// kubeTokenRefreshMargin is the remaining validity under which a token is renewed
+	kubeTokenRefreshMargin = 4 * time.Minute
+)
+
+// KubeToken is a bearer token of an EKS cluster
+type KubeToken struct {
+	Value      string
+	Expiration time.Time
+}
+
+// NewKubeToken returns a token of the EKS cluster signed with the credentials of sess, like `aws eks get-token`
+func NewKubeToken(ctx context.Context, sess aws.Config, clusterName string) (KubeToken, error) {
+	presignClient := sts.NewPresignClient(sts.NewFromConfig(sess))
+	request, err := presignClient.PresignGetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}, func(o *sts.PresignOptions) {
+		o.ClientOptions = append(o.ClientOptions, func(o *sts.Options) {
+			o.APIOptions = append(o.APIOptions,
+				smithyhttp.AddHeaderValue(kubeClusterIDHeader, clusterName),
+				smithyhttp.AddHeaderValue("X-Amz-Expires", "60"),
+			)
+		})
+	})
+	if err != nil {
+		return KubeToken{}, fmt.Errorf("failed to presign the token of the cluster %s: %w", clusterName, err)
+	}
+
+	return KubeToken{
+		Value:      kubeTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(request.URL)),
+		Expiration: time.Now().Add(KubeTokenLifetime),
+	}, nil
+}
+
+// KubeClientFactory builds the kubernetes clients and kubeconfigs of an EKS cluster without the aws CLI.
+// Its tokens are renewed before they expire, so the clients stay valid for the whole duration of the suites.
+type KubeClientFactory struct {
+	ClusterName string
+	Endpoint    string
+	CAData      []byte
+	// Region and AwsProfile are used by the exec credential plugin of WriteExecKubeconfig
+	Region     string
+	AwsProfile string
+
+	sess  aws.Config
+	mu    sync.Mutex
+	token KubeToken
+	// newToken is NewKubeToken, the unit tests replace it
+	newToken func(ctx context.Context, sess aws.Config, clusterName string) (KubeToken, error)
+}
+
+// NewKubeClientFactory returns the factory of the cluster described by DescribeCluster, the tokens are signed with sess
+// and awsProfile is the profile used by the exec credential plugin, it must be the profile of sess
+func NewKubeClientFactory(sess aws.Config, cluster *types.Cluster, awsProfile string) (*KubeClientFactory, error) {
+	if cluster == nil || cluster.Name == nil || cluster.Endpoint == nil || cluster.CertificateAuthority == nil || cluster.CertificateAuthority.Data == nil {
+		return nil, errors.New("the cluster has no name, endpoint or certificate authority, is it active?")
+	}
+
+	ca, err := base64.StdEncoding.DecodeString(*cluster.CertificateAuthority.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the certificate authority of the cluster %s: %w", *cluster.Name, err)
+	}
+
+	return &KubeClientFactory{
+		ClusterName: *cluster.Name,
+		Endpoint:    *cluster.Endpoint,
+		CAData:      ca,
+		Region:      sess.Region,
+		AwsProfile:  awsProfile,
+		sess:        sess,
+		newToken:    NewKubeToken,
+	}, nil
+}
+
+// DescribeKubeClientFactory describes the EKS cluster and returns its factory (see NewKubeClientFactory)
+func DescribeKubeClientFactory(ctx context.Context, sess aws.Config, clusterName, awsProfile string) (*KubeClientFactory, error) {
+	output, err := eks.NewFromConfig(sess).DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(clusterName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the cluster %s: %w", clusterName, err)
+	}
+	return NewKubeClientFactory(sess, output.Cluster, awsProfile)
+}
+
+// Token returns a valid token of the cluster, a new one is signed when the current one is about to expire
+func (f *KubeClientFactory) Token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if time.Until(f.token.Expiration) > kubeTokenRefreshMargin {
+		return f.token.Value, nil
+	}
+
+	token, err := f.newToken(ctx, f.sess, f.ClusterName)
+	if err != nil {
+		return "", err
+	}
+	f.token = token
+	return token.Value, nil
+}
+
+// invalidateToken forces the renewal of the token, e.g. when the API server rejected it
+func (f *KubeClientFactory) invalidateToken() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.token = KubeToken{}
+}
+
+// kubeTokenTransport authenticates each request with the current token of the factory
+type kubeTokenTransport struct {
+	base    http.RoundTripper
+	factory *KubeClientFactory
+}
+
+func (t *kubeTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.factory.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// the request is not replayed (its body may be consumed), the next one uses a new token
+		t.factory.invalidateToken()
+	}
+	return resp, err
+}
+
+// RESTConfig returns the configuration of the clients of the cluster, every request uses a valid token
+func (f *KubeClientFactory) RESTConfig() *rest.Config {
+	return &rest.Config{
+		Host: f.Endpoint,
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData: f.CAData,
+		},
+		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+			return &kubeTokenTransport{base: rt, factory: f}
+		},
+	}
+}
+
+// ClientSet returns a kubernetes clientset of the cluster
+func (f *KubeClientFactory) ClientSet() (*kubernetes.Clientset, error) {
+	return kubernetes.NewForConfig(f.RESTConfig())
+}
+
+// kubeconfig returns the kubeconfig of the cluster with the given user, the context is named after the cluster
+func (f *KubeClientFactory) kubeconfig(authInfo *clientcmdapi.AuthInfo) *clientcmdapi.Config {
+	config := clientcmdapi.NewConfig()
+	config.Clusters[f.ClusterName] = &clientcmdapi.Cluster{
+		Server:                   f.Endpoint,
+		CertificateAuthorityData: f.CAData,
+	}
+	config.AuthInfos[f.ClusterName] = authInfo
+	config.Contexts[f.ClusterName] = &clientcmdapi.Context{Cluster: f.ClusterName, AuthInfo: f.ClusterName}
+	config.CurrentContext = f.ClusterName
+	return config
+}
+
+// KubeTokenFile returns the path of the token file of the kubeconfig written by WriteKubeconfig
+func KubeTokenFile(kubeconfigPath string) string {
+	return kubeconfigPath + ".token"
+}
+
+// WriteKubeconfig writes a kubeconfig of the cluster reading its token from KubeTokenFile(path),
+// the token file is renewed in background until ctx is done. No binary is needed to use the kubeconfig,
+// client-go and kubectl read the token file again when it changes.
+func (f *KubeClientFactory) WriteKubeconfig(ctx context.Context, path string) error {
+	tokenFile := KubeTokenFile(path)
+	if err := f.writeTokenFile(ctx, tokenFile); err != nil {
+		return err
+	}
+
+	if err := f.writeKubeconfig(path, &clientcmdapi.AuthInfo{TokenFile: tokenFile}); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := f.writeTokenFile(ctx, tokenFile); err != nil && ctx.Err() == nil {
+					fmt.Printf("Failed to renew the token of the cluster %s: %v\n", f.ClusterName, err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// WriteExecKubeconfig writes a kubeconfig of the cluster using the `aws eks get-token` exec credential plugin,
+// like `aws eks update-kubeconfig`, for the kubeconfigs used outside of the tests
+func (f *KubeClientFactory) WriteExecKubeconfig(path string) error {
+	args := []string{"--region", f.Region, "eks", "get-token", "--cluster-name", f.ClusterName, "--output", "json"}
+	var env []clientcmdapi.ExecEnvVar
+	if f.AwsProfile != "" {
+		env = append(env, clientcmdapi.ExecEnvVar{Name: "AWS_PROFILE", Value: f.AwsProfile})
+	}
+
+	return f.writeKubeconfig(path, &clientcmdapi.AuthInfo{
+		Exec: &clientcmdapi.ExecConfig{
+			APIVersion:      "client.authentication.k8s.io/v1beta1",
+			Command:         "aws",
+			Args:            args,
+			Env:             env,
+			InteractiveMode: clientcmdapi.NeverExecInteractiveMode,
+		},
+	})
+}
+
+func (f *KubeClientFactory) writeKubeconfig(path string, authInfo *clientcmdapi.AuthInfo) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := clientcmd.WriteToFile(*f.kubeconfig(authInfo), path); err != nil {
+		return fmt.Errorf("failed to write the kubeconfig of the cluster %s: %w", f.ClusterName, err)
+	}
+	return nil
+}
+
+// writeTokenFile writes the current token, the file is replaced atomically as it may be read concurrently
+func (f *KubeClientFactory) writeTokenFile(ctx context.Context, tokenFile string) error {
+	token, err := f.Token(ctx)
+	if err != nil {
+		return err
+	}
+
+	tmpFile := tokenFile + ".tmp"
+	if err := os.WriteFile(tmpFile, []byte(token), 0o600); err != nil {
+		return fmt.Errorf("failed to write the token file: %w", err)
+	}
+	return os.Rename(tmpFile, tokenFile)
+}
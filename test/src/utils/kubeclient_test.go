@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/camunda/camunda-tf-eks-module/utils/awsfake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKubeAPIServer is a TLS server answering /version and recording the Authorization headers
+type fakeKubeAPIServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	tokens []string
+	// reject is the number of requests answered with 401
+	reject int
+}
+
+func newFakeKubeAPIServer(t *testing.T) *fakeKubeAPIServer {
+	server := &fakeKubeAPIServer{}
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+
+		server.tokens = append(server.tokens, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if server.reject > 0 {
+			server.reject--
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major": "1", "minor": "31", "gitVersion": "v1.31.0-eks"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *fakeKubeAPIServer) caData() string {
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}))
+}
+
+func (s *fakeKubeAPIServer) rejectNext(count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject = count
+}
+
+func (s *fakeKubeAPIServer) receivedTokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.tokens...)
+}
+
+func newFakeKubeClientFactory(t *testing.T) (*KubeClientFactory, *fakeKubeAPIServer) {
+	apiServer := newFakeKubeAPIServer(t)
+	server, sess := newFakeAwsConfig(t)
+	server.AddCluster(awsfake.Cluster{Name: "cluster-test", Version: "1.31", Status: "ACTIVE", Endpoint: apiServer.URL, CAData: apiServer.caData()})
+
+	factory, err := DescribeKubeClientFactory(context.Background(), sess, "cluster-test", "infex-config")
+	require.NoError(t, err)
+	return factory, apiServer
+}
+
+func TestNewKubeToken(t *testing.T) {
+	_, sess := newFakeAwsConfig(t)
+
+	token, err := NewKubeToken(context.Background(), sess, "cluster-test")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(KubeTokenLifetime), token.Expiration, time.Minute)
+
+	require.True(t, strings.HasPrefix(token.Value, "k8s-aws-v1."))
+	presignedURL, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token.Value, "k8s-aws-v1."))
+	require.NoError(t, err)
+	parsed, err := url.Parse(string(presignedURL))
+	require.NoError(t, err)
+
+	query := parsed.Query()
+	assert.Equal(t, "GetCallerIdentity", query.Get("Action"))
+	assert.Equal(t, "60", query.Get("X-Amz-Expires"))
+	assert.Contains(t, query.Get("X-Amz-SignedHeaders"), "x-k8s-aws-id")
+	assert.NotEmpty(t, query.Get("X-Amz-Signature"))
+}
+
+func TestKubeClientFactoryRenewsTokens(t *testing.T) {
+	factory, apiServer := newFakeKubeClientFactory(t)
+	tokens := 0
+	factory.newToken = func(ctx context.Context, sess aws.Config, clusterName string) (KubeToken, error) {
+		tokens++
+		// the second token is already close to its expiration
+		return KubeToken{Value: fmt.Sprintf("token-%d", tokens), Expiration: time.Now().Add(time.Duration(tokens%2) * time.Hour)}, nil
+	}
+
+	clientSet, err := factory.ClientSet()
+	require.NoError(t, err)
+
+	for range 2 {
+		version, err := clientSet.Discovery().ServerVersion()
+		require.NoError(t, err)
+		assert.Equal(t, "v1.31.0-eks", version.GitVersion)
+	}
+	assert.Equal(t, []string{"token-1", "token-1"}, apiServer.receivedTokens())
+
+	// a rejected token is renewed for the next request
+	apiServer.rejectNext(1)
+	_, err = clientSet.Discovery().ServerVersion()
+	require.Error(t, err)
+	_, err = clientSet.Discovery().ServerVersion()
+	require.NoError(t, err)
+	_, err = clientSet.Discovery().ServerVersion()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"token-1", "token-1", "token-1", "token-2", "token-3"}, apiServer.receivedTokens())
+}
+
+func TestKubeClientFactoryWriteKubeconfig(t *testing.T) {
+	factory, apiServer := newFakeKubeClientFactory(t)
+	factory.newToken = func(ctx context.Context, sess aws.Config, clusterName string) (KubeToken, error) {
+		return KubeToken{Value: "token-" + clusterName, Expiration: time.Now().Add(time.Hour)}, nil
+	}
+	kubeconfigPath := filepath.Join(t.TempDir(), "kubeconfig")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, factory.WriteKubeconfig(ctx, kubeconfigPath))
+
+	token, err := os.ReadFile(KubeTokenFile(kubeconfigPath))
+	require.NoError(t, err)
+	assert.Equal(t, "token-cluster-test", string(token))
+
+	config, err := clientcmd.LoadFromFile(kubeconfigPath)
+	require.NoError(t, err)
+	assert.Equal(t, "cluster-test", config.CurrentContext)
+	assert.Equal(t, apiServer.URL, config.Clusters["cluster-test"].Server)
+	assert.Equal(t, KubeTokenFile(kubeconfigPath), config.AuthInfos["cluster-test"].TokenFile)
+
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	require.NoError(t, err)
+	request, err := http.NewRequest(http.MethodGet, apiServer.URL+"/version", nil)
+	require.NoError(t, err)
+	transport, err := rest.TransportFor(restConfig)
+	require.NoError(t, err)
+	resp, err := transport.RoundTrip(request)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"token-cluster-test"}, apiServer.receivedTokens())
+}
+
+func TestKubeClientFactoryWriteExecKubeconfig(t *testing.T) {
+	factory, _ := newFakeKubeClientFactory(t)
+	// the profile of the configuration is used, not the one of the environment
+	t.Setenv("AWS_PROFILE", "infex-env")
+	kubeconfigPath := filepath.Join(t.TempDir(), "kubeconfig")
+
+	require.NoError(t, factory.WriteExecKubeconfig(kubeconfigPath))
+
+	config, err := clientcmd.LoadFromFile(kubeconfigPath)
+	require.NoError(t, err)
+	exec := config.AuthInfos["cluster-test"].Exec
+	require.NotNil(t, exec)
+	assert.Equal(t, "aws", exec.Command)
+	assert.Equal(t, []string{"--region", "eu-central-1", "eks", "get-token", "--cluster-name", "cluster-test", "--output", "json"}, exec.Args)
+	assert.Equal(t, "AWS_PROFILE", exec.Env[0].Name)
+	assert.Equal(t, "infex-config", exec.Env[0].Value)
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NodeGroupLabel is the label set by EKS on the nodes of a managed node group
+const NodeGroupLabel = "eks.amazonaws.com/nodegroup"
+
+// nodeTracker keeps the readiness of the nodes observed by the informer, indexed by node name
+type nodeTracker struct {
+	mu    sync.Mutex
+	nodes map[string]bool
+	// departed contains the nodes that have been seen and then deleted
+	departed map[string]struct{}
+}
+
+func newNodeTracker() *nodeTracker {
+	return &nodeTracker{nodes: make(map[string]bool), departed: make(map[string]struct{})}
+}
+
+func (n *nodeTracker) upsert(node *corev1.Node) {
+	ready := IsNodeReady(node)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	previous, known := n.nodes[node.Name]
+	switch {
+	case !known:
+		fmt.Printf("Worker Node %s has joined the EKS cluster at %s (ready=%t)\n", node.Name, node.CreationTimestamp, ready)
+	case previous != ready:
+		fmt.Printf("Worker Node %s readiness changed to %t\n", node.Name, ready)
+	}
+	n.nodes[node.Name] = ready
+	delete(n.departed, node.Name)
+}
+
+func (n *nodeTracker) remove(name string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, known := n.nodes[name]; known {
+		fmt.Printf("Worker Node %s has left the EKS cluster\n", name)
+		delete(n.nodes, name)
+		n.departed[name] = struct{}{}
+	}
+}
+
+// snapshot returns the sorted names of the ready, not ready and departed nodes
+func (n *nodeTracker) snapshot() (ready []string, notReady []string, departed []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for name := range n.departed {
+		departed = append(departed, name)
+	}
+	slices.Sort(departed)
+
+	for name, isReady := range n.nodes {
+		if isReady {
+			ready = append(ready, name)
+		} else {
+			notReady = append(notReady, name)
+		}
+	}
+	slices.Sort(ready)
+	slices.Sort(notReady)
+	return ready, notReady, departed
+}
+
+// IsNodeReady returns true if the NodeReady condition of the node is True
+func IsNodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// WaitUntilNodesReady waits until at least expectedNodesCount nodes report a True NodeReady condition.
+// If nodeGroup is not empty, only the nodes of this EKS managed node group are considered.
+// On timeout, the returned TimeoutError lists the nodes that are NotReady and the number of missing nodes.
+func WaitUntilNodesReady(ctx context.Context, clientSet kubernetes.Interface, expectedNodesCount int, nodeGroup string, timeout time.Duration) error {
+	var factoryOptions []informers.SharedInformerOption
+	if nodeGroup != "" {
+		factoryOptions = append(factoryOptions, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = fmt.Sprintf("%s=%s", NodeGroupLabel, nodeGroup)
+		}))
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientSet, 0, factoryOptions...)
+	informer := factory.Core().V1().Nodes().Informer()
+	tracker := newNodeTracker()
+
+	_, errEventHandler := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*corev1.Node); ok {
+				tracker.upsert(node)
+			}
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			if node, ok := newObj.(*corev1.Node); ok {
+				tracker.upsert(node)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if node, ok := obj.(*corev1.Node); ok {
+				tracker.remove(node.Name)
+			}
+		},
+	})
+	if errEventHandler != nil {
+		return errEventHandler
+	}
+
+	stopChannel := make(chan struct{})
+	factory.Start(stopChannel)
+	defer func() {
+		// stop the informer and wait for its goroutines to exit
+		close(stopChannel)
+		factory.Shutdown()
+	}()
+
+	description := fmt.Sprintf("%d ready worker nodes", expectedNodesCount)
+	if nodeGroup != "" {
+		description = fmt.Sprintf("%s in node group %s", description, nodeGroup)
+	}
+
+	opts := DefaultWaitOptions(description, timeout)
+	opts.MaxInterval = min(opts.MaxInterval, 5*time.Second)
+	warnedExtraNodes := false
+	errWait := WaitFor(ctx, opts, func(ctx context.Context) (bool, error) {
+		if !informer.HasSynced() {
+			WaitState(ctx, "informer not synced")
+			return false, nil
+		}
+
+		ready, notReady, departed := tracker.snapshot()
+		WaitState(ctx, nodesState(ready, notReady, departed, expectedNodesCount))
+
+		if total := len(ready) + len(notReady); total > expectedNodesCount && !warnedExtraNodes {
+			fmt.Printf("Warning: More nodes (%d) than expected (%d) have joined the cluster.\n", total, expectedNodesCount)
+			warnedExtraNodes = true
+		}
+		return len(ready) >= expectedNodesCount, nil
+	})
+	if errWait != nil {
+		fmt.Printf("Not all worker nodes are ready: %v\n", errWait)
+		return errWait
+	}
+
+	fmt.Println("All worker nodes are ready")
+	return nil
+}
+
+// nodesState describes the readiness of the nodes, listing the NotReady and missing ones
+func nodesState(ready []string, notReady []string, departed []string, expectedNodesCount int) string {
+	state := fmt.Sprintf("%d/%d nodes ready", len(ready), expectedNodesCount)
+	if len(notReady) > 0 {
+		state = fmt.Sprintf("%s, NotReady: [%s]", state, strings.Join(notReady, ", "))
+	}
+	if missing := expectedNodesCount - len(ready) - len(notReady); missing > 0 {
+		state = fmt.Sprintf("%s, missing: %d", state, missing)
+		if len(departed) > 0 {
+			state = fmt.Sprintf("%s (departed: [%s])", state, strings.Join(departed, ", "))
+		}
+	}
+	return state
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"testing"
+	"time"
+)
+
+func newTestNode(name string, nodeGroup string, ready bool) *corev1.Node {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{NodeGroupLabel: nodeGroup},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+		},
+	}
+}
+
+func TestWaitUntilNodesReadyIgnoresNotReadyNodes(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	clientSet := fake.NewClientset(
+		newTestNode("node-a", "services", true),
+		newTestNode("node-b", "services", false),
+	)
+
+	err := WaitUntilNodesReady(context.Background(), clientSet, 2, "", time.Second)
+
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, "1/2 nodes ready, NotReady: [node-b]", timeoutErr.LastState)
+}
+
+func TestWaitUntilNodesReadyReportsMissingNodes(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	clientSet := fake.NewClientset(newTestNode("node-a", "services", true))
+
+	err := WaitUntilNodesReady(context.Background(), clientSet, 3, "", time.Second)
+
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, "1/3 nodes ready, missing: 2", timeoutErr.LastState)
+}
+
+func TestWaitUntilNodesReadyFiltersNodeGroup(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	clientSet := fake.NewClientset(
+		newTestNode("node-a", "services", true),
+		newTestNode("node-b", "other", true),
+	)
+
+	require.NoError(t, WaitUntilNodesReady(context.Background(), clientSet, 1, "services", 5*time.Second))
+
+	err := WaitUntilNodesReady(context.Background(), clientSet, 2, "services", time.Second)
+	assert.True(t, IsTimeout(err))
+}
+
+func TestWaitUntilNodesReadyObservesUpdates(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	clientSet := fake.NewClientset(newTestNode("node-a", "services", false))
+
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		_, _ = clientSet.CoreV1().Nodes().Update(context.Background(), newTestNode("node-a", "services", true), metav1.UpdateOptions{})
+	}()
+
+	require.NoError(t, WaitUntilNodesReady(context.Background(), clientSet, 1, "", 10*time.Second))
+}
+
+func TestNodesStateReportsDepartedNodes(t *testing.T) {
+	tracker := newNodeTracker()
+	tracker.upsert(newTestNode("node-a", "services", true))
+	tracker.upsert(newTestNode("node-b", "services", true))
+	tracker.remove("node-b")
+
+	ready, notReady, departed := tracker.snapshot()
+	assert.Equal(t, "1/2 nodes ready, missing: 1 (departed: [node-b])", nodesState(ready, notReady, departed, 2))
+}
+
+// watchNodes serves the node watches of the clientset with fake watchers fed with events in order
+func watchNodes(clientSet *fake.Clientset, events ...watch.Event) {
+	clientSet.PrependWatchReactor("nodes", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		watcher := watch.NewFakeWithChanSize(len(events), false)
+		for _, event := range events {
+			watcher.Action(event.Type, event.Object)
+		}
+		return true, watcher, nil
+	})
+}
+
+func TestWaitUntilNodesReadyFollowsTheOrderOfTheEvents(t *testing.T) {
+	events := []watch.Event{
+		{Type: watch.Added, Object: newTestNode("node-a", "services", true)},
+		{Type: watch.Added, Object: newTestNode("node-b", "services", false)},
+		{Type: watch.Deleted, Object: newTestNode("node-a", "services", true)},
+		{Type: watch.Modified, Object: newTestNode("node-b", "services", true)},
+	}
+
+	t.Run("departed node", func(t *testing.T) {
+		fastDefaultWaitOptions(t)
+		clientSet := fake.NewClientset()
+		watchNodes(clientSet, events...)
+
+		err := WaitUntilNodesReady(context.Background(), clientSet, 2, "", time.Second)
+
+		var timeoutErr *TimeoutError
+		require.ErrorAs(t, err, &timeoutErr)
+		assert.Equal(t, "1/2 nodes ready, missing: 1 (departed: [node-a])", timeoutErr.LastState)
+	})
+
+	t.Run("replaced node", func(t *testing.T) {
+		fastDefaultWaitOptions(t)
+		clientSet := fake.NewClientset()
+		watchNodes(clientSet, append(events, watch.Event{Type: watch.Added, Object: newTestNode("node-c", "services", true)})...)
+
+		require.NoError(t, WaitUntilNodesReady(context.Background(), clientSet, 2, "", 5*time.Second))
+	})
+}
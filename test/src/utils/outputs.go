@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/stretchr/testify/require"
+	"net/netip"
+)
+
+// ARN is an Amazon Resource Name decoded from a terraform output, an empty output is decoded as a zero ARN
+type ARN struct {
+	arn.ARN
+}
+
+// UnmarshalText parses the ARN
+func (a *ARN) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		a.ARN = arn.ARN{}
+		return nil
+	}
+
+	parsed, err := arn.Parse(string(text))
+	if err != nil {
+		return err
+	}
+	a.ARN = parsed
+	return nil
+}
+
+// IsZero returns whether the ARN is empty
+func (a ARN) IsZero() bool {
+	return a.ARN == arn.ARN{}
+}
+
+// EKSClusterOutputs are the outputs of modules/eks-cluster
+type EKSClusterOutputs struct {
+	ClusterEndpoint               string                     `json:"cluster_endpoint"`
+	ClusterSecurityGroupID        string                     `json:"cluster_security_group_id"`
+	ClusterSecurityGroupARN       ARN                        `json:"cluster_security_group_arn"`
+	ClusterPrimarySecurityGroupID string                     `json:"cluster_primary_security_group_id"`
+	ClusterIAMRoleName            string                     `json:"cluster_iam_role_name"`
+	ClusterIAMRoleARN             ARN                        `json:"cluster_iam_role_arn"`
+	AccessEntries                 map[string]json.RawMessage `json:"access_entries"`
+	ClusterARN                    ARN                        `json:"cluster_arn"`
+	CertManagerARN                ARN                        `json:"cert_manager_arn"`
+	EBSCSARN                      ARN                        `json:"ebs_cs_arn"`
+	ExternalDNSARN                ARN                        `json:"external_dns_arn"`
+	OIDCProviderARN               ARN                        `json:"oidc_provider_arn"`
+	AwsCallerIdentityAccountID    string                     `json:"aws_caller_identity_account_id"`
+	OIDCProviderID                string                     `json:"oidc_provider_id"`
+	VpcID                         string                     `json:"vpc_id"`
+	VpcAZs                        []string                   `json:"vpc_azs"`
+	PrivateVpcCidrBlocks          []netip.Prefix             `json:"private_vpc_cidr_blocks"`
+	PublicVpcCidrBlocks           []netip.Prefix             `json:"public_vpc_cidr_blocks"`
+	PrivateSubnetIDs              []string                   `json:"private_subnet_ids"`
+	DefaultSecurityGroupID        string                     `json:"default_security_group_id"`
+	VpcMainRouteTableID           string                     `json:"vpc_main_route_table_id"`
+	PrivateRouteTableIDs          []string                   `json:"private_route_table_ids"`
+}
+
+// VpcCidrBlocks returns the public and private CIDR blocks of the VPC
+func (o *EKSClusterOutputs) VpcCidrBlocks() []string {
+	return PrefixStrings(append(append([]netip.Prefix{}, o.PublicVpcCidrBlocks...), o.PrivateVpcCidrBlocks...)...)
+}
+
+// AuroraOutputs are the outputs of modules/aurora
+type AuroraOutputs struct {
+	Endpoint                string         `json:"aurora_endpoint"`
+	ID                      string         `json:"aurora_id"`
+	ClusterIdentifier       string         `json:"aurora_cluster_identifier"`
+	ClusterResourceID       string         `json:"aurora_cluster_resource_id"`
+	IAMRoleARNs             map[string]ARN `json:"aurora_iam_role_arns"`
+	IAMRoleAccessPolicyARNs map[string]ARN `json:"aurora_iam_role_access_policy_arns"`
+}
+
+// OpenSearchOutputs are the outputs of modules/opensearch
+type OpenSearchOutputs struct {
+	// Cluster is the whole aws_opensearch_domain resource (sensitive)
+	Cluster                  json.RawMessage `json:"opensearch_cluster"`
+	DomainEndpoint           string          `json:"opensearch_domain_endpoint"`
+	DomainARN                ARN             `json:"opensearch_domain_arn"`
+	DomainID                 string          `json:"opensearch_domain_id"`
+	KMSKeyARN                ARN             `json:"kms_key_arn"`
+	KMSKeyID                 string          `json:"kms_key_id"`
+	SecurityGroupID          string          `json:"security_group_id"`
+	SecurityGroupRuleIngress json.RawMessage `json:"security_group_rule_ingress"`
+	SecurityGroupRuleEgress  json.RawMessage `json:"security_group_rule_egress"`
+	IAMRoleARNs              map[string]ARN  `json:"opensearch_iam_role_arns"`
+	IAMRoleAccessPolicyARNs  map[string]ARN  `json:"opensearch_iam_role_access_policy_arns"`
+}
+
+// ModuleOutputs maps each module of modules/ to the type of its outputs
+var ModuleOutputs = map[string]interface{}{
+	"eks-cluster": EKSClusterOutputs{},
+	"aurora":      AuroraOutputs{},
+	"opensearch":  OpenSearchOutputs{},
+}
+
+// DecodeOutputs decodes the result of `terraform output -json` in target,
+// an output without a field in target is an error
+func DecodeOutputs(outputsJSON []byte, target interface{}) error {
+	var outputs map[string]struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(outputsJSON, &outputs); err != nil {
+		return fmt.Errorf("failed to parse the terraform outputs: %w", err)
+	}
+
+	values := make(map[string]json.RawMessage, len(outputs))
+	for name, output := range outputs {
+		values[name] = output.Value
+	}
+	rawValues, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(rawValues))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return fmt.Errorf("failed to decode the terraform outputs in %T: %w", target, err)
+	}
+	return nil
+}
+
+// LoadOutputsE reads all the outputs of the module applied with options in a T, e.g. EKSClusterOutputs
+func LoadOutputsE[T any](t testing.TestingT, options *terraform.Options) (*T, error) {
+	outputsJSON, err := terraform.OutputJsonE(t, options, "")
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := new(T)
+	if err := DecodeOutputs([]byte(outputsJSON), outputs); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// LoadOutputs reads all the outputs of the module applied with options in a T and fails the test on error
+func LoadOutputs[T any](t testing.TestingT, options *terraform.Options) *T {
+	outputs, err := LoadOutputsE[T](t, options)
+	require.NoError(t, err)
+	return outputs
+}
+
+// MustParsePrefixes parses CIDR blocks, it panics on an invalid block
+func MustParsePrefixes(blocks ...string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, len(blocks))
+	for i, block := range blocks {
+		prefixes[i] = netip.MustParsePrefix(block)
+	}
+	return prefixes
+}
+
+// PrefixStrings formats CIDR blocks, e.g. to pass them as variables of a module
+func PrefixStrings(prefixes ...netip.Prefix) []string {
+	blocks := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		blocks[i] = prefix.String()
+	}
+	return blocks
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testModulesDir is the path of the terraform modules relative to the tests of the utils package
+const testModulesDir = "../../../modules"
+
+const eksOutputsJSON = `{
+  "cluster_arn": {"sensitive": false, "type": "string", "value": "arn:aws:eks:eu-central-1:123456789012:cluster/cluster-test"},
+  "cluster_iam_role_name": {"sensitive": false, "type": "string", "value": "cluster-test-eks-iam-role"},
+  "ebs_cs_arn": {"sensitive": false, "type": "string", "value": ""},
+  "vpc_azs": {"sensitive": false, "type": ["list", "string"], "value": ["eu-central-1a", "eu-central-1b"]},
+  "private_vpc_cidr_blocks": {"sensitive": false, "type": ["list", "string"], "value": ["10.192.0.0/18", "10.192.64.0/18"]},
+  "public_vpc_cidr_blocks": {"sensitive": false, "type": ["list", "string"], "value": ["10.192.128.0/18", "10.192.192.0/18"]},
+  "access_entries": {"sensitive": false, "type": ["map", "string"], "value": {"admin": {"principal_arn": "arn"}}}
+}`
+
+func TestDecodeOutputs(t *testing.T) {
+	var outputs EKSClusterOutputs
+	require.NoError(t, DecodeOutputs([]byte(eksOutputsJSON), &outputs))
+
+	assert.Equal(t, "eks", outputs.ClusterARN.Service)
+	assert.Equal(t, "123456789012", outputs.ClusterARN.AccountID)
+	assert.Equal(t, "cluster/cluster-test", outputs.ClusterARN.Resource)
+	assert.True(t, outputs.EBSCSARN.IsZero())
+	assert.Equal(t, "cluster-test-eks-iam-role", outputs.ClusterIAMRoleName)
+	assert.Equal(t, []string{"eu-central-1a", "eu-central-1b"}, outputs.VpcAZs)
+	assert.Equal(t, MustParsePrefixes("10.192.0.0/18", "10.192.64.0/18"), outputs.PrivateVpcCidrBlocks)
+	assert.Equal(t, []string{"10.192.128.0/18", "10.192.192.0/18", "10.192.0.0/18", "10.192.64.0/18"}, outputs.VpcCidrBlocks())
+	assert.Contains(t, outputs.AccessEntries, "admin")
+}
+
+func TestDecodeOutputsFlagsUnknownOutputs(t *testing.T) {
+	var outputs AuroraOutputs
+	err := DecodeOutputs([]byte(`{"aurora_endpoint": {"value": "endpoint"}, "aurora_new_output": {"value": "x"}}`), &outputs)
+	assert.ErrorContains(t, err, "aurora_new_output")
+}
+
+func TestDecodeOutputsRejectsInvalidValues(t *testing.T) {
+	var outputs EKSClusterOutputs
+	assert.Error(t, DecodeOutputs([]byte(`{"private_vpc_cidr_blocks": {"value": ["10.192.0.0"]}}`), &outputs))
+	assert.Error(t, DecodeOutputs([]byte(`{"cluster_arn": {"value": "not-an-arn"}}`), &outputs))
+}
+
+// TestModuleOutputsMatchOutputsTf flags an output of a module without a field in its Go type and the other way around
+func TestModuleOutputsMatchOutputsTf(t *testing.T) {
+	outputRegexp := regexp.MustCompile(`(?m)^output\s+"([^"]+)"`)
+
+	for module, outputsType := range ModuleOutputs {
+		t.Run(module, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join(testModulesDir, module, "outputs.tf"))
+			require.NoError(t, err)
+
+			var declared []string
+			for _, match := range outputRegexp.FindAllStringSubmatch(string(content), -1) {
+				declared = append(declared, match[1])
+			}
+
+			var fields []string
+			structType := reflect.TypeOf(outputsType)
+			for i := 0; i < structType.NumField(); i++ {
+				name, _, _ := strings.Cut(structType.Field(i).Tag.Get("json"), ",")
+				fields = append(fields, name)
+			}
+
+			assert.ElementsMatchf(t, declared, fields, "outputs of %s/outputs.tf and fields of %s differ", module, structType.Name())
+		})
+	}
+}
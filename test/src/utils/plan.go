@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+	tfjson "github.com/hashicorp/terraform-json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PlanFileName is the plan written in the directory of the module by PlanE
+const PlanFileName = "tfplan"
+
+// MockAwsProviderFileName is the file of the AWS provider configuration written by WriteMockAwsProvider
+const MockAwsProviderFileName = "mock_aws_provider.tf"
+
+// mockedAwsServices are the endpoints of the AWS provider sent to the fake, they cover the data sources read by the modules
+var mockedAwsServices = []string{"ec2", "eks", "iam", "kms", "logs", "opensearch", "rds", "s3", "servicequotas", "sts"}
+
+// Plan is the JSON plan of a module (`terraform show -json`)
+type Plan struct {
+	*terraform.PlanStruct
+}
+
+// WriteMockAwsProvider configures the AWS provider of the module in tfDir with fake credentials and sends every call
+// to endpoint, e.g. the URL of an awsfake.Server, so the module can be planned without AWS account
+func WriteMockAwsProvider(tfDir, region, endpoint string) error {
+	var endpoints strings.Builder
+	for _, service := range mockedAwsServices {
+		fmt.Fprintf(&endpoints, "    %-13s = %q\n", service, endpoint)
+	}
+
+	content := fmt.Sprintf(`# generated by the tests, the provider talks to a fake of the AWS APIs
+provider "aws" {
+  region                      = %q
+  access_key                  = "AKIDFAKE"
+  secret_key                  = "fake-secret"
+  skip_credentials_validation = true
+  skip_metadata_api_check     = true
+  skip_region_validation      = true
+  skip_requesting_account_id  = true
+  s3_use_path_style           = true
+
+  endpoints {
+%s  }
+}
+`, region, endpoints.String())
+
+	return os.WriteFile(filepath.Join(tfDir, MockAwsProviderFileName), []byte(content), 0o644)
+}
+
+// PlanE runs `init -backend=false`, `plan -out` and `show -json` on the module of options, no resource is created
+func PlanE(t testing.TestingT, options *terraform.Options) (*Plan, error) {
+	if _, err := terraform.RunTerraformCommandE(t, options, "init", "-backend=false", "-input=false"); err != nil {
+		return nil, fmt.Errorf("failed to init %s: %w", options.TerraformDir, err)
+	}
+
+	if options.PlanFilePath == "" {
+		options.PlanFilePath = filepath.Join(options.TerraformDir, PlanFileName)
+	}
+	if _, err := terraform.PlanE(t, options); err != nil {
+		return nil, fmt.Errorf("failed to plan %s: %w", options.TerraformDir, err)
+	}
+
+	plan, err := terraform.ShowWithStructE(t, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to show the plan of %s: %w", options.TerraformDir, err)
+	}
+	return &Plan{PlanStruct: plan}, nil
+}
+
+// Resources returns the planned resources of the given type (e.g. aws_subnet) in every module, sorted by address
+func (p *Plan) Resources(resourceType string) []*tfjson.StateResource {
+	var resources []*tfjson.StateResource
+	for _, resource := range p.ResourcePlannedValuesMap {
+		if resource.Type == resourceType && resource.Mode == tfjson.ManagedResourceMode {
+			resources = append(resources, resource)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Address < resources[j].Address
+	})
+	return resources
+}
+
+// Actions returns the planned actions of the resource at address, e.g. [create]
+func (p *Plan) Actions(address string) (tfjson.Actions, bool) {
+	change, ok := p.ResourceChangesMap[address]
+	if !ok || change.Change == nil {
+		return nil, false
+	}
+	return change.Change.Actions, true
+}
+
+// PlannedValues decodes the planned attributes of the resources of the given type in T,
+// e.g. a struct with a `json:"cidr_block"` field for aws_subnet, the unknown attributes are left empty
+func PlannedValues[T any](p *Plan, resourceType string) ([]T, error) {
+	resources := p.Resources(resourceType)
+	values := make([]T, len(resources))
+	for i, resource := range resources {
+		raw, err := json.Marshal(resource.AttributeValues)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &values[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode the planned values of %s: %w", resource.Address, err)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/camunda/camunda-tf-eks-module/utils/awsfake"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteMockAwsProvider(t *testing.T) {
+	tfDir := t.TempDir()
+	require.NoError(t, WriteMockAwsProvider(tfDir, "eu-west-1", "http://127.0.0.1:1234"))
+
+	content, err := os.ReadFile(filepath.Join(tfDir, MockAwsProviderFileName))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `region                      = "eu-west-1"`)
+	assert.Contains(t, string(content), `skip_requesting_account_id  = true`)
+	for _, service := range mockedAwsServices {
+		assert.Regexp(t, `(?m)^\s+`+service+`\s+= "http://127.0.0.1:1234"$`, string(content))
+	}
+}
+
+func TestPlannedValues(t *testing.T) {
+	plan := &Plan{PlanStruct: &terraform.PlanStruct{
+		ResourcePlannedValuesMap: map[string]*tfjson.StateResource{
+			"module.vpc.aws_subnet.private[1]": {
+				Address: "module.vpc.aws_subnet.private[1]", Type: "aws_subnet", Mode: tfjson.ManagedResourceMode,
+				AttributeValues: map[string]interface{}{"cidr_block": "10.192.32.0/19"},
+			},
+			"module.vpc.aws_subnet.private[0]": {
+				Address: "module.vpc.aws_subnet.private[0]", Type: "aws_subnet", Mode: tfjson.ManagedResourceMode,
+				AttributeValues: map[string]interface{}{"cidr_block": "10.192.0.0/19"},
+			},
+			"data.aws_subnet.existing": {
+				Address: "data.aws_subnet.existing", Type: "aws_subnet", Mode: tfjson.DataResourceMode,
+				AttributeValues: map[string]interface{}{"cidr_block": "10.0.0.0/8"},
+			},
+		},
+	}}
+
+	subnets, err := PlannedValues[struct {
+		CidrBlock string `json:"cidr_block"`
+	}](plan, "aws_subnet")
+	require.NoError(t, err)
+	require.Len(t, subnets, 2)
+	assert.Equal(t, "10.192.0.0/19", subnets[0].CidrBlock)
+	assert.Equal(t, "10.192.32.0/19", subnets[1].CidrBlock)
+
+	_, err = PlannedValues[struct {
+		CidrBlock int `json:"cidr_block"`
+	}](plan, "aws_subnet")
+	assert.ErrorContains(t, err, "module.vpc.aws_subnet.private[0]")
+}
+
+// TestFakeDataSources covers the calls of the data sources of the modules when they are planned against the fake
+func TestFakeDataSources(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddVpc(awsfake.Vpc{ID: "vpc-1", CidrBlock: "10.192.0.0/16", Tags: map[string]string{"Name": "cluster-test-vpc"}})
+	server.AddVpc(awsfake.Vpc{ID: "vpc-2", CidrBlock: "10.0.0.0/16", Tags: map[string]string{"Name": "other-vpc"}})
+
+	identity, err := sts.NewFromConfig(sess).GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	require.NoError(t, err)
+	assert.Equal(t, server.AccountID, aws.ToString(identity.Account))
+
+	vpcs, err := ec2.NewFromConfig(sess).DescribeVpcs(context.Background(), &ec2.DescribeVpcsInput{
+		Filters: []ec2types.Filter{{Name: aws.String("tag:Name"), Values: []string{"cluster-test-vpc"}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, vpcs.Vpcs, 1)
+	assert.Equal(t, "vpc-1", aws.ToString(vpcs.Vpcs[0].VpcId))
+
+	addresses, err := ec2.NewFromConfig(sess).DescribeAddresses(context.Background(), &ec2.DescribeAddressesInput{})
+	require.NoError(t, err)
+	assert.Empty(t, addresses.Addresses)
+
+	versions, err := eks.NewFromConfig(sess).DescribeAddonVersions(context.Background(), &eks.DescribeAddonVersionsInput{
+		AddonName:         aws.String("vpc-cni"),
+		KubernetesVersion: aws.String("1.32"),
+	})
+	require.NoError(t, err)
+	require.Len(t, versions.Addons, 1)
+	assert.Equal(t, "v0.0.1-eksbuild.1", aws.ToString(versions.Addons[0].AddonVersions[0].AddonVersion))
+}
@@ -0,0 +1,428 @@
+package utils
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// stateFileName is the name of the terraform state objects stored by the tests in the state bucket
+const stateFileName = "terraform.tfstate"
+
+// ReaperModulesOrder is the order in which the modules are destroyed, the modules deployed
+// inside the VPC of the EKS cluster must be destroyed before the cluster
+var ReaperModulesOrder = []string{"aurora", "opensearch", "eks-cluster"}
+
+// DestroyVars returns the variables passed to `terraform destroy` for a module.
+// Every variable without a default value of a module must be set here, even with a dummy value,
+// otherwise the destroy fails (see https://github.com/hashicorp/terraform/issues/23552).
+func DestroyVars(module, clusterName, region string) (map[string]interface{}, bool) {
+	switch module {
+	case "eks-cluster":
+		return map[string]interface{}{
+			"region":                    region,
+			"name":                      clusterName,
+			"cluster_service_ipv4_cidr": "10.190.0.0/16",
+			"cluster_node_ipv4_cidr":    "10.192.0.0/16",
+		}, true
+	case "aurora":
+		return map[string]interface{}{
+			"cluster_name": clusterName,
+			"username":     "dummy",
+			"password":     "dummy",
+			"subnet_ids":   []string{},
+			"cidr_blocks":  []string{},
+			"vpc_id":       "vpc-dummy",
+		}, true
+	case "opensearch":
+		return map[string]interface{}{
+			"domain_name":                            clusterName,
+			"vpc_id":                                 "vpc-dummy",
+			"advanced_security_master_user_password": "dummy",
+			"cidr_blocks":                            []string{},
+			"subnet_ids":                             []string{},
+		}, true
+	}
+	return nil, false
+}
+
+// StateObject is a terraform state stored by the tests under terraform/<cluster>/<Suite>/<module>/terraform.tfstate
+type StateObject struct {
+	Key          string    `json:"key"`
+	ClusterName  string    `json:"cluster_name"`
+	Suite        string    `json:"suite"`
+	Module       string    `json:"module"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ParseStateKey extracts the cluster, the suite and the module of a state key,
+// it returns false if the key is not a terraform state of the tests
+func ParseStateKey(key string) (StateObject, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) < 4 || parts[0] != "terraform" || parts[len(parts)-1] != stateFileName {
+		return StateObject{}, false
+	}
+
+	return StateObject{
+		Key:         key,
+		ClusterName: parts[1],
+		Suite:       strings.Join(parts[2:len(parts)-2], "/"),
+		Module:      parts[len(parts)-2],
+	}, true
+}
+
+// ListStateObjects lists the terraform states stored by the tests in the bucket
+func ListStateObjects(ctx context.Context, sess aws.Config, bucket string) ([]StateObject, error) {
+	s3Client := s3.NewFromConfig(sess)
+	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String("terraform/"),
+	})
+
+	var stateObjects []StateObject
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects of bucket %q: %w", bucket, err)
+		}
+
+		for _, object := range page.Contents {
+			stateObject, ok := ParseStateKey(aws.ToString(object.Key))
+			if !ok {
+				continue
+			}
+			stateObject.LastModified = aws.ToTime(object.LastModified)
+			stateObjects = append(stateObjects, stateObject)
+		}
+	}
+	return stateObjects, nil
+}
+
+// ReaperOptions configures RunReaper
+type ReaperOptions struct {
+	Bucket string
+	// Region is the region of the destroyed resources, it is passed to the eks-cluster module
+	Region string
+	// BucketRegion is the region of the state bucket
+	BucketRegion string
+	// ModulesDir is the directory containing the terraform modules and the fixtures
+	ModulesDir string
+	// TempDir is the directory where the modules are copied before being destroyed
+	TempDir string
+	// MinAge is the minimum age of a state to be destroyed
+	MinAge time.Duration
+	// Target is an ID contained in the keys of the states to destroy, or "all"
+	Target string
+	// Module is the name of the module to destroy, or "all"
+	Module          string
+	TerraformBinary string
+	// DryRun only reports the states that would be destroyed
+	DryRun bool
+}
+
+// ReaperStatus is the outcome of the processing of a state
+type ReaperStatus string
+
+const (
+	ReaperDestroyed ReaperStatus = "destroyed"
+	ReaperSkipped   ReaperStatus = "skipped"
+	ReaperFailed    ReaperStatus = "failed"
+	// ReaperPlanned is used in dry-run mode for the states that would be destroyed
+	ReaperPlanned ReaperStatus = "planned"
+)
+
+// ReaperResult is the entry of a state in the ReaperReport
+type ReaperResult struct {
+	StateObject
+	AgeHours float64      `json:"age_hours"`
+	Status   ReaperStatus `json:"status"`
+	Reason   string       `json:"reason,omitempty"`
+}
+
+// ReaperReport is the machine-readable report of RunReaper
+type ReaperReport struct {
+	Bucket  string         `json:"bucket"`
+	DryRun  bool           `json:"dry_run"`
+	Results []ReaperResult `json:"results"`
+}
+
+// Count returns the number of results with the status
+func (r ReaperReport) Count(status ReaperStatus) int {
+	count := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// SelectStateObjects filters the states by target, module and age, and groups the selected ones by cluster,
+// sorted in the destruction order of ReaperModulesOrder. The states that are not selected are returned as skipped results.
+func SelectStateObjects(stateObjects []StateObject, opts ReaperOptions, now time.Time) ([]ReaperResult, []ReaperResult) {
+	var selected, skipped []ReaperResult
+
+	for _, stateObject := range stateObjects {
+		result := ReaperResult{StateObject: stateObject, AgeHours: now.Sub(stateObject.LastModified).Hours()}
+
+		switch {
+		case opts.Target != "all" && !strings.Contains(stateObject.Key, opts.Target):
+			continue
+		case !slices.Contains(ReaperModulesOrder, stateObject.Module):
+			result.Reason = fmt.Sprintf("unsupported module %s", stateObject.Module)
+		case opts.Module != "all" && opts.Module != stateObject.Module:
+			result.Reason = fmt.Sprintf("module does not match %s", opts.Module)
+		case now.Sub(stateObject.LastModified) < opts.MinAge:
+			result.Reason = fmt.Sprintf("younger than the minimum age of %s", opts.MinAge)
+		}
+
+		if result.Reason != "" {
+			result.Status = ReaperSkipped
+			skipped = append(skipped, result)
+		} else {
+			selected = append(selected, result)
+		}
+	}
+
+	slices.SortStableFunc(selected, func(a, b ReaperResult) int {
+		return cmp.Or(
+			strings.Compare(a.ClusterName, b.ClusterName),
+			slices.Index(ReaperModulesOrder, a.Module)-slices.Index(ReaperModulesOrder, b.Module),
+		)
+	})
+	return selected, skipped
+}
+
+// RunReaper destroys the resources of the terraform states stored in the bucket that match the options,
+// the modules of each cluster are destroyed in the order of ReaperModulesOrder and the state is deleted once destroyed.
+// The eks-cluster of a cluster is skipped when a module deployed in its VPC failed to be destroyed, its VPC cannot be deleted.
+// The returned error reports a failure to list the states, the failures of the destroys are in the report.
+func RunReaper(ctx context.Context, sess aws.Config, opts ReaperOptions) (ReaperReport, error) {
+	report := ReaperReport{Bucket: opts.Bucket, DryRun: opts.DryRun, Results: []ReaperResult{}}
+
+	stateObjects, err := ListStateObjects(ctx, sess, opts.Bucket)
+	if err != nil {
+		return report, err
+	}
+
+	// failedModules holds the module of each cluster whose destroy failed
+	failedModules := make(map[string]string)
+	selected, skipped := SelectStateObjects(stateObjects, opts, time.Now())
+	for _, result := range selected {
+		failedModule, dependencyFailed := failedModules[result.ClusterName]
+		if opts.DryRun {
+			fmt.Printf("Dry-run: would destroy %s (module=%s, cluster=%s)\n", result.Key, result.Module, result.ClusterName)
+			result.Status = ReaperPlanned
+		} else if result.Module == "eks-cluster" && dependencyFailed {
+			fmt.Printf("Skipping resource %s: dependent module %s failed\n", result.Key, failedModule)
+			result.Status = ReaperSkipped
+			result.Reason = fmt.Sprintf("dependent module %s failed", failedModule)
+		} else if errDestroy := reaperDestroy(ctx, sess, opts, result.StateObject); errDestroy != nil {
+			fmt.Printf("Error destroying resource %s: %v\n", result.Key, errDestroy)
+			result.Status = ReaperFailed
+			result.Reason = errDestroy.Error()
+			if !dependencyFailed {
+				failedModules[result.ClusterName] = result.Module
+			}
+		} else {
+			result.Status = ReaperDestroyed
+		}
+		report.Results = append(report.Results, result)
+	}
+	report.Results = append(report.Results, skipped...)
+
+	if !opts.DryRun {
+		if err := deleteEmptyFolders(ctx, sess, opts.Bucket); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// reaperDestroy is destroyStateObject, the unit tests replace it
+var reaperDestroy = destroyStateObject
+
+// deleteEmptyFolders deletes the folder placeholders (keys ending with /) that don't contain any object anymore
+func deleteEmptyFolders(ctx context.Context, sess aws.Config, bucket string) error {
+	s3Client := s3.NewFromConfig(sess)
+	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	})
+
+	var folders, objects []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list objects of bucket %q: %w", bucket, err)
+		}
+		for _, object := range page.Contents {
+			if key := aws.ToString(object.Key); strings.HasSuffix(key, "/") {
+				folders = append(folders, key)
+			} else {
+				objects = append(objects, key)
+			}
+		}
+	}
+
+	for _, folder := range folders {
+		isEmpty := !slices.ContainsFunc(objects, func(key string) bool {
+			return strings.HasPrefix(key, folder)
+		})
+		if !isEmpty {
+			continue
+		}
+		if err := DeleteObjectFromS3Bucket(sess, bucket, folder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// destroyStateObject copies the module of the state, destroys it with the state backend and deletes the state
+func destroyStateObject(ctx context.Context, sess aws.Config, opts ReaperOptions, stateObject StateObject) (errDestroy error) {
+	vars, _ := DestroyVars(stateObject.Module, stateObject.ClusterName, opts.Region)
+	t := &reaperT{name: stateObject.Key}
+
+	// terratest functions may still call t.Fatal, it is converted into an error
+	defer func() {
+		if r := recover(); r != nil {
+			errDestroy = fmt.Errorf("%v", r)
+		}
+	}()
+
+	tempDir := filepath.Join(opts.TempDir, path.Dir(stateObject.Key))
+	if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	tfDir, err := files.CopyTerraformFolderToDest(filepath.Join(opts.ModulesDir, stateObject.Module), tempDir, stateObject.Module)
+	if err != nil {
+		return fmt.Errorf("failed to copy module %s: %w", stateObject.Module, err)
+	}
+	if err := files.CopyFile(filepath.Join(opts.ModulesDir, "fixtures", "backend.tf"), filepath.Join(tfDir, "backend.tf")); err != nil {
+		return fmt.Errorf("failed to copy backend.tf: %w", err)
+	}
+
+	fmt.Printf("Destroying resource %s in %s (cluster_name=%s)\n", stateObject.Key, stateObject.Module, stateObject.ClusterName)
+	terraformOptions := &terraform.Options{
+		TerraformBinary: opts.TerraformBinary,
+		TerraformDir:    tfDir,
+		Vars:            vars,
+		NoColor:         true,
+		BackendConfig: map[string]interface{}{
+			"bucket": opts.Bucket,
+			"key":    stateObject.Key,
+			"region": opts.BucketRegion,
+		},
+	}
+
+	if _, err := terraform.InitE(t, terraformOptions); err != nil {
+		return fmt.Errorf("terraform init failed: %w", err)
+	}
+
+	vpcID := ""
+	if stateObject.Module == "eks-cluster" {
+		// the storage class can't be destroyed once the cluster is unreachable
+		_, _ = terraform.RunTerraformCommandE(t, terraformOptions, "state", "rm", "kubernetes_storage_class_v1.ebs_sc")
+		vpcID, _ = terraform.OutputE(t, terraformOptions, "vpc_id")
+	}
+
+	if _, err := terraform.DestroyE(t, terraformOptions); err != nil {
+		if vpcID != "" {
+			// the VPC usually fails to be deleted because of the resources still using it
+			fmt.Printf("Error destroying EKS cluster %s\n", stateObject.ClusterName)
+			dumpVpcResources(ctx, ec2.NewFromConfig(sess, func(o *ec2.Options) { o.Region = opts.Region }), vpcID, os.Stdout)
+		}
+		return fmt.Errorf("terraform destroy failed: %w", err)
+	}
+
+	return DeleteObjectFromS3Bucket(sess, opts.Bucket, stateObject.Key)
+}
+
+// dumpVpcResources writes the subnets, route tables, internet gateways and NAT gateways of the VPC and the elastic IPs
+// of the region, a resource that cannot be described is reported and the others are still written
+func dumpVpcResources(ctx context.Context, client *ec2.Client, vpcID string, w io.Writer) {
+	vpcFilter := []ec2types.Filter{{Name: aws.String("vpc-id"), Values: []string{vpcID}}}
+	dumps := []struct {
+		description string
+		describe    func() (interface{}, error)
+	}{
+		{fmt.Sprintf("subnets of %s", vpcID), func() (interface{}, error) {
+			output, err := client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{Filters: vpcFilter})
+			if err != nil {
+				return nil, err
+			}
+			return output.Subnets, nil
+		}},
+		{fmt.Sprintf("route tables of %s", vpcID), func() (interface{}, error) {
+			output, err := client.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{Filters: vpcFilter})
+			if err != nil {
+				return nil, err
+			}
+			return output.RouteTables, nil
+		}},
+		{fmt.Sprintf("internet gateways of %s", vpcID), func() (interface{}, error) {
+			output, err := client.DescribeInternetGateways(ctx, &ec2.DescribeInternetGatewaysInput{
+				Filters: []ec2types.Filter{{Name: aws.String("attachment.vpc-id"), Values: []string{vpcID}}},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return output.InternetGateways, nil
+		}},
+		{fmt.Sprintf("NAT gateways of %s", vpcID), func() (interface{}, error) {
+			output, err := client.DescribeNatGateways(ctx, &ec2.DescribeNatGatewaysInput{Filter: vpcFilter})
+			if err != nil {
+				return nil, err
+			}
+			return output.NatGateways, nil
+		}},
+		{"elastic IPs", func() (interface{}, error) {
+			output, err := client.DescribeAddresses(ctx, &ec2.DescribeAddressesInput{})
+			if err != nil {
+				return nil, err
+			}
+			return output.Addresses, nil
+		}},
+	}
+
+	for _, dump := range dumps {
+		fmt.Fprintf(w, "Checking %s\n", dump.description)
+		resources, err := dump.describe()
+		if err != nil {
+			fmt.Fprintf(w, "Failed to describe the %s: %v\n", dump.description, err)
+			continue
+		}
+		content, _ := json.MarshalIndent(resources, "", "  ")
+		fmt.Fprintln(w, string(content))
+	}
+}
+
+// reaperT is the terratest testing.TestingT used outside of a go test
+type reaperT struct {
+	name string
+}
+
+func (t *reaperT) Fail()                                     {}
+func (t *reaperT) FailNow()                                  { panic("terratest called FailNow") }
+func (t *reaperT) Fatal(args ...interface{})                 { panic(fmt.Sprint(args...)) }
+func (t *reaperT) Fatalf(format string, args ...interface{}) { panic(fmt.Sprintf(format, args...)) }
+func (t *reaperT) Error(args ...interface{})                 { fmt.Println(args...) }
+func (t *reaperT) Errorf(format string, args ...interface{}) { fmt.Printf(format+"\n", args...) }
+func (t *reaperT) Name() string                              { return t.name }
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/camunda/camunda-tf-eks-module/utils/awsfake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseStateKey(t *testing.T) {
+	stateObject, ok := ParseStateKey("terraform/cluster-rds-abc/TestCustomEKSRDSTestSuite/aurora/terraform.tfstate")
+	require.True(t, ok)
+	assert.Equal(t, "cluster-rds-abc", stateObject.ClusterName)
+	assert.Equal(t, "TestCustomEKSRDSTestSuite", stateObject.Suite)
+	assert.Equal(t, "aurora", stateObject.Module)
+
+	for _, key := range []string{
+		"terraform/cluster-rds-abc/terraform.tfstate",
+		"other/cluster-rds-abc/TestCustomEKSRDSTestSuite/aurora/terraform.tfstate",
+		"terraform/cluster-rds-abc/TestCustomEKSRDSTestSuite/aurora/",
+	} {
+		_, ok := ParseStateKey(key)
+		assert.Falsef(t, ok, "key %s should not be parsed", key)
+	}
+}
+
+func TestSelectStateObjects(t *testing.T) {
+	now := time.Now()
+	stateObjects := []StateObject{
+		{Key: "terraform/cluster-rds-1/Suite/eks-cluster/terraform.tfstate", Module: "eks-cluster", LastModified: now.Add(-48 * time.Hour)},
+		{Key: "terraform/cluster-rds-1/Suite/aurora/terraform.tfstate", Module: "aurora", LastModified: now.Add(-48 * time.Hour)},
+		{Key: "terraform/cl-os-1/Suite/opensearch/terraform.tfstate", Module: "opensearch", LastModified: now.Add(-48 * time.Hour)},
+		{Key: "terraform/cluster-test-2/Suite/eks-cluster/terraform.tfstate", Module: "eks-cluster", LastModified: now.Add(-time.Hour)},
+		{Key: "terraform/cluster-test-3/Suite/unknown/terraform.tfstate", Module: "unknown", LastModified: now.Add(-48 * time.Hour)},
+	}
+
+	selected, skipped := SelectStateObjects(stateObjects, ReaperOptions{Target: "all", Module: "all", MinAge: 20 * time.Hour}, now)
+
+	selectedModules := make([]string, 0, len(selected))
+	for _, result := range selected {
+		selectedModules = append(selectedModules, result.Module)
+	}
+	assert.Equal(t, []string{"aurora", "opensearch", "eks-cluster"}, selectedModules)
+	require.Len(t, skipped, 2)
+	assert.Contains(t, skipped[0].Reason, "minimum age")
+	assert.Contains(t, skipped[1].Reason, "unsupported module")
+
+	selected, skipped = SelectStateObjects(stateObjects, ReaperOptions{Target: "-1/", Module: "eks-cluster"}, now)
+	require.Len(t, selected, 1)
+	assert.Equal(t, "terraform/cluster-rds-1/Suite/eks-cluster/terraform.tfstate", selected[0].Key)
+	require.Len(t, skipped, 2)
+}
+
+func TestRunReaperDryRun(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddBucket(awsfake.Bucket{
+		Name: "tests-eks-tf-state",
+		Objects: map[string][]byte{
+			"terraform/cluster-rds-1/TestCustomEKSRDSTestSuite/eks-cluster/terraform.tfstate": []byte("{}"),
+			"terraform/cluster-rds-1/TestCustomEKSRDSTestSuite/aurora/terraform.tfstate":      []byte("{}"),
+			"terraform/cluster-rds-1/TestCustomEKSRDSTestSuite/":                              nil,
+		},
+		LastModified: map[string]time.Time{
+			"terraform/cluster-rds-1/TestCustomEKSRDSTestSuite/aurora/terraform.tfstate": time.Now().Add(-time.Hour),
+		},
+	})
+
+	report, err := RunReaper(context.Background(), sess, ReaperOptions{
+		Bucket: "tests-eks-tf-state",
+		Target: "all",
+		Module: "all",
+		DryRun: true,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, "aurora", report.Results[0].Module)
+	assert.Equal(t, ReaperPlanned, report.Results[0].Status)
+	assert.Equal(t, "eks-cluster", report.Results[1].Module)
+	assert.Equal(t, 2, report.Count(ReaperPlanned))
+
+	bucket, _ := server.Bucket("tests-eks-tf-state")
+	assert.Len(t, bucket.Objects, 3)
+	assert.Equal(t, 0, server.Calls("DeleteObject"))
+}
+
+func TestRunReaperSkipsClusterOfFailedModule(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddBucket(awsfake.Bucket{
+		Name: "tests-eks-tf-state",
+		Objects: map[string][]byte{
+			"terraform/cluster-rds-1/TestCustomEKSRDSTestSuite/eks-cluster/terraform.tfstate": []byte("{}"),
+			"terraform/cluster-rds-1/TestCustomEKSRDSTestSuite/aurora/terraform.tfstate":      []byte("{}"),
+			"terraform/cluster-test-2/TestDefaultEKSTestSuite/eks-cluster/terraform.tfstate":  []byte("{}"),
+		},
+	})
+
+	var destroyed []string
+	reaperDestroy = func(ctx context.Context, sess aws.Config, opts ReaperOptions, stateObject StateObject) error {
+		if stateObject.Module == "aurora" {
+			return errors.New("the DB cluster is protected")
+		}
+		destroyed = append(destroyed, stateObject.Key)
+		return nil
+	}
+	t.Cleanup(func() { reaperDestroy = destroyStateObject })
+
+	report, err := RunReaper(context.Background(), sess, ReaperOptions{
+		Bucket: "tests-eks-tf-state",
+		Target: "all",
+		Module: "all",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, report.Results, 3)
+	assert.Equal(t, "cluster-rds-1", report.Results[0].ClusterName)
+	assert.Equal(t, "aurora", report.Results[0].Module)
+	assert.Equal(t, ReaperFailed, report.Results[0].Status)
+	assert.Equal(t, "cluster-rds-1", report.Results[1].ClusterName)
+	assert.Equal(t, "eks-cluster", report.Results[1].Module)
+	assert.Equal(t, ReaperSkipped, report.Results[1].Status)
+	assert.Equal(t, "dependent module aurora failed", report.Results[1].Reason)
+	assert.Equal(t, "cluster-test-2", report.Results[2].ClusterName)
+	assert.Equal(t, ReaperDestroyed, report.Results[2].Status)
+	assert.Equal(t, []string{"terraform/cluster-test-2/TestDefaultEKSTestSuite/eks-cluster/terraform.tfstate"}, destroyed)
+}
+
+func TestDestroyVarsCoversReaperModules(t *testing.T) {
+	for _, module := range ReaperModulesOrder {
+		vars, ok := DestroyVars(module, "cluster-test", "eu-central-1")
+		assert.Truef(t, ok, "module %s has no destroy vars", module)
+		assert.NotEmpty(t, vars)
+	}
+}
+
+func TestDumpVpcResources(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddVpc(awsfake.Vpc{ID: "vpc-1", Subnets: []string{"subnet-1", "subnet-2"}})
+	server.AddVpc(awsfake.Vpc{ID: "vpc-2", Subnets: []string{"subnet-3"}})
+	server.InjectFault("DescribeNatGateways", awsfake.AccessDenied())
+
+	var output bytes.Buffer
+	dumpVpcResources(context.Background(), ec2.NewFromConfig(sess), "vpc-1", &output)
+
+	assert.Contains(t, output.String(), "Checking subnets of vpc-1\n")
+	assert.Contains(t, output.String(), `"SubnetId": "subnet-2"`)
+	assert.NotContains(t, output.String(), "subnet-3")
+	assert.Contains(t, output.String(), "Checking route tables of vpc-1\n[]\n")
+	// a resource that cannot be described does not stop the dump
+	assert.Contains(t, output.String(), "Failed to describe the NAT gateways of vpc-1")
+	assert.Contains(t, output.String(), "Checking elastic IPs\n")
+	assert.Equal(t, 1, server.Calls("DescribeAddresses"))
+}
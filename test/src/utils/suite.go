@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// modulesDir is the path of the terraform modules relative to the test sources
+const modulesDir = "../../modules/"
+
+// BaseSuite holds the configuration shared by the test suites of the modules, it is embedded by each suite:
+//
+//	type MyTestSuite struct {
+//		utils.BaseSuite
+//	}
+//
+//	func TestMyTestSuite(t *testing.T) {
+//		suite.Run(t, &MyTestSuite{BaseSuite: utils.NewBaseSuite("cluster-my")})
+//	}
+type BaseSuite struct {
+	suite.Suite
+	Logger        *zap.Logger
+	SugaredLogger *zap.SugaredLogger
+	Config        *TestConfig
+
+	// ClusterPrefix is prepended to the cluster id of the configuration to name the cluster
+	ClusterPrefix   string
+	ClusterName     string
+	Region          string
+	BucketRegion    string
+	TFDataDir       string
+	TFBinaryName    string
+	TFStateS3Bucket string
+	KubeConfigPath  string
+}
+
+// NewBaseSuite returns a BaseSuite naming its cluster <clusterPrefix>-<cluster id>
+func NewBaseSuite(clusterPrefix string) BaseSuite {
+	return BaseSuite{ClusterPrefix: clusterPrefix}
+}
+
+// SetupTest loads the configuration of the suite (see LoadTestConfig) and creates the state directory
+func (s *BaseSuite) SetupTest() {
+	s.Logger = zaptest.NewLogger(s.T())
+	s.SugaredLogger = s.Logger.Sugar()
+
+	var errConfig error
+	s.Config, errConfig = LoadTestConfig()
+	s.Require().NoError(errConfig, "Invalid tests configuration")
+	s.T().Logf("Effective tests configuration:\n%s", s.Config)
+
+	s.ClusterName = fmt.Sprintf("%s-%s", s.ClusterPrefix, s.Config.ClusterID)
+	s.Region = s.Config.ClusterRegion
+	s.BucketRegion = s.Config.StateBucketRegion
+	s.TFBinaryName = s.Config.TFBinaryName
+	s.TFStateS3Bucket = s.Config.StateBucket
+
+	var errAbsPath error
+	s.TFDataDir, errAbsPath = filepath.Abs(fmt.Sprintf("../../test/states/tf-data-%s", s.ClusterName))
+	s.Require().NoError(errAbsPath)
+	s.Require().NoError(os.MkdirAll(s.TFDataDir, os.ModePerm))
+	s.KubeConfigPath = filepath.Join(s.TFDataDir, "kubeconfig")
+}
+
+// TearDownTest removes the kubeconfig generated by the test, the resources that survived the destroy are detected
+// by the inventory of the whole run in the CI (see ListInventory)
+func (s *BaseSuite) TearDownTest() {
+	s.T().Log("Cleaning up resources...")
+
+	err := os.Remove(s.KubeConfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		s.T().Errorf("Failed to remove kubeConfigPath: %v", err)
+	}
+}
+
+// SuiteName returns the name of the go test running the suite, e.g. TestDefaultEKSTestSuite
+func (s *BaseSuite) SuiteName() string {
+	name, _, _ := strings.Cut(s.T().Name(), "/")
+	return name
+}
+
+// CopyModule copies the terraform module (e.g. "eks-cluster") in the state directory of the suite,
+// links the S3 backend of the fixtures in it and returns the directory of the copy
+func (s *BaseSuite) CopyModule(module string) string {
+	fullDir := filepath.Join(s.TFDataDir, module)
+	s.Require().NoError(os.MkdirAll(fullDir, os.ModePerm))
+
+	tfDir := test_structure.CopyTerraformFolderToDest(s.T(), modulesDir, module, fullDir)
+
+	errLinkBackend := os.Link(filepath.Join(modulesDir, "fixtures", "backend.tf"), filepath.Join(tfDir, "backend.tf"))
+	s.Require().NoError(errLinkBackend)
+	return tfDir
+}
+
+// StateKey returns the key of the terraform state of the module in the state bucket,
+// terraform/<cluster>/<Suite>/<module>/terraform.tfstate is the layout expected by the reaper (see ParseStateKey)
+func (s *BaseSuite) StateKey(module string) string {
+	return fmt.Sprintf("terraform/%s/%s/%s/%s", s.ClusterName, s.SuiteName(), module, stateFileName)
+}
+
+// TerraformOptions returns the options of the copy of the module in tfDir using the fixture
+// fixtures.default.<fixture>.tfvars and the state backend of the suite,
+// the fixture and vars are validated against the variables of the module first (see ValidateModuleVars)
+func (s *BaseSuite) TerraformOptions(tfDir, module, fixture string, vars map[string]interface{}) *terraform.Options {
+	s.Require().NoError(ValidateModuleVars(modulesDir, module, fixture, vars), "Invalid variables for the module %s", module)
+
+	return &terraform.Options{
+		TerraformBinary: s.TFBinaryName,
+		TerraformDir:    tfDir,
+		Upgrade:         false,
+		VarFiles:        []string{fmt.Sprintf("../fixtures/fixtures.default.%s.tfvars", fixture)},
+		Vars:            vars,
+		EnvVars:         map[string]string{"AWS_PROFILE": s.Config.AwsProfile},
+		BackendConfig: map[string]interface{}{
+			"bucket": s.TFStateS3Bucket,
+			"key":    s.StateKey(module),
+			"region": s.BucketRegion,
+		},
+	}
+}
+
+// AwsClient returns an aws.Config client for the profile and the cluster region of the configuration
+func (s *BaseSuite) AwsClient() (aws.Config, error) {
+	return GetAwsClientF(s.Config.AwsProfile, s.Region)
+}
+
+// EnsureStateBucket creates the S3 bucket storing the terraform states if it does not exist
+func (s *BaseSuite) EnsureStateBucket() {
+	sessBackend, err := GetAwsClientF(s.Config.AwsProfile, s.BucketRegion)
+	s.Require().NoErrorf(err, "Failed to get aws client")
+	err = CreateS3BucketIfNotExists(sessBackend, s.TFStateS3Bucket, TF_BUCKET_DESCRIPTION, s.BucketRegion)
+	s.Require().NoErrorf(err, "Failed to create s3 state bucket")
+}
+
+// DeferCleanup destroys the module and deletes its state unless `CLEAN_CLUSTER_AT_THE_END` is false,
+// it must be deferred: `defer suite.DeferCleanup(terraformOptions)`
+func (s *BaseSuite) DeferCleanup(terraformOptions *terraform.Options) {
+	if s.Config.CleanAtTheEnd() {
+		DeferCleanup(s.T(), s.Config.AwsProfile, s.BucketRegion, terraformOptions)
+	}
+}
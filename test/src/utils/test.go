@@ -1,18 +1,35 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"testing"
+	"time"
 )
 
 const TF_BUCKET_DESCRIPTION = "This bucket is used to store tests of the camunda/camunda-tf-eks-module repository. Anything contained in this bucket can be deleted without notice."
 
-func DeferCleanup(t *testing.T, bucketRegion string, terraformOptions *terraform.Options) {
+// testDeadlineMargin is the time kept between the context deadline and the test deadline to let the cleanup run
+const testDeadlineMargin = 10 * time.Minute
+
+// NewTestContext returns a context that is cancelled before the deadline of the test (`go test --timeout`)
+// so that waits fail cleanly and leave time for the deferred cleanup instead of having the test binary killed
+func NewTestContext(t *testing.T) (context.Context, context.CancelFunc) {
+	deadline, ok := t.Deadline()
+	if !ok {
+		return context.WithCancel(context.Background())
+	}
+
+	margin := min(testDeadlineMargin, time.Until(deadline)/4)
+	return context.WithDeadline(context.Background(), deadline.Add(-margin))
+}
+
+func DeferCleanup(t *testing.T, profile, bucketRegion string, terraformOptions *terraform.Options) {
 	fmt.Println("Cleaning up resources")
 
-	sess, err := GetAwsClientF(GetAwsProfile(), bucketRegion)
+	sess, err := GetAwsClientF(profile, bucketRegion)
 	if err != nil {
 		t.Fatalf("Failed to get AWS client: %v", err)
 	}
@@ -0,0 +1,573 @@
+package utils
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/eks/types"
+	"github.com/camunda/camunda-tf-eks-module/utils/version"
+	"k8s.io/client-go/kubernetes"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultUpgradeAddons are the add-ons installed by the eks-cluster module, they are upgraded in this order
+var DefaultUpgradeAddons = []string{"coredns", "kube-proxy", "vpc-cni", "aws-ebs-csi-driver"}
+
+// EKSUpgrade describes the upgrade performed by UpgradeEKSCluster
+type EKSUpgrade struct {
+	ClusterName string
+	// Version is the target kubernetes version of the cluster, e.g. "1.30"
+	Version string
+	// Addons are upgraded to their newest version supporting Version, DefaultUpgradeAddons when empty.
+	// The add-ons that are not installed on the cluster, or already at this version or a newer one, are skipped.
+	Addons []string
+	// Nodegroups are the managed node groups to upgrade, all the node groups of the cluster when empty
+	Nodegroups []string
+	// KubeClient, when set, is used to wait for the nodes of each upgraded node group to be ready
+	KubeClient kubernetes.Interface
+	// StepTimeout bounds each step of the upgrade, EKSUpdateTimeout when 0
+	StepTimeout time.Duration
+}
+
+// PreflightStatus is the outcome of a pre-flight check, only the Failed checks prevent the upgrade
+type PreflightStatus string
+
+const (
+	PreflightPassed  PreflightStatus = "Passed"
+	PreflightWarning PreflightStatus = "Warning"
+	PreflightFailed  PreflightStatus = "Failed"
+)
+
+// PreflightCheck is a check performed before the first step of the upgrade
+type PreflightCheck struct {
+	// Name is "version skew", "upgrade insights" or "add-on <name>"
+	Name    string
+	Status  PreflightStatus
+	Message string
+}
+
+// UpgradeStepStatus is the state of a step of the upgrade
+type UpgradeStepStatus string
+
+const (
+	UpgradeStepPending   UpgradeStepStatus = "Pending"
+	UpgradeStepSucceeded UpgradeStepStatus = "Succeeded"
+	// UpgradeStepSkipped is used when the component is already at its target version or is not installed
+	UpgradeStepSkipped UpgradeStepStatus = "Skipped"
+	UpgradeStepFailed  UpgradeStepStatus = "Failed"
+	// UpgradeStepAborted is used for the steps not started because of a failed pre-flight check or a failed step
+	UpgradeStepAborted UpgradeStepStatus = "Aborted"
+)
+
+// upgradeStepKind is the component upgraded by a step
+type upgradeStepKind int
+
+const (
+	controlPlaneStep upgradeStepKind = iota
+	addonStep
+	nodegroupStep
+)
+
+// UpgradeStep is the upgrade of a component of the cluster: the control plane, an add-on or a managed node group
+type UpgradeStep struct {
+	// Component is "control plane", "add-on <name>" or "node group <name>"
+	Component string
+	From      string
+	To        string
+	// Reason explains why the step has been skipped
+	Reason   string
+	UpdateID string
+	Status   UpgradeStepStatus
+	Duration time.Duration
+	Err      error
+	// Rollback describes the state left by the failed step and how to restore the previous version
+	Rollback string
+
+	kind upgradeStepKind
+	name string
+	// release is the AMI release version of a node group and nodes the number of its nodes
+	release string
+	nodes   int
+}
+
+// UpgradeReport reports the pre-flight checks and the steps of an upgrade, in their order of execution
+type UpgradeReport struct {
+	ClusterName string
+	From        string
+	To          string
+	Preflight   []PreflightCheck
+	Steps       []UpgradeStep
+}
+
+// FailedStep returns the step that stopped the upgrade, nil if no step failed
+func (r UpgradeReport) FailedStep() *UpgradeStep {
+	for i := range r.Steps {
+		if r.Steps[i].Status == UpgradeStepFailed {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
+
+// Summary describes the checks and the steps of the upgrade, with the rollback of the failed step
+func (r UpgradeReport) Summary() string {
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "upgrade of the EKS cluster %s from %s to %s\n", r.ClusterName, r.From, r.To)
+	summary.WriteString("pre-flight checks:\n")
+	for _, check := range r.Preflight {
+		fmt.Fprintf(&summary, "  %-9s %s: %s\n", check.Status, check.Name, check.Message)
+	}
+	summary.WriteString("steps:\n")
+	for _, step := range r.Steps {
+		fmt.Fprintf(&summary, "  %-9s %s", step.Status, step.Component)
+		if step.From != "" || step.To != "" {
+			fmt.Fprintf(&summary, " %s -> %s", step.From, step.To)
+		}
+		switch {
+		case step.Status == UpgradeStepSkipped:
+			fmt.Fprintf(&summary, " (%s)", step.Reason)
+		case step.UpdateID != "":
+			fmt.Fprintf(&summary, " (%s, %s)", step.UpdateID, step.Duration.Round(time.Second))
+		}
+		if step.Err != nil {
+			fmt.Fprintf(&summary, ": %v", step.Err)
+		}
+		summary.WriteString("\n")
+		if step.Rollback != "" {
+			fmt.Fprintf(&summary, "            rollback: %s\n", step.Rollback)
+		}
+	}
+	return summary.String()
+}
+
+// UpgradeEKSCluster upgrades the cluster the way it is done by hand: the pre-flight checks (version skew between
+// the control plane and the node groups, upgrade insights of EKS reporting the deprecated APIs in use, versions
+// of the add-ons compatible with the target version) are run first, then the control plane, each add-on
+// and each managed node group are upgraded and awaited one after the other.
+// The upgrade stops at the first failed step, the remaining steps are aborted and the report describes
+// the state left by the failed step and how to roll it back.
+func UpgradeEKSCluster(ctx context.Context, client *eks.Client, upgrade EKSUpgrade) (UpgradeReport, error) {
+	report := UpgradeReport{ClusterName: upgrade.ClusterName, To: upgrade.Version}
+	if upgrade.StepTimeout == 0 {
+		upgrade.StepTimeout = EKSUpdateTimeout
+	}
+	if len(upgrade.Addons) == 0 {
+		upgrade.Addons = DefaultUpgradeAddons
+	}
+
+	if err := planUpgrade(ctx, client, upgrade, &report); err != nil {
+		return report, fmt.Errorf("failed to plan the upgrade of the EKS cluster %s to %s: %w", upgrade.ClusterName, upgrade.Version, err)
+	}
+
+	if err := preflightUpgrade(ctx, client, upgrade, &report); err != nil {
+		return report, fmt.Errorf("failed to run the pre-flight checks of the upgrade of the EKS cluster %s: %w", upgrade.ClusterName, err)
+	}
+	var failures []string
+	for _, check := range report.Preflight {
+		fmt.Printf("Pre-flight check %s: %s %s\n", check.Name, check.Status, check.Message)
+		if check.Status == PreflightFailed {
+			failures = append(failures, fmt.Sprintf("%s: %s", check.Name, check.Message))
+		}
+	}
+	if len(failures) > 0 {
+		abortPendingSteps(&report)
+		return report, fmt.Errorf("pre-flight checks of the upgrade of the EKS cluster %s to %s failed: %s", upgrade.ClusterName, upgrade.Version, strings.Join(failures, "; "))
+	}
+
+	for i := range report.Steps {
+		step := &report.Steps[i]
+		if step.Status != UpgradeStepPending {
+			continue
+		}
+
+		fmt.Printf("Upgrading the %s of the EKS cluster %s from %s to %s\n", step.Component, upgrade.ClusterName, step.From, step.To)
+		start := time.Now()
+		err := runUpgradeStep(ctx, client, upgrade, step)
+		step.Duration = time.Since(start)
+		if err != nil {
+			step.Status = UpgradeStepFailed
+			step.Err = err
+			step.Rollback = upgradeRollback(*step)
+			abortPendingSteps(&report)
+			return report, fmt.Errorf("upgrade of the EKS cluster %s to %s failed at the %s: %w", upgrade.ClusterName, upgrade.Version, step.Component, err)
+		}
+		step.Status = UpgradeStepSucceeded
+		fmt.Printf("The %s of the EKS cluster %s is at %s\n", step.Component, upgrade.ClusterName, step.To)
+	}
+	return report, nil
+}
+
+// planUpgrade describes the cluster and builds the steps of the upgrade
+func planUpgrade(ctx context.Context, client *eks.Client, upgrade EKSUpgrade, report *UpgradeReport) error {
+	cluster, err := client.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: &upgrade.ClusterName})
+	if err != nil {
+		return err
+	}
+	report.From = aws.ToString(cluster.Cluster.Version)
+	report.Steps = append(report.Steps, newUpgradeStep(controlPlaneStep, "", report.From, upgrade.Version))
+
+	installedAddons, err := listAddons(ctx, client, upgrade.ClusterName)
+	if err != nil {
+		return err
+	}
+	for _, addon := range upgrade.Addons {
+		if !slices.Contains(installedAddons, addon) {
+			report.Steps = append(report.Steps, UpgradeStep{Component: "add-on " + addon, Status: UpgradeStepSkipped, Reason: "not installed", kind: addonStep, name: addon})
+			continue
+		}
+
+		addonOutput, err := client.DescribeAddon(ctx, &eks.DescribeAddonInput{ClusterName: &upgrade.ClusterName, AddonName: &addon})
+		if err != nil {
+			return err
+		}
+		targetVersion, err := addonTargetVersion(ctx, client, addon, upgrade.Version)
+		if err != nil {
+			return err
+		}
+		report.Steps = append(report.Steps, newUpgradeStep(addonStep, addon, aws.ToString(addonOutput.Addon.AddonVersion), targetVersion))
+	}
+
+	nodegroups := upgrade.Nodegroups
+	if len(nodegroups) == 0 {
+		if nodegroups, err = listNodegroups(ctx, client, upgrade.ClusterName); err != nil {
+			return err
+		}
+	}
+	for _, nodegroup := range nodegroups {
+		nodegroupOutput, err := client.DescribeNodegroup(ctx, &eks.DescribeNodegroupInput{ClusterName: &upgrade.ClusterName, NodegroupName: &nodegroup})
+		if err != nil {
+			return err
+		}
+		step := newUpgradeStep(nodegroupStep, nodegroup, aws.ToString(nodegroupOutput.Nodegroup.Version), upgrade.Version)
+		step.release = aws.ToString(nodegroupOutput.Nodegroup.ReleaseVersion)
+		if scaling := nodegroupOutput.Nodegroup.ScalingConfig; scaling != nil {
+			step.nodes = int(aws.ToInt32(scaling.DesiredSize))
+		}
+		report.Steps = append(report.Steps, step)
+	}
+	return nil
+}
+
+// newUpgradeStep returns a pending step, or a skipped one if the component is already at its target version,
+// an add-on is never downgraded: it is skipped when its version is newer than the target one (the eks-cluster module
+// installs the most recent versions). The target version of an add-on without compatible version is empty,
+// it is reported by the pre-flight checks.
+func newUpgradeStep(kind upgradeStepKind, name, from, to string) UpgradeStep {
+	step := UpgradeStep{From: from, To: to, Status: UpgradeStepPending, kind: kind, name: name}
+	switch kind {
+	case controlPlaneStep:
+		step.Component = "control plane"
+	case addonStep:
+		step.Component = "add-on " + name
+	case nodegroupStep:
+		step.Component = "node group " + name
+	}
+	switch {
+	case kind == addonStep && to != "" && compareAddonVersions(from, to) >= 0:
+		step.Status = UpgradeStepSkipped
+		step.Reason = "already at or above " + to
+	case from == to:
+		step.Status = UpgradeStepSkipped
+		step.Reason = "already at " + to
+	}
+	return step
+}
+
+// compareAddonVersions compares two versions of an add-on, e.g. v1.18.6-eksbuild.1, by their release then their build
+func compareAddonVersions(a, b string) int {
+	releaseA, buildA := parseAddonVersion(a)
+	releaseB, buildB := parseAddonVersion(b)
+	return cmp.Or(slices.Compare(releaseA, releaseB), cmp.Compare(buildA, buildB))
+}
+
+// parseAddonVersion returns the numbers of the release and the build of an add-on version, the parts that are not numbers are 0
+func parseAddonVersion(value string) ([]int, int) {
+	release, build, _ := strings.Cut(strings.TrimPrefix(value, "v"), "-eksbuild.")
+	var numbers []int
+	for _, part := range strings.Split(release, ".") {
+		number, _ := strconv.Atoi(part)
+		numbers = append(numbers, number)
+	}
+	buildNumber, _ := strconv.Atoi(build)
+	return numbers, buildNumber
+}
+
+// addonTargetVersion returns the newest version of the add-on supporting the kubernetes version,
+// the result is empty if no version of the add-on supports the kubernetes version
+func addonTargetVersion(ctx context.Context, client *eks.Client, addon, kubernetesVersion string) (string, error) {
+	target := ""
+	paginator := eks.NewDescribeAddonVersionsPaginator(client, &eks.DescribeAddonVersionsInput{AddonName: &addon, KubernetesVersion: &kubernetesVersion})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, addonInfo := range output.Addons {
+			for _, version := range addonInfo.AddonVersions {
+				supported := slices.ContainsFunc(version.Compatibilities, func(compatibility types.Compatibility) bool {
+					return aws.ToString(compatibility.ClusterVersion) == kubernetesVersion
+				})
+				if supported && (target == "" || compareAddonVersions(aws.ToString(version.AddonVersion), target) > 0) {
+					target = aws.ToString(version.AddonVersion)
+				}
+			}
+		}
+	}
+	return target, nil
+}
+
+func listAddons(ctx context.Context, client *eks.Client, clusterName string) ([]string, error) {
+	var addons []string
+	paginator := eks.NewListAddonsPaginator(client, &eks.ListAddonsInput{ClusterName: &clusterName})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		addons = append(addons, output.Addons...)
+	}
+	return addons, nil
+}
+
+func listNodegroups(ctx context.Context, client *eks.Client, clusterName string) ([]string, error) {
+	var nodegroups []string
+	paginator := eks.NewListNodegroupsPaginator(client, &eks.ListNodegroupsInput{ClusterName: &clusterName})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		nodegroups = append(nodegroups, output.Nodegroups...)
+	}
+	return nodegroups, nil
+}
+
+// preflightUpgrade appends the pre-flight checks to the report, an error is only returned when a check could not be run
+func preflightUpgrade(ctx context.Context, client *eks.Client, upgrade EKSUpgrade, report *UpgradeReport) error {
+	report.Preflight = append(report.Preflight, checkVersionSkew(*report))
+
+	// the insights of EKS report the deprecated APIs still requested by the clients of the cluster,
+	// the kubelet versions and the add-ons incompatible with the next version
+	if report.From != upgrade.Version {
+		check, err := checkUpgradeInsights(ctx, client, upgrade.ClusterName, upgrade.Version)
+		if err != nil {
+			return err
+		}
+		report.Preflight = append(report.Preflight, check)
+	}
+
+	for _, step := range report.Steps {
+		if step.kind != addonStep || step.Reason == "not installed" {
+			continue
+		}
+		check := PreflightCheck{Name: step.Component, Status: PreflightPassed, Message: fmt.Sprintf("%s -> %s", step.From, step.To)}
+		if step.Status == UpgradeStepSkipped {
+			check.Message = fmt.Sprintf("%s, %s", step.From, step.Reason)
+		}
+		if step.To == "" {
+			check.Status = PreflightFailed
+			check.Message = fmt.Sprintf("no version of the add-on is compatible with kubernetes %s", upgrade.Version)
+		}
+		report.Preflight = append(report.Preflight, check)
+	}
+	return nil
+}
+
+// checkVersionSkew checks that the control plane is upgraded by a single minor version and that the kubelets
+// of the node groups stay in the skew supported by kubernetes until they are upgraded
+func checkVersionSkew(report UpgradeReport) PreflightCheck {
+	check := PreflightCheck{Name: "version skew", Status: PreflightPassed}
+	from, errFrom := version.Parse(version.EKS, report.From)
+	to, errTo := version.Parse(version.EKS, report.To)
+	if err := errors.Join(errFrom, errTo); err != nil {
+		check.Status = PreflightFailed
+		check.Message = err.Error()
+		return check
+	}
+
+	switch {
+	case from.Major != to.Major || to.Compare(from) < 0:
+		check.Status = PreflightFailed
+		check.Message = fmt.Sprintf("the control plane cannot be downgraded from %s to %s", report.From, report.To)
+		return check
+	case to.Compare(from.NextMinor()) > 0:
+		check.Status = PreflightFailed
+		check.Message = fmt.Sprintf("EKS upgrades the control plane one minor version at a time, %s cannot be upgraded to %s", report.From, report.To)
+		return check
+	}
+
+	maxSkew := maxKubeletSkew(to.Minor)
+	var behind []string
+	for _, step := range report.Steps {
+		if step.kind != nodegroupStep {
+			continue
+		}
+		nodegroupVersion, err := version.Parse(version.EKS, step.From)
+		if err != nil {
+			check.Status = PreflightFailed
+			check.Message = fmt.Sprintf("%s: %v", step.Component, err)
+			return check
+		}
+		if to.Minor-nodegroupVersion.Minor > maxSkew {
+			behind = append(behind, fmt.Sprintf("%s (%s)", step.Component, step.From))
+		}
+	}
+	if len(behind) > 0 {
+		check.Status = PreflightFailed
+		check.Message = fmt.Sprintf("%s would be more than %d minor versions older than the control plane %s", strings.Join(behind, ", "), maxSkew, report.To)
+		return check
+	}
+
+	check.Message = fmt.Sprintf("control plane %s -> %s, the node groups are in the supported skew of %d minor versions", report.From, report.To, maxSkew)
+	return check
+}
+
+// maxKubeletSkew is the number of minor versions a kubelet may be older than the API server,
+// it went from 2 to 3 with kubernetes 1.28
+func maxKubeletSkew(apiServerMinor int) int {
+	if apiServerMinor >= 28 {
+		return 3
+	}
+	return 2
+}
+
+// checkUpgradeInsights fails if an upgrade insight of the target version is in ERROR, the insights in WARNING or UNKNOWN
+// are reported as warnings. The insights may not be readable by the caller, it is reported as a warning.
+func checkUpgradeInsights(ctx context.Context, client *eks.Client, clusterName, version string) (PreflightCheck, error) {
+	check := PreflightCheck{Name: "upgrade insights", Status: PreflightPassed}
+	var errorInsights, warningInsights []string
+	passing := 0
+
+	paginator := eks.NewListInsightsPaginator(client, &eks.ListInsightsInput{
+		ClusterName: &clusterName,
+		Filter: &types.InsightsFilter{
+			Categories:         []types.Category{types.CategoryUpgradeReadiness},
+			KubernetesVersions: []string{version},
+		},
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if IsAccessDenied(err) {
+			check.Status = PreflightWarning
+			check.Message = fmt.Sprintf("the upgrade insights cannot be read: %v", err)
+			return check, nil
+		}
+		if err != nil {
+			return check, err
+		}
+
+		for _, insight := range output.Insights {
+			var status types.InsightStatusValue
+			reason := ""
+			if insight.InsightStatus != nil {
+				status = insight.InsightStatus.Status
+				reason = aws.ToString(insight.InsightStatus.Reason)
+			}
+			description := fmt.Sprintf("%s (%s: %s)", aws.ToString(insight.Name), status, reason)
+			switch status {
+			case types.InsightStatusValuePassing:
+				passing++
+			case types.InsightStatusValueError:
+				errorInsights = append(errorInsights, description)
+			default:
+				warningInsights = append(warningInsights, description)
+			}
+		}
+	}
+
+	switch {
+	case len(errorInsights) > 0:
+		check.Status = PreflightFailed
+		check.Message = strings.Join(append(errorInsights, warningInsights...), ", ")
+	case len(warningInsights) > 0:
+		check.Status = PreflightWarning
+		check.Message = strings.Join(warningInsights, ", ")
+	default:
+		check.Message = fmt.Sprintf("%d insights passing for kubernetes %s", passing, version)
+	}
+	return check, nil
+}
+
+// runUpgradeStep starts the update of the component and waits for it
+func runUpgradeStep(ctx context.Context, client *eks.Client, upgrade EKSUpgrade, step *UpgradeStep) error {
+	describeUpdateInput := &eks.DescribeUpdateInput{Name: &upgrade.ClusterName}
+	var update *types.Update
+
+	switch step.kind {
+	case controlPlaneStep:
+		output, err := client.UpdateClusterVersion(ctx, &eks.UpdateClusterVersionInput{Name: &upgrade.ClusterName, Version: &step.To})
+		if err != nil {
+			return err
+		}
+		update = output.Update
+	case addonStep:
+		// the eks-cluster module overwrites the conflicting configuration of the add-ons, so does the upgrade
+		output, err := client.UpdateAddon(ctx, &eks.UpdateAddonInput{
+			ClusterName:      &upgrade.ClusterName,
+			AddonName:        &step.name,
+			AddonVersion:     &step.To,
+			ResolveConflicts: types.ResolveConflictsOverwrite,
+		})
+		if err != nil {
+			return err
+		}
+		update = output.Update
+		describeUpdateInput.AddonName = &step.name
+	case nodegroupStep:
+		output, err := client.UpdateNodegroupVersion(ctx, &eks.UpdateNodegroupVersionInput{
+			ClusterName:   &upgrade.ClusterName,
+			NodegroupName: &step.name,
+			Version:       &step.To,
+		})
+		if err != nil {
+			return err
+		}
+		update = output.Update
+		describeUpdateInput.NodegroupName = &step.name
+	}
+
+	step.UpdateID = aws.ToString(update.Id)
+	describeUpdateInput.UpdateId = update.Id
+	fmt.Printf("Update initiated, update ID: %s\n", step.UpdateID)
+
+	description := fmt.Sprintf("EKS update %s of the %s of cluster %s", step.UpdateID, step.Component, upgrade.ClusterName)
+	if err := waitForUpdate(ctx, client, describeUpdateInput, description, upgrade.StepTimeout); err != nil {
+		return err
+	}
+
+	if step.kind == nodegroupStep && upgrade.KubeClient != nil && step.nodes > 0 {
+		return WaitUntilNodesReady(ctx, upgrade.KubeClient, step.nodes, step.name, upgrade.StepTimeout)
+	}
+	return nil
+}
+
+// upgradeRollback describes the state left by the failed step and how to restore the previous version of the component
+func upgradeRollback(step UpgradeStep) string {
+	switch step.kind {
+	case controlPlaneStep:
+		return fmt.Sprintf("EKS keeps the control plane at %s when its update fails, it cannot be downgraded; the add-ons and the node groups have not been upgraded", step.From)
+	case addonStep:
+		return fmt.Sprintf("restore the previous version of the add-on with UpdateAddon %s --addon-version %s; the control plane stays at its new version", step.name, step.From)
+	default:
+		release := ""
+		if step.release != "" {
+			release = fmt.Sprintf(" (release %s)", step.release)
+		}
+		return fmt.Sprintf("EKS keeps the nodes of the node group at %s%s when its update fails, retry UpdateNodegroupVersion once the cause is fixed (e.g. a PodDisruptionBudget blocking the drain); the control plane and the add-ons stay at their new versions", step.From, release)
+	}
+}
+
+// abortPendingSteps marks the steps not started as aborted
+func abortPendingSteps(report *UpgradeReport) {
+	for i := range report.Steps {
+		if report.Steps[i].Status == UpgradeStepPending {
+			report.Steps[i].Status = UpgradeStepAborted
+		}
+	}
+}
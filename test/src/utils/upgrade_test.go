@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/camunda/camunda-tf-eks-module/utils/awsfake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+// newUpgradableCluster registers a cluster at 1.29 with the add-ons of the eks-cluster module and their versions for 1.30
+func newUpgradableCluster(server *awsfake.Server) {
+	server.AddCluster(awsfake.Cluster{
+		Name:       "cluster-upgrade",
+		Version:    "1.29",
+		Addons:     []string{"coredns", "kube-proxy", "vpc-cni"},
+		Nodegroups: []string{"services"},
+	})
+	server.AddAddonVersion(awsfake.AddonVersion{Addon: "coredns", Version: "v1.11.3-eksbuild.1", ClusterVersions: []string{"1.29", "1.30"}, Default: true})
+	server.AddAddonVersion(awsfake.AddonVersion{Addon: "kube-proxy", Version: "v1.30.0-eksbuild.3", ClusterVersions: []string{"1.30"}, Default: true})
+	server.AddAddonVersion(awsfake.AddonVersion{Addon: "vpc-cni", Version: "v1.19.2-eksbuild.1", ClusterVersions: []string{"1.29", "1.30"}})
+	server.AddAddonVersion(awsfake.AddonVersion{Addon: "vpc-cni", Version: "v1.18.6-eksbuild.1", ClusterVersions: []string{"1.29", "1.30"}, Default: true})
+}
+
+func TestUpgradeEKSCluster(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	newUpgradableCluster(server)
+	// the node of the node group is replaced by a ready one
+	kubeClient := fake.NewClientset(newTestNode("ip-10-0-1-1", "services", true))
+
+	report, err := UpgradeEKSCluster(context.Background(), eks.NewFromConfig(sess), EKSUpgrade{ClusterName: "cluster-upgrade", Version: "1.30", KubeClient: kubeClient})
+	require.NoError(t, err, report.Summary())
+
+	var steps []string
+	for _, step := range report.Steps {
+		steps = append(steps, step.Component+" "+string(step.Status)+" "+step.To)
+	}
+	assert.Equal(t, []string{
+		"control plane Succeeded 1.30",
+		"add-on coredns Succeeded v1.11.3-eksbuild.1",
+		"add-on kube-proxy Succeeded v1.30.0-eksbuild.3",
+		// the newest version is preferred to the default one
+		"add-on vpc-cni Succeeded v1.19.2-eksbuild.1",
+		"add-on aws-ebs-csi-driver Skipped ",
+		"node group services Succeeded 1.30",
+	}, steps)
+	assert.Nil(t, report.FailedStep())
+
+	cluster, _ := server.Cluster("cluster-upgrade")
+	assert.Equal(t, "1.30", cluster.Version)
+	assert.Equal(t, map[string]string{"coredns": "v1.11.3-eksbuild.1", "kube-proxy": "v1.30.0-eksbuild.3", "vpc-cni": "v1.19.2-eksbuild.1"}, cluster.AddonVersions)
+	assert.Equal(t, map[string]string{"services": "1.30"}, cluster.NodegroupVersions)
+	assert.Contains(t, report.Summary(), "Skipped   add-on aws-ebs-csi-driver (not installed)")
+}
+
+func TestUpgradeEKSClusterPreflightChecks(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	server.AddCluster(awsfake.Cluster{
+		Name:              "cluster-upgrade",
+		Version:           "1.29",
+		Addons:            []string{"coredns"},
+		Nodegroups:        []string{"services", "legacy"},
+		NodegroupVersions: map[string]string{"legacy": "1.26"},
+		Insights: []awsfake.Insight{
+			{Name: "Deprecated APIs removed in Kubernetes v1.30", KubernetesVersion: "1.30", Status: "ERROR", Reason: "Deprecated API usage detected within last 30 days"},
+			{Name: "Kubelet version skew", KubernetesVersion: "1.30", Status: "WARNING", Reason: "Node kubelet versions do not match the control plane"},
+			{Name: "Deprecated APIs removed in Kubernetes v1.29", KubernetesVersion: "1.29", Status: "ERROR"},
+		},
+	})
+	// no version of coredns supports 1.30
+	server.AddAddonVersion(awsfake.AddonVersion{Addon: "coredns", Version: "v1.11.1-eksbuild.9", ClusterVersions: []string{"1.29"}})
+
+	report, err := UpgradeEKSCluster(context.Background(), eks.NewFromConfig(sess), EKSUpgrade{ClusterName: "cluster-upgrade", Version: "1.30"})
+
+	require.ErrorContains(t, err, "pre-flight checks of the upgrade of the EKS cluster cluster-upgrade to 1.30 failed")
+	assert.Equal(t, []PreflightCheck{
+		{Name: "version skew", Status: PreflightFailed, Message: "node group legacy (1.26) would be more than 3 minor versions older than the control plane 1.30"},
+		{Name: "upgrade insights", Status: PreflightFailed, Message: "Deprecated APIs removed in Kubernetes v1.30 (ERROR: Deprecated API usage detected within last 30 days), Kubelet version skew (WARNING: Node kubelet versions do not match the control plane)"},
+		{Name: "add-on coredns", Status: PreflightFailed, Message: "no version of the add-on is compatible with kubernetes 1.30"},
+	}, report.Preflight)
+	for _, step := range report.Steps {
+		if step.Status != UpgradeStepSkipped {
+			assert.Equal(t, UpgradeStepAborted, step.Status, step.Component)
+		}
+	}
+	// nothing has been updated
+	assert.Zero(t, server.Calls("UpdateClusterVersion"))
+	assert.Zero(t, server.Calls("UpdateAddon"))
+}
+
+func TestUpgradeEKSClusterOneMinorVersionAtATime(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddCluster(awsfake.Cluster{Name: "cluster-upgrade", Version: "1.29"})
+
+	report, err := UpgradeEKSCluster(context.Background(), eks.NewFromConfig(sess), EKSUpgrade{ClusterName: "cluster-upgrade", Version: "1.31"})
+
+	assert.ErrorContains(t, err, "EKS upgrades the control plane one minor version at a time, 1.29 cannot be upgraded to 1.31")
+	assert.Equal(t, UpgradeStepAborted, report.Steps[0].Status)
+}
+
+func TestUpgradeEKSClusterStopsAtTheFailedStep(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	newUpgradableCluster(server)
+	server.UpdateScripts["kube-proxy"] = []string{awsfake.UpdateInProgress, awsfake.UpdateFailed}
+
+	report, err := UpgradeEKSCluster(context.Background(), eks.NewFromConfig(sess), EKSUpgrade{ClusterName: "cluster-upgrade", Version: "1.30", Addons: []string{"kube-proxy", "coredns"}})
+
+	var terminalErr *TerminalStateError
+	require.ErrorAs(t, err, &terminalErr)
+	assert.ErrorContains(t, err, "failed at the add-on kube-proxy")
+
+	failed := report.FailedStep()
+	require.NotNil(t, failed)
+	assert.Equal(t, "add-on kube-proxy", failed.Component)
+	assert.Equal(t, "restore the previous version of the add-on with UpdateAddon kube-proxy --addon-version v0.0.1-eksbuild.1; the control plane stays at its new version", failed.Rollback)
+
+	var statuses []UpgradeStepStatus
+	for _, step := range report.Steps {
+		statuses = append(statuses, step.Status)
+	}
+	assert.Equal(t, []UpgradeStepStatus{UpgradeStepSucceeded, UpgradeStepFailed, UpgradeStepAborted, UpgradeStepAborted}, statuses)
+
+	// the control plane has been upgraded, the node group is untouched
+	cluster, _ := server.Cluster("cluster-upgrade")
+	assert.Equal(t, "1.30", cluster.Version)
+	assert.Equal(t, "v0.0.1-eksbuild.1", cluster.AddonVersions["kube-proxy"])
+	assert.Equal(t, "1.29", cluster.NodegroupVersions["services"])
+	assert.Zero(t, server.Calls("UpdateNodegroupVersion"))
+	assert.Contains(t, report.Summary(), "rollback: restore the previous version of the add-on")
+}
+
+func TestUpgradeEKSClusterSkipsUpgradedComponents(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	server.AddCluster(awsfake.Cluster{
+		Name:              "cluster-upgrade",
+		Version:           "1.30",
+		Nodegroups:        []string{"services", "batch"},
+		NodegroupVersions: map[string]string{"batch": "1.29"},
+	})
+
+	// a previous run upgraded the control plane and failed on a node group
+	report, err := UpgradeEKSCluster(context.Background(), eks.NewFromConfig(sess), EKSUpgrade{ClusterName: "cluster-upgrade", Version: "1.30", KubeClient: fake.NewClientset(newTestNode("ip-10-0-2-1", "batch", true))})
+	require.NoError(t, err, report.Summary())
+
+	assert.Equal(t, UpgradeStepSkipped, report.Steps[0].Status)
+	assert.Equal(t, "already at 1.30", report.Steps[0].Reason)
+	assert.Zero(t, server.Calls("UpdateClusterVersion"))
+	assert.Equal(t, 1, server.Calls("UpdateNodegroupVersion"))
+	cluster, _ := server.Cluster("cluster-upgrade")
+	assert.Equal(t, "1.30", cluster.NodegroupVersions["batch"])
+}
+
+func TestUpgradeEKSClusterNeverDowngradesAddons(t *testing.T) {
+	fastDefaultWaitOptions(t)
+	server, sess := newFakeAwsConfig(t)
+	newUpgradableCluster(server)
+	// the eks-cluster module installs the most recent versions, newer than the default ones
+	server.AddCluster(awsfake.Cluster{
+		Name:          "cluster-upgrade",
+		Version:       "1.29",
+		Addons:        []string{"coredns", "kube-proxy", "vpc-cni"},
+		AddonVersions: map[string]string{"coredns": "v1.11.4-eksbuild.2", "kube-proxy": "v1.29.10-eksbuild.3", "vpc-cni": "v1.19.2-eksbuild.1"},
+		Nodegroups:    []string{"services"},
+	})
+	kubeClient := fake.NewClientset(newTestNode("ip-10-0-1-1", "services", true))
+
+	report, err := UpgradeEKSCluster(context.Background(), eks.NewFromConfig(sess), EKSUpgrade{ClusterName: "cluster-upgrade", Version: "1.30", KubeClient: kubeClient})
+	require.NoError(t, err, report.Summary())
+
+	reasons := make(map[string]string)
+	for _, step := range report.Steps {
+		reasons[step.Component] = string(step.Status) + " " + step.Reason
+	}
+	assert.Equal(t, "Skipped already at or above v1.11.3-eksbuild.1", reasons["add-on coredns"])
+	assert.Equal(t, "Succeeded ", reasons["add-on kube-proxy"])
+	assert.Equal(t, "Skipped already at or above v1.19.2-eksbuild.1", reasons["add-on vpc-cni"])
+	assert.Contains(t, report.Preflight, PreflightCheck{Name: "add-on coredns", Status: PreflightPassed, Message: "v1.11.4-eksbuild.2, already at or above v1.11.3-eksbuild.1"})
+
+	// only kube-proxy is updated, to a newer version
+	assert.Equal(t, 1, server.Calls("UpdateAddon"))
+	cluster, _ := server.Cluster("cluster-upgrade")
+	assert.Equal(t, map[string]string{"coredns": "v1.11.4-eksbuild.2", "kube-proxy": "v1.30.0-eksbuild.3", "vpc-cni": "v1.19.2-eksbuild.1"}, cluster.AddonVersions)
+}
+
+func TestCompareAddonVersions(t *testing.T) {
+	assert.Zero(t, compareAddonVersions("v1.18.6-eksbuild.1", "v1.18.6-eksbuild.1"))
+	assert.Negative(t, compareAddonVersions("v1.18.6-eksbuild.1", "v1.19.2-eksbuild.1"))
+	assert.Negative(t, compareAddonVersions("v1.18.6-eksbuild.1", "v1.18.6-eksbuild.10"))
+	// the numbers are compared, not the strings
+	assert.Positive(t, compareAddonVersions("v1.29.10-eksbuild.3", "v1.29.9-eksbuild.12"))
+	assert.Positive(t, compareAddonVersions("v1.30.0-eksbuild.3", "v1.29.10-eksbuild.3"))
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"path/filepath"
+	"strings"
+)
+
+// VariableType returns the type constraint of the variable, cty.DynamicPseudoType when it has no type
+func (v *ModuleVariable) VariableType() (cty.Type, error) {
+	if v.Type == nil {
+		return cty.DynamicPseudoType, nil
+	}
+	variableType, _, diags := typeexpr.TypeConstraintWithDefaults(v.Type)
+	if diags.HasErrors() {
+		return cty.NilType, fmt.Errorf("invalid type of the variable %q: %w", v.Name, diags)
+	}
+	return variableType, nil
+}
+
+// ValidateValue checks that value is accepted by the variable name of the module,
+// unlike terraform an attribute of an object which is not declared by the type is an error
+func (m *Module) ValidateValue(name string, value cty.Value) error {
+	variable, ok := m.Variables[name]
+	if !ok {
+		return fmt.Errorf("%q is not a variable of the module %s", name, m.Name)
+	}
+	variableType, err := variable.VariableType()
+	if err != nil {
+		return err
+	}
+
+	if _, err := convert.Convert(value, variableType); err != nil {
+		return fmt.Errorf("invalid value for the variable %q (%s): %w", name, typeexpr.TypeString(variableType), err)
+	}
+	if unexpected := unexpectedAttributes(nil, value, variableType); len(unexpected) > 0 {
+		return fmt.Errorf("invalid value for the variable %q: unexpected attributes %s", name, strings.Join(unexpected, ", "))
+	}
+	return nil
+}
+
+// unexpectedAttributes returns the paths of the attributes of value which are not declared by the object types of variableType
+func unexpectedAttributes(path cty.Path, value cty.Value, variableType cty.Type) []string {
+	if value.IsNull() || !value.IsKnown() {
+		return nil
+	}
+
+	valueType := value.Type()
+	var unexpected []string
+	switch {
+	case variableType.IsObjectType() && (valueType.IsObjectType() || valueType.IsMapType()):
+		for it := value.ElementIterator(); it.Next(); {
+			key, element := it.Element()
+			attributePath := path.GetAttr(key.AsString())
+			if !variableType.HasAttribute(key.AsString()) {
+				unexpected = append(unexpected, formatPath(attributePath))
+				continue
+			}
+			unexpected = append(unexpected, unexpectedAttributes(attributePath, element, variableType.AttributeType(key.AsString()))...)
+		}
+	case variableType.IsCollectionType() && value.CanIterateElements():
+		for it := value.ElementIterator(); it.Next(); {
+			key, element := it.Element()
+			unexpected = append(unexpected, unexpectedAttributes(path.Index(key), element, variableType.ElementType())...)
+		}
+	}
+	return unexpected
+}
+
+// formatPath formats a path of a value like terraform, e.g. [0].role_name
+func formatPath(path cty.Path) string {
+	var builder strings.Builder
+	for _, step := range path {
+		switch step := step.(type) {
+		case cty.GetAttrStep:
+			fmt.Fprintf(&builder, ".%s", step.Name)
+		case cty.IndexStep:
+			switch step.Key.Type() {
+			case cty.String:
+				fmt.Fprintf(&builder, "[%q]", step.Key.AsString())
+			case cty.Number:
+				fmt.Fprintf(&builder, "[%s]", step.Key.AsBigFloat().String())
+			default:
+				builder.WriteString("[...]")
+			}
+		}
+	}
+	return strings.TrimPrefix(builder.String(), ".")
+}
+
+// GoValueToCty converts a value of terraform.Options.Vars to a cty value of its implied type
+func GoValueToCty(value interface{}) (cty.Value, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	impliedType, err := ctyjson.ImpliedType(raw)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyjson.Unmarshal(raw, impliedType)
+}
+
+// ValidateModuleVars checks the variables passed to the module: the fixture fixtures.default.<fixture>.tfvars
+// and vars (terraform.Options.Vars) must only set variables of the module with values of the right type,
+// and together they must set every variable without default. It does not require terraform nor AWS account.
+func ValidateModuleVars(modulesDir, moduleName, fixture string, vars map[string]interface{}) error {
+	module, err := LoadModule(filepath.Join(modulesDir, moduleName))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	provided := make(map[string]struct{})
+
+	if fixture != "" {
+		fixtureFile := filepath.Join(modulesDir, "fixtures", fmt.Sprintf("fixtures.default.%s.tfvars", fixture))
+		attributes, err := LoadTfvars(fixtureFile)
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedKeys(attributes) {
+			provided[name] = struct{}{}
+			attribute := attributes[name]
+
+			value, diags := attribute.Expr.Value(nil)
+			if diags.HasErrors() {
+				errs = append(errs, fmt.Errorf("%s:%d: %w", fixtureFile, attribute.SrcRange.Start.Line, diags))
+				continue
+			}
+			if err := module.ValidateValue(name, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: %w", fixtureFile, attribute.SrcRange.Start.Line, err))
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(vars) {
+		provided[name] = struct{}{}
+
+		value, err := GoValueToCty(vars[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("vars: failed to convert %q: %w", name, err))
+			continue
+		}
+		if err := module.ValidateValue(name, value); err != nil {
+			errs = append(errs, fmt.Errorf("vars: %w", err))
+		}
+	}
+
+	for _, name := range module.RequiredVariables() {
+		if _, ok := provided[name]; !ok {
+			errs = append(errs, fmt.Errorf("the variable %q of the module %s has no default and is not set", name, moduleName))
+		}
+	}
+	return errors.Join(errs...)
+}
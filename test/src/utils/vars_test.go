@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// TestFixturesMatchModuleVariables validates each fixture with the variables set by the cleanup tooling
+func TestFixturesMatchModuleVariables(t *testing.T) {
+	for module, fixture := range ModuleFixtures {
+		t.Run(module, func(t *testing.T) {
+			vars, ok := DestroyVars(module, "cluster-test", "eu-central-1")
+			require.True(t, ok)
+			assert.NoError(t, ValidateModuleVars(testModulesDir, module, fixture, vars))
+		})
+	}
+}
+
+func auroraTestVars() map[string]interface{} {
+	return map[string]interface{}{
+		"cluster_name":       "postgres-cluster-test",
+		"username":           "adminuser",
+		"password":           "password",
+		"subnet_ids":         []string{"subnet-1", "subnet-2"},
+		"cidr_blocks":        []string{"10.192.0.0/19"},
+		"vpc_id":             "vpc-1",
+		"availability_zones": []string{"eu-central-1a", "eu-central-1b", "eu-central-1c"},
+		"iam_auth_enabled":   true,
+		"iam_roles_with_policies": []map[string]interface{}{
+			{"role_name": "AuroraRole", "trust_policy": "{}", "access_policy": "{}"},
+		},
+	}
+}
+
+func TestValidateModuleVars(t *testing.T) {
+	assert.NoError(t, ValidateModuleVars(testModulesDir, "aurora", "aurora", auroraTestVars()))
+
+	assert.NoError(t, ValidateModuleVars(testModulesDir, "eks-cluster", "eks", map[string]interface{}{
+		"name":                  "cluster-test",
+		"region":                "eu-central-1",
+		"np_desired_node_count": 4,
+		"availability_zones":    []string{"eu-central-1a", "eu-central-1b"},
+		"access_entries":        map[string]interface{}{},
+	}))
+}
+
+func TestValidateModuleVarsErrors(t *testing.T) {
+	vars := auroraTestVars()
+	delete(vars, "vpc_id")
+	vars["stale_variable"] = "value"
+	vars["iam_auth_enabled"] = []string{"true"}
+	vars["iam_roles_with_policies"] = []map[string]interface{}{
+		{"role_name": "AuroraRole", "trust_policy": "{}"},
+		{"role_name": "AuroraRole2", "trust_policy": "{}", "access_policy": "{}", "policy": "{}"},
+	}
+
+	err := ValidateModuleVars(testModulesDir, "aurora", "aurora", vars)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, `"stale_variable" is not a variable of the module aurora`)
+	assert.ErrorContains(t, err, `invalid value for the variable "iam_auth_enabled" (bool)`)
+	assert.ErrorContains(t, err, `invalid value for the variable "iam_roles_with_policies"`)
+	assert.ErrorContains(t, err, `the variable "vpc_id" of the module aurora has no default and is not set`)
+
+	delete(vars["iam_roles_with_policies"].([]map[string]interface{})[1], "policy")
+	vars["iam_roles_with_policies"].([]map[string]interface{})[0]["access_policy"] = "{}"
+	vars["iam_roles_with_policies"].([]map[string]interface{})[1]["policy"] = "{}"
+	err = ValidateModuleVars(testModulesDir, "aurora", "aurora", vars)
+	assert.ErrorContains(t, err, `unexpected attributes [1].policy`)
+}
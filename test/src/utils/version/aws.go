@@ -0,0 +1,118 @@
+package version
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
+	"github.com/aws/aws-sdk-go-v2/service/opensearch"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"strings"
+)
+
+// SupportedEKS returns the kubernetes versions EKS can run, in standard or extended support (DescribeClusterVersions)
+func SupportedEKS(ctx context.Context, client *eks.Client) (Versions, error) {
+	var versions []Version
+	paginator := eks.NewDescribeClusterVersionsPaginator(client, &eks.DescribeClusterVersionsInput{IncludeAll: aws.Bool(true)})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe the EKS cluster versions: %w", err)
+		}
+
+		for _, clusterVersion := range output.ClusterVersions {
+			if clusterVersion.VersionStatus == ekstypes.VersionStatusUnsupported {
+				continue
+			}
+			version, err := Parse(EKS, aws.ToString(clusterVersion.ClusterVersion))
+			if err != nil {
+				return nil, err
+			}
+			versions = append(versions, version)
+		}
+	}
+	return NewVersions(versions...), nil
+}
+
+// SupportedAuroraPostgreSQL returns the available engine versions of Aurora PostgreSQL (DescribeDBEngineVersions),
+// the variants such as 16.4-limitless, the deprecated versions and the versions that cannot be parsed are ignored
+func SupportedAuroraPostgreSQL(ctx context.Context, client *rds.Client) (Versions, error) {
+	var versions []Version
+	paginator := rds.NewDescribeDBEngineVersionsPaginator(client, &rds.DescribeDBEngineVersionsInput{Engine: aws.String(string(AuroraPostgreSQL))})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe the %s engine versions: %w", AuroraPostgreSQL, err)
+		}
+
+		for _, engineVersion := range output.DBEngineVersions {
+			value := aws.ToString(engineVersion.EngineVersion)
+			if strings.Contains(value, "-") || aws.ToString(engineVersion.Status) == "deprecated" {
+				continue
+			}
+			// a version in another format (e.g. 9.6.22 of the first releases) must not break the whole list
+			version, err := Parse(AuroraPostgreSQL, value)
+			if err != nil {
+				continue
+			}
+			versions = append(versions, version)
+		}
+	}
+	return NewVersions(versions...), nil
+}
+
+// AuroraPostgreSQLUpgradeTargets returns the versions an Aurora PostgreSQL cluster at version can be upgraded to
+// (ValidUpgradeTarget of DescribeDBEngineVersions), the variants and the versions that cannot be parsed are ignored
+func AuroraPostgreSQLUpgradeTargets(ctx context.Context, client *rds.Client, version Version) (Versions, error) {
+	output, err := client.DescribeDBEngineVersions(ctx, &rds.DescribeDBEngineVersionsInput{
+		Engine:        aws.String(string(AuroraPostgreSQL)),
+		EngineVersion: aws.String(version.String()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the %s engine version %s: %w", AuroraPostgreSQL, version, err)
+	}
+	if len(output.DBEngineVersions) == 0 {
+		return nil, fmt.Errorf("%s version %s is not available", AuroraPostgreSQL, version)
+	}
+
+	var targets []Version
+	for _, target := range output.DBEngineVersions[0].ValidUpgradeTarget {
+		value := aws.ToString(target.EngineVersion)
+		if strings.Contains(value, "-") {
+			continue
+		}
+		targetVersion, err := Parse(AuroraPostgreSQL, value)
+		if err != nil {
+			continue
+		}
+		targets = append(targets, targetVersion)
+	}
+	return NewVersions(targets...), nil
+}
+
+// SupportedOpenSearch returns the OpenSearch versions of the service (ListVersions),
+// the Elasticsearch ones and the versions that cannot be parsed are ignored
+func SupportedOpenSearch(ctx context.Context, client *opensearch.Client) (Versions, error) {
+	var versions []Version
+	paginator := opensearch.NewListVersionsPaginator(client, &opensearch.ListVersionsInput{})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the OpenSearch versions: %w", err)
+		}
+
+		for _, value := range output.Versions {
+			if !strings.HasPrefix(value, openSearchPrefix) {
+				continue
+			}
+			// a version in another format (e.g. OpenSearch_2.x) must not break the whole list
+			version, err := Parse(OpenSearch, value)
+			if err != nil {
+				continue
+			}
+			versions = append(versions, version)
+		}
+	}
+	return NewVersions(versions...), nil
+}
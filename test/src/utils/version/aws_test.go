@@ -0,0 +1,88 @@
+package version
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/opensearch"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/camunda/camunda-tf-eks-module/utils/awsfake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// newFakeAwsConfig targets the fake with static credentials, utils.WithAwsEndpoint cannot be used as utils imports this package
+func newFakeAwsConfig(t *testing.T) (*awsfake.Server, aws.Config) {
+	server := awsfake.NewServer()
+	t.Cleanup(server.Close)
+
+	return server, aws.Config{
+		Region:       "eu-central-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("AKIDFAKE", "fake-secret", ""),
+	}
+}
+
+func TestSupportedEKS(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddClusterVersion(awsfake.ClusterVersion{Version: "1.31", Status: "STANDARD_SUPPORT"})
+	server.AddClusterVersion(awsfake.ClusterVersion{Version: "1.30", Status: "EXTENDED_SUPPORT"})
+	server.AddClusterVersion(awsfake.ClusterVersion{Version: "1.29", Status: "UNSUPPORTED"})
+
+	versions, err := SupportedEKS(context.Background(), eks.NewFromConfig(sess))
+	require.NoError(t, err)
+	assert.Equal(t, "1.30, 1.31", versions.String())
+}
+
+func TestSupportedAuroraPostgreSQL(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddEngineVersion(awsfake.EngineVersion{Engine: "aurora-postgresql", Version: "16.1"})
+	server.AddEngineVersion(awsfake.EngineVersion{Engine: "aurora-postgresql", Version: "15.4"})
+	server.AddEngineVersion(awsfake.EngineVersion{Engine: "aurora-postgresql", Version: "16.4-limitless"})
+	server.AddEngineVersion(awsfake.EngineVersion{Engine: "aurora-postgresql", Version: "11.9", Status: "deprecated"})
+	server.AddEngineVersion(awsfake.EngineVersion{Engine: "aurora-postgresql", Version: "9.6.22"})
+	server.AddEngineVersion(awsfake.EngineVersion{Engine: "aurora-postgresql", Version: "17.x"})
+	server.AddEngineVersion(awsfake.EngineVersion{Engine: "aurora-mysql", Version: "8.0.mysql_aurora.3.05.2"})
+
+	versions, err := SupportedAuroraPostgreSQL(context.Background(), rds.NewFromConfig(sess))
+	require.NoError(t, err)
+	assert.Equal(t, "15.4, 16.1", versions.String())
+}
+
+func TestAuroraPostgreSQLUpgradeTargets(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddEngineVersion(awsfake.EngineVersion{Engine: "aurora-postgresql", Version: "15.4", UpgradeTargets: []string{"16.1", "15.5", "16.4-limitless", "15.6", "16.x"}})
+
+	targets, err := AuroraPostgreSQLUpgradeTargets(context.Background(), rds.NewFromConfig(sess), MustParse(AuroraPostgreSQL, "15.4"))
+	require.NoError(t, err)
+	assert.Equal(t, "15.5, 15.6, 16.1", targets.String())
+	minor, _ := targets.NextMinor(MustParse(AuroraPostgreSQL, "15.4"))
+	assert.Equal(t, "15.5", minor.String())
+
+	_, err = AuroraPostgreSQLUpgradeTargets(context.Background(), rds.NewFromConfig(sess), MustParse(AuroraPostgreSQL, "14.9"))
+	assert.EqualError(t, err, "aurora-postgresql version 14.9 is not available")
+}
+
+func TestSupportedOpenSearch(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddOpenSearchVersion("OpenSearch_2.15")
+	server.AddOpenSearchVersion("OpenSearch_2.13")
+	server.AddOpenSearchVersion("Elasticsearch_7.10")
+	server.AddOpenSearchVersion("OpenSearch_2.x")
+
+	versions, err := SupportedOpenSearch(context.Background(), opensearch.NewFromConfig(sess))
+	require.NoError(t, err)
+	assert.Equal(t, "OpenSearch_2.13, OpenSearch_2.15", versions.String())
+	assert.NoError(t, versions.Validate(MustParse(OpenSearch, "2.15")))
+}
+
+func TestSupportedVersionsAccessDenied(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.InjectFault("ListVersions", awsfake.AccessDenied())
+
+	_, err := SupportedOpenSearch(context.Background(), opensearch.NewFromConfig(sess))
+	assert.ErrorContains(t, err, "failed to list the OpenSearch versions")
+	assert.ErrorContains(t, err, "AccessDeniedException")
+}
@@ -0,0 +1,169 @@
+// Package version parses, compares and validates the versions of the engines deployed by the modules:
+// the kubernetes versions of EKS ("1.32", "v1.32.1"), the engine_version of Aurora PostgreSQL ("15.4")
+// and the engine_version of OpenSearch ("OpenSearch_2.15", or "2.15" as set in the opensearch module).
+package version
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Engine defines the format of a version
+type Engine string
+
+const (
+	// EKS versions are kubernetes versions, the patch version and the build suffix of the kubelets are ignored
+	EKS Engine = "eks"
+	// AuroraPostgreSQL versions are "<major>.<minor>" PostgreSQL versions
+	AuroraPostgreSQL Engine = "aurora-postgresql"
+	// OpenSearch versions are prefixed by OpenSearch_ in the AWS APIs but not in the opensearch module
+	OpenSearch Engine = "opensearch"
+)
+
+// openSearchPrefix is the prefix of the OpenSearch versions in the AWS APIs, the Elasticsearch_ versions are not supported
+const openSearchPrefix = "OpenSearch_"
+
+// Version is a "<major>.<minor>" version of an engine, the unit of the upgrades of EKS, Aurora and OpenSearch
+type Version struct {
+	Engine Engine
+	Major  int
+	Minor  int
+}
+
+// Parse parses a version of the engine, e.g. Parse(EKS, "v1.32.0"), Parse(AuroraPostgreSQL, "15.4") or Parse(OpenSearch, "OpenSearch_2.15")
+func Parse(engine Engine, value string) (Version, error) {
+	trimmed := strings.TrimSpace(value)
+	maxParts := 2
+	switch engine {
+	case EKS:
+		trimmed = strings.TrimPrefix(trimmed, "v")
+		maxParts = 3
+	case AuroraPostgreSQL:
+	case OpenSearch:
+		if prefix, _, found := strings.Cut(trimmed, "_"); found && prefix+"_" != openSearchPrefix {
+			return Version{}, fmt.Errorf("invalid %s version %q, expected %s<major>.<minor>", engine, value, openSearchPrefix)
+		}
+		trimmed = strings.TrimPrefix(trimmed, openSearchPrefix)
+	default:
+		return Version{}, fmt.Errorf("unknown engine %q", engine)
+	}
+
+	parts := strings.Split(trimmed, ".")
+	if len(parts) < 2 || len(parts) > maxParts {
+		return Version{}, fmt.Errorf("invalid %s version %q, expected <major>.<minor>", engine, value)
+	}
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		if i == 2 {
+			// the patch version of the kubelets has a build suffix, e.g. v1.32.1-eks-5e0fdde
+			part, _, _ = strings.Cut(part, "-")
+		}
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return Version{}, fmt.Errorf("invalid %s version %q: %q is not a number", engine, value, part)
+		}
+		numbers[i] = number
+	}
+	return Version{Engine: engine, Major: numbers[0], Minor: numbers[1]}, nil
+}
+
+// MustParse is Parse for the versions known to be valid, it panics on error
+func MustParse(engine Engine, value string) Version {
+	version, err := Parse(engine, value)
+	if err != nil {
+		panic(err)
+	}
+	return version
+}
+
+// String returns the version in the format of the AWS APIs, e.g. "1.32", "15.4" or "OpenSearch_2.15"
+func (v Version) String() string {
+	if v.Engine == OpenSearch {
+		return openSearchPrefix + v.Number()
+	}
+	return v.Number()
+}
+
+// Number returns "<major>.<minor>", the format of the version variables of the modules
+func (v Version) Number() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// Compare returns -1, 0 or +1 depending on whether v is older, equal or newer than other.
+// The versions of different engines are ordered by engine first.
+func (v Version) Compare(other Version) int {
+	return cmp.Or(strings.Compare(string(v.Engine), string(other.Engine)), cmp.Compare(v.Major, other.Major), cmp.Compare(v.Minor, other.Minor))
+}
+
+// NextMinor returns the next minor version, it may not exist: see Versions.NextMinor
+func (v Version) NextMinor() Version {
+	return Version{Engine: v.Engine, Major: v.Major, Minor: v.Minor + 1}
+}
+
+// NextMajor returns the first version of the next major version, it may not exist: see Versions.NextMajor
+func (v Version) NextMajor() Version {
+	return Version{Engine: v.Engine, Major: v.Major + 1, Minor: 0}
+}
+
+// Versions is a sorted set of versions of an engine, e.g. the versions supported by AWS
+type Versions []Version
+
+// NewVersions sorts the versions and removes the duplicates
+func NewVersions(versions ...Version) Versions {
+	sorted := slices.Clone(versions)
+	slices.SortFunc(sorted, Version.Compare)
+	return slices.Compact(sorted)
+}
+
+// Contains returns true if the version is in the set
+func (vs Versions) Contains(version Version) bool {
+	return slices.Contains(vs, version)
+}
+
+// Validate returns an error listing the versions of the set if the version is not in it
+func (vs Versions) Validate(version Version) error {
+	if vs.Contains(version) {
+		return nil
+	}
+	return fmt.Errorf("%s version %s is not supported (supported versions: %s)", version.Engine, version, vs)
+}
+
+// Latest returns the newest version of the set
+func (vs Versions) Latest() (Version, bool) {
+	if len(vs) == 0 {
+		return Version{}, false
+	}
+	return vs[len(vs)-1], true
+}
+
+// NextMinor returns the oldest version of the set newer than version with the same major version,
+// e.g. 15.5 for 15.4 in [15.4, 15.5, 15.6, 16.1]
+func (vs Versions) NextMinor(version Version) (Version, bool) {
+	for _, candidate := range vs {
+		if candidate.Engine == version.Engine && candidate.Major == version.Major && candidate.Minor > version.Minor {
+			return candidate, true
+		}
+	}
+	return Version{}, false
+}
+
+// NextMajor returns the oldest version of the set with the next major version, e.g. 16.1 for 15.4 in [15.4, 15.5, 16.1, 16.2]
+func (vs Versions) NextMajor(version Version) (Version, bool) {
+	for _, candidate := range vs {
+		if candidate.Engine == version.Engine && candidate.Major == version.Major+1 {
+			return candidate, true
+		}
+	}
+	return Version{}, false
+}
+
+func (vs Versions) String() string {
+	names := make([]string, 0, len(vs))
+	for _, version := range vs {
+		names = append(names, version.String())
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,81 @@
+package version
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, value := range []string{"1.32", "1.32.0", "v1.32", "v1.32.1", "v1.32.1-eks-5e0fdde"} {
+		version, err := Parse(EKS, value)
+		require.NoError(t, err, value)
+		assert.Equal(t, Version{Engine: EKS, Major: 1, Minor: 32}, version, value)
+		assert.Equal(t, "1.32", version.String())
+	}
+
+	aurora, err := Parse(AuroraPostgreSQL, "15.4")
+	require.NoError(t, err)
+	assert.Equal(t, Version{Engine: AuroraPostgreSQL, Major: 15, Minor: 4}, aurora)
+
+	for _, value := range []string{"OpenSearch_2.15", "2.15"} {
+		version, err := Parse(OpenSearch, value)
+		require.NoError(t, err, value)
+		assert.Equal(t, "OpenSearch_2.15", version.String())
+		// the opensearch module adds the prefix to its engine_version
+		assert.Equal(t, "2.15", version.Number())
+	}
+
+	for engine, values := range map[Engine][]string{
+		EKS:              {"", "1", "1.x", "1.32.0.1", "latest", "1.-1"},
+		AuroraPostgreSQL: {"15", "15.4.1", "v15.4", "16.4-limitless"},
+		OpenSearch:       {"Elasticsearch_7.10", "OpenSearch_2", "2.x"},
+		"aurora-mysql":   {"8.0.mysql_aurora.3.05.2"},
+	} {
+		for _, value := range values {
+			_, err := Parse(engine, value)
+			assert.Error(t, err, "%s %s", engine, value)
+		}
+	}
+}
+
+func TestCompareAndNext(t *testing.T) {
+	v115 := MustParse(EKS, "1.15")
+	assert.Equal(t, -1, MustParse(EKS, "1.9").Compare(v115))
+	assert.Equal(t, 0, MustParse(EKS, "v1.15.3").Compare(v115))
+	assert.Equal(t, 1, MustParse(EKS, "2.0").Compare(v115))
+
+	assert.Equal(t, "1.16", v115.NextMinor().String())
+	assert.Equal(t, "OpenSearch_3.0", MustParse(OpenSearch, "2.19").NextMajor().String())
+}
+
+func TestVersions(t *testing.T) {
+	supported := NewVersions(
+		MustParse(AuroraPostgreSQL, "16.2"),
+		MustParse(AuroraPostgreSQL, "15.4"),
+		MustParse(AuroraPostgreSQL, "15.6"),
+		MustParse(AuroraPostgreSQL, "16.1"),
+		MustParse(AuroraPostgreSQL, "15.4"),
+	)
+	assert.Equal(t, "15.4, 15.6, 16.1, 16.2", supported.String())
+
+	latest, ok := supported.Latest()
+	require.True(t, ok)
+	assert.Equal(t, "16.2", latest.String())
+
+	// the minor versions may be skipped by AWS
+	next, ok := supported.NextMinor(MustParse(AuroraPostgreSQL, "15.4"))
+	require.True(t, ok)
+	assert.Equal(t, "15.6", next.String())
+	_, ok = supported.NextMinor(MustParse(AuroraPostgreSQL, "15.6"))
+	assert.False(t, ok)
+
+	next, ok = supported.NextMajor(MustParse(AuroraPostgreSQL, "15.4"))
+	require.True(t, ok)
+	assert.Equal(t, "16.1", next.String())
+	_, ok = supported.NextMajor(latest)
+	assert.False(t, ok)
+
+	assert.NoError(t, supported.Validate(MustParse(AuroraPostgreSQL, "16.1")))
+	assert.EqualError(t, supported.Validate(MustParse(AuroraPostgreSQL, "15.5")), "aurora-postgresql version 15.5 is not supported (supported versions: 15.4, 15.6, 16.1, 16.2)")
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/camunda/camunda-tf-eks-module/utils/version"
+)
+
+// PlanEKSUpgradePath returns the versions the cluster goes through from source to target: EKS upgrades the control plane
+// one minor version at a time, so the path has one version per minor release after source, up to target included.
+// Every version of the path must be in supported, the path is empty when source is target.
+func PlanEKSUpgradePath(source, target string, supported version.Versions) ([]version.Version, error) {
+	from, err := version.Parse(version.EKS, source)
+	if err != nil {
+		return nil, err
+	}
+	to, err := version.Parse(version.EKS, target)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case from.Major != to.Major:
+		return nil, fmt.Errorf("no EKS upgrade path from %s to %s, the major version cannot change", from, to)
+	case to.Compare(from) < 0:
+		return nil, fmt.Errorf("no EKS upgrade path from %s to %s, the control plane cannot be downgraded", from, to)
+	}
+
+	var path []version.Version
+	for hop := from.NextMinor(); hop.Compare(to) <= 0; hop = hop.NextMinor() {
+		if err := supported.Validate(hop); err != nil {
+			return nil, fmt.Errorf("no EKS upgrade path from %s to %s: %w", from, to, err)
+		}
+		path = append(path, hop)
+	}
+	return path, nil
+}
+
+// PlanEKSUpgrade plans the upgrade path from source to target against the versions supported by EKS
+func PlanEKSUpgrade(ctx context.Context, client *eks.Client, source, target string) ([]version.Version, error) {
+	supported, err := version.SupportedEKS(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return PlanEKSUpgradePath(source, target, supported)
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/camunda/camunda-tf-eks-module/utils/awsfake"
+	"github.com/camunda/camunda-tf-eks-module/utils/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestIncrementMinorVersionTwoParts(t *testing.T) {
+	for value, expected := range map[string]string{"1.29": "1.30", "v1.29.3": "1.30", "1.9": "1.10"} {
+		next, err := IncrementMinorVersionTwoParts(value)
+		require.NoError(t, err)
+		assert.Equal(t, expected, next)
+	}
+}
+
+func TestPlanEKSUpgradePath(t *testing.T) {
+	supported := version.NewVersions(
+		version.MustParse(version.EKS, "1.29"),
+		version.MustParse(version.EKS, "1.30"),
+		version.MustParse(version.EKS, "1.31"),
+		version.MustParse(version.EKS, "1.32"),
+	)
+
+	path, err := PlanEKSUpgradePath("1.29", "v1.32.0", supported)
+	require.NoError(t, err)
+	assert.Equal(t, "1.30, 1.31, 1.32", version.Versions(path).String())
+
+	path, err = PlanEKSUpgradePath("1.31", "1.31", supported)
+	require.NoError(t, err)
+	assert.Empty(t, path)
+
+	_, err = PlanEKSUpgradePath("1.30", "1.29", supported)
+	assert.ErrorContains(t, err, "the control plane cannot be downgraded")
+
+	// the source may no longer be supported but every hop must be
+	_, err = PlanEKSUpgradePath("1.28", "1.33", supported)
+	assert.EqualError(t, err, "no EKS upgrade path from 1.28 to 1.33: eks version 1.33 is not supported (supported versions: 1.29, 1.30, 1.31, 1.32)")
+}
+
+func TestPlanEKSUpgrade(t *testing.T) {
+	server, sess := newFakeAwsConfig(t)
+	server.AddClusterVersion(awsfake.ClusterVersion{Version: "1.31", Status: "STANDARD_SUPPORT"})
+	server.AddClusterVersion(awsfake.ClusterVersion{Version: "1.30", Status: "EXTENDED_SUPPORT"})
+	server.AddClusterVersion(awsfake.ClusterVersion{Version: "1.32", Status: "STANDARD_SUPPORT", Default: true})
+	server.AddClusterVersion(awsfake.ClusterVersion{Version: "1.29", Status: "UNSUPPORTED"})
+
+	path, err := PlanEKSUpgrade(context.Background(), eks.NewFromConfig(sess), "1.29", "1.32")
+	require.NoError(t, err)
+	assert.Equal(t, "1.30, 1.31, 1.32", version.Versions(path).String())
+
+	_, err = PlanEKSUpgrade(context.Background(), eks.NewFromConfig(sess), "1.28", "1.30")
+	assert.ErrorContains(t, err, "eks version 1.29 is not supported")
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// WaitOptions configures the exponential backoff used by WaitFor
+type WaitOptions struct {
+	// Description is a human-readable name of what is awaited, used in logs and errors
+	Description string
+	// InitialInterval is the delay before the second attempt
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between two attempts
+	MaxInterval time.Duration
+	// Multiplier is applied to the interval after each attempt
+	Multiplier float64
+	// Jitter is the randomization factor applied to each interval (0.2 means +/- 20%)
+	Jitter float64
+	// MaxDuration is the total budget of the wait, 0 means only the context deadline applies
+	MaxDuration time.Duration
+}
+
+// defaultInitialInterval and defaultMaxInterval are the intervals of DefaultWaitOptions, the unit tests lower them
+var (
+	defaultInitialInterval = 2 * time.Second
+	defaultMaxInterval     = 30 * time.Second
+)
+
+// DefaultWaitOptions returns the backoff settings used by the helpers of this package
+func DefaultWaitOptions(description string, maxDuration time.Duration) WaitOptions {
+	return WaitOptions{
+		Description:     description,
+		InitialInterval: defaultInitialInterval,
+		MaxInterval:     defaultMaxInterval,
+		Multiplier:      1.5,
+		Jitter:          0.2,
+		MaxDuration:     maxDuration,
+	}
+}
+
+// ConditionFunc is polled by WaitFor until it returns true or an error.
+// Returning an error stops the wait immediately unless it is transient (see IsRetryable),
+// use a TerminalStateError to report that the awaited resource reached a state it will never leave.
+type ConditionFunc func(ctx context.Context) (bool, error)
+
+// TimeoutError is returned when the wait budget or the context deadline is exhausted
+type TimeoutError struct {
+	Description string
+	Elapsed     time.Duration
+	Attempts    int
+	// LastState is the last observed state reported through WaitState, if any
+	LastState string
+	// LastError is the last transient error returned by the condition, if any
+	LastError error
+	Cause     error
+}
+
+func (e *TimeoutError) Error() string {
+	msg := fmt.Sprintf("timeout waiting for %s after %s (%d attempts)", e.Description, e.Elapsed.Round(time.Second), e.Attempts)
+	if e.LastState != "" {
+		msg = fmt.Sprintf("%s, last state: %s", msg, e.LastState)
+	}
+	if e.LastError != nil {
+		msg = fmt.Sprintf("%s, last error: %v", msg, e.LastError)
+	}
+	return msg
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Cause
+}
+
+// TerminalStateError is returned when the awaited resource reached a final state that is not the expected one
+type TerminalStateError struct {
+	Description string
+	State       string
+	Reason      string
+}
+
+func (e *TerminalStateError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%s reached terminal state %s: %s", e.Description, e.State, e.Reason)
+	}
+	return fmt.Sprintf("%s reached terminal state %s", e.Description, e.State)
+}
+
+// IsTimeout reports whether err is or wraps a TimeoutError
+func IsTimeout(err error) bool {
+	var timeoutErr *TimeoutError
+	return errors.As(err, &timeoutErr)
+}
+
+// IsTerminalState reports whether err is or wraps a TerminalStateError
+func IsTerminalState(err error) bool {
+	var terminalErr *TerminalStateError
+	return errors.As(err, &terminalErr)
+}
+
+type waitStateKey struct{}
+
+// WaitState records the last observed state of the awaited resource, it is reported in the TimeoutError.
+// It must be called with the context received by the ConditionFunc.
+func WaitState(ctx context.Context, state string) {
+	if last, ok := ctx.Value(waitStateKey{}).(*string); ok {
+		*last = state
+	}
+}
+
+// WaitFor polls condition with an exponential backoff and jitter until it returns true,
+// returns a non retryable error, the MaxDuration budget is exhausted or ctx is done.
+func WaitFor(ctx context.Context, opts WaitOptions, condition ConditionFunc) error {
+	if opts.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.MaxDuration)
+		defer cancel()
+	}
+
+	var lastState string
+	var lastErr error
+	conditionCtx := context.WithValue(ctx, waitStateKey{}, &lastState)
+
+	start := time.Now()
+	interval := opts.InitialInterval
+	attempts := 0
+
+	for {
+		attempts++
+		done, err := condition(conditionCtx)
+		switch {
+		case err == nil:
+		case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+			return &TimeoutError{Description: opts.Description, Elapsed: time.Since(start), Attempts: attempts, LastState: lastState, LastError: lastErr, Cause: ctx.Err()}
+		case IsRetryable(err):
+			lastErr, done = err, false
+		default:
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		timer := time.NewTimer(nextInterval(interval, opts.Jitter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &TimeoutError{Description: opts.Description, Elapsed: time.Since(start), Attempts: attempts, LastState: lastState, LastError: lastErr, Cause: ctx.Err()}
+		case <-timer.C:
+		}
+
+		interval = time.Duration(float64(interval) * math.Max(opts.Multiplier, 1))
+		if opts.MaxInterval > 0 && interval > opts.MaxInterval {
+			interval = opts.MaxInterval
+		}
+	}
+}
+
+// nextInterval applies the jitter factor to the interval
+func nextInterval(interval time.Duration, jitter float64) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	if jitter <= 0 {
+		return interval
+	}
+	delta := jitter * float64(interval)
+	return time.Duration(float64(interval) - delta + rand.Float64()*2*delta)
+}
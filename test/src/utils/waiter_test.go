@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// fastDefaultWaitOptions lowers the intervals of DefaultWaitOptions for the duration of the test
+func fastDefaultWaitOptions(t *testing.T) {
+	initialInterval, maxInterval := defaultInitialInterval, defaultMaxInterval
+	defaultInitialInterval, defaultMaxInterval = time.Millisecond, 10*time.Millisecond
+	t.Cleanup(func() {
+		defaultInitialInterval, defaultMaxInterval = initialInterval, maxInterval
+	})
+}
+
+func fastWaitOptions(maxDuration time.Duration) WaitOptions {
+	return WaitOptions{
+		Description:     "test condition",
+		InitialInterval: time.Millisecond,
+		MaxInterval:     5 * time.Millisecond,
+		Multiplier:      2,
+		Jitter:          0.5,
+		MaxDuration:     maxDuration,
+	}
+}
+
+func TestWaitForSucceeds(t *testing.T) {
+	attempts := 0
+	err := WaitFor(context.Background(), fastWaitOptions(time.Second), func(ctx context.Context) (bool, error) {
+		attempts++
+		return attempts == 3, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestWaitForTimeout(t *testing.T) {
+	err := WaitFor(context.Background(), fastWaitOptions(50*time.Millisecond), func(ctx context.Context) (bool, error) {
+		WaitState(ctx, "InProgress")
+		return false, nil
+	})
+
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.True(t, IsTimeout(err))
+	assert.Equal(t, "InProgress", timeoutErr.LastState)
+	assert.Greater(t, timeoutErr.Attempts, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestWaitForRespectsParentContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := WaitFor(ctx, fastWaitOptions(time.Hour), func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+	assert.True(t, IsTimeout(err))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWaitForTerminalState(t *testing.T) {
+	attempts := 0
+	err := WaitFor(context.Background(), fastWaitOptions(time.Second), func(ctx context.Context) (bool, error) {
+		attempts++
+		return false, &TerminalStateError{Description: "update", State: "Failed"}
+	})
+	assert.True(t, IsTerminalState(err))
+	assert.False(t, IsTimeout(err))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestWaitForConditionError(t *testing.T) {
+	errCondition := errors.New("boom")
+	err := WaitFor(context.Background(), fastWaitOptions(time.Second), func(ctx context.Context) (bool, error) {
+		return false, errCondition
+	})
+	assert.ErrorIs(t, err, errCondition)
+}
+
+func TestNextIntervalJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		interval := nextInterval(time.Second, 0.2)
+		assert.GreaterOrEqual(t, interval, 800*time.Millisecond)
+		assert.LessOrEqual(t, interval, 1200*time.Millisecond)
+	}
+	assert.Equal(t, time.Second, nextInterval(time.Second, 0))
+}